@@ -0,0 +1,125 @@
+// Command audit reads the history of the authorizations of an address and
+// overrides their status:
+//
+//	audit history -network 1 -address 0x...
+//	audit override -network 1 -address 0x... -platform twitter -status revoked -reason spam -operator alice
+//
+// The overrides are recorded in the history with their reason and operator.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/proxy"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "history":
+		history(os.Args[2:])
+	case "override":
+		override(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: audit history|override [flags]")
+	os.Exit(2)
+}
+
+func history(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	networkID := flags.Int("network", 0, "network ID of the authorizations")
+	userAddress := flags.String("address", "", "address whose history is printed")
+	asJSON := flags.Bool("json", false, "print the events as JSON, one per line")
+	flags.Parse(args)
+
+	if *networkID == 0 || *userAddress == "" {
+		log.Fatal("-network and -address must be set")
+	}
+
+	table := db.GetAuthorizationEventTable(*networkID)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if !*asJSON {
+		fmt.Fprintln(w, "TIME\tPLATFORM\tTYPE\tACTOR\tSTATUS\tREASON\tUSERNAME\tPROOF")
+	}
+
+	after := ""
+	for {
+		events, next, err := table.GetAuthorizationEvents(*userAddress, 100, after)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, event := range events {
+			if *asJSON {
+				bs, _ := json.Marshal(event)
+				fmt.Println(string(bs))
+				continue
+			}
+
+			actor := event.Actor
+			if event.Operator != "" {
+				actor += ":" + event.Operator
+			}
+			fmt.Fprintln(w, strings.Join([]string{
+				event.CreatedAt.Format(time.RFC3339),
+				string(event.PlatformName),
+				string(event.Type),
+				actor,
+				string(event.Status),
+				event.Reason,
+				event.Username,
+				event.ProofURL,
+			}, "\t"))
+		}
+
+		if next == "" {
+			break
+		}
+		after = next
+	}
+	w.Flush()
+}
+
+func override(args []string) {
+	flags := flag.NewFlagSet("override", flag.ExitOnError)
+	networkID := flags.Int("network", 0, "network ID of the authorization")
+	userAddress := flags.String("address", "", "address of the authorization")
+	platform := flags.String("platform", "", "platform of the authorization")
+	status := flags.String("status", "", "verified, failed or revoked")
+	reason := flags.String("reason", "", "why the status is overridden")
+	operator := flags.String("operator", os.Getenv("USER"), "who overrides the status")
+	flags.Parse(args)
+
+	if *networkID == 0 || *userAddress == "" || *platform == "" {
+		log.Fatal("-network, -address and -platform must be set")
+	}
+
+	err := proxy.OverrideAuthorization(
+		*networkID,
+		*userAddress,
+		db.PlatformName(*platform),
+		db.AuthorizationStatus(*status),
+		*reason,
+		*operator,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s of %s is %s\n", *platform, *userAddress, *status)
+}
@@ -0,0 +1,57 @@
+// Command backfill adds the username index to the authorization tables and
+// rewrites the items which were stored before the index existed.
+//
+// With -twitter it copies the Twitter profiles to the table keyed by user ID
+// instead, and sets the Twitter user ID of the authorizations stored before
+// the IDs were recorded.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/dcb9/keymeshOAuth/db"
+)
+
+func main() {
+	networks := flag.String("networks", "", "comma separated network IDs to backfill")
+	twitter := flag.Bool("twitter", false, "migrate the Twitter profiles and user IDs")
+	flag.Parse()
+
+	if *networks == "" {
+		log.Fatal("-networks must be set")
+	}
+
+	if *twitter {
+		count, err := db.MigrateTwitterProfiles()
+		if err != nil {
+			log.Fatalf("twitter profiles: %s", err)
+		}
+		fmt.Printf("twitter profiles: %d profiles migrated\n", count)
+	}
+
+	for _, networkIDStr := range strings.Split(*networks, ",") {
+		networkID, err := strconv.Atoi(strings.TrimSpace(networkIDStr))
+		if err != nil {
+			log.Fatalf("invalid network ID %q: %s", networkIDStr, err)
+		}
+
+		if *twitter {
+			count, err := db.BackfillTwitterUserIDs(networkID)
+			if err != nil {
+				log.Fatalf("network %d: %s", networkID, err)
+			}
+			fmt.Printf("network %d: %d twitter user IDs backfilled\n", networkID, count)
+			continue
+		}
+
+		count, err := db.BackfillUsernameIndex(networkID)
+		if err != nil {
+			log.Fatalf("network %d: %s", networkID, err)
+		}
+		fmt.Printf("network %d: %d items backfilled\n", networkID, count)
+	}
+}
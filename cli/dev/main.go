@@ -9,19 +9,23 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/dcb9/keymeshOAuth/db"
 	"github.com/dcb9/keymeshOAuth/eth"
 	"github.com/dcb9/keymeshOAuth/proxy"
 	"github.com/rs/cors"
 )
 
 func main() {
+	if err := proxy.UseRandomSecrets(); err != nil {
+		log.Fatal(err)
+	}
+
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/oauth/twitter/authorize_url", twitterAuthorizeURLHandler)
-	mux.HandleFunc("/oauth/twitter/callback", twitterCallbackHandler)
-	mux.HandleFunc("/oauth/twitter/verify", requireNetworkID(twitterVerifyHandler))
+	mux.HandleFunc("/oauth/", oauthHandler)
 
 	mux.HandleFunc("/users/search", requireNetworkID(searchUsersHandler))
+	mux.HandleFunc("/users/history", requireNetworkID(getUserHistoryHandler))
 	mux.HandleFunc("/users", requireNetworkID(getUsersHandler))
 
 	mux.HandleFunc("/prekeys", requireNetworkID(PutPrekeysHandler))
@@ -30,6 +34,7 @@ func main() {
 
 	handler := cors.New(cors.Options{
 		AllowedMethods: []string{"GET", "PUT", "POST", "DELETE", "OPTIONS"},
+		ExposedHeaders: []string{proxy.NextCursorHeader},
 	}).Handler(mux)
 
 	err := http.ListenAndServe(":1235", handler)
@@ -57,6 +62,11 @@ func requireNetworkID(handler func(http.ResponseWriter, *http.Request)) http.Han
 			fmt.Fprint(w, err.Error())
 			return
 		}
+		if _, err = eth.LookupNetwork(networkID); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err.Error())
+			return
+		}
 
 		ctx := context.WithValue(r.Context(), "networkID", networkID)
 		r = r.WithContext(ctx)
@@ -105,6 +115,33 @@ func PutPrekeysHandler(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 }
 
+func getLimit(req *http.Request, defaultLimit int) (int, error) {
+	limitStr := req.Form.Get("limit")
+	if limitStr == "" {
+		return defaultLimit, nil
+	}
+	return strconv.Atoi(limitStr)
+}
+
+func writeUserInfoPage(w http.ResponseWriter, page *proxy.UserInfoPage, err error) {
+	if err == proxy.ErrInvalidCursor {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if page.NextCursor != "" {
+		w.Header().Set(proxy.NextCursorHeader, page.NextCursor)
+	}
+	bs, _ := json.Marshal(page.Users)
+	fmt.Fprint(w, string(bs))
+}
+
 func getUsersHandler(w http.ResponseWriter, req *http.Request) {
 	networkID := getNetworkID(req)
 	err := req.ParseForm()
@@ -114,29 +151,24 @@ func getUsersHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	limit, err := getLimit(req, 0)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	cursor := req.Form.Get("cursor")
+
 	username := req.Form.Get("username")
 	if username != "" {
-		userInfoList, err := proxy.HandleGetUserByUsername(username, networkID)
-		if err != nil {
-			fmt.Println("proxy.HandleGetUserByUsername:", err)
-			w.WriteHeader(http.StatusInternalServerError)
-		} else {
-			bs, _ := json.Marshal(userInfoList)
-			fmt.Fprint(w, string(bs))
-		}
+		page, err := proxy.HandleGetUserByUsername(username, networkID, limit, cursor)
+		writeUserInfoPage(w, page, err)
 		return
 	}
 
 	userAddress := req.Form.Get("userAddress")
 	if userAddress != "" {
-		userInfoList, err := proxy.HandleGetUserByUserAddress(userAddress, networkID)
-		if err != nil {
-			fmt.Println("proxy.HandleGetUserByUserAddress:", err)
-			w.WriteHeader(http.StatusInternalServerError)
-		} else {
-			bs, _ := json.Marshal(userInfoList)
-			fmt.Fprint(w, string(bs))
-		}
+		page, err := proxy.HandleGetUserByUserAddress(userAddress, networkID, limit, cursor)
+		writeUserInfoPage(w, page, err)
 		return
 	}
 
@@ -152,33 +184,93 @@ func searchUsersHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	usernamePrefix := req.Form.Get("usernamePrefix")
-	limitStr := req.Form.Get("limit")
-	limit := 10
-	if limitStr != "" {
-		limit, err = strconv.Atoi(limitStr)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
+	limit, err := getLimit(req, 10)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
+	usernamePrefix := req.Form.Get("usernamePrefix")
 	if usernamePrefix != "" {
-		userInfoList, err := proxy.HandleSearchUserByUsernamePrefix(usernamePrefix, networkID, limit)
-		if err != nil {
-			fmt.Println(err)
-		} else {
-			bs, _ := json.Marshal(userInfoList)
-			fmt.Fprint(w, string(bs))
-		}
+		page, err := proxy.HandleSearchUserByUsernamePrefix(usernamePrefix, networkID, limit, req.Form.Get("cursor"))
+		writeUserInfoPage(w, page, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusBadRequest)
 }
 
-func twitterAuthorizeURLHandler(w http.ResponseWriter, req *http.Request) {
-	loginURL, err := proxy.HandleTwitterLoginURL()
+func getUserHistoryHandler(w http.ResponseWriter, req *http.Request) {
+	limit, err := getLimit(req, proxy.MaxSearchLimit)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	userAddress := req.Form.Get("userAddress")
+	if userAddress == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	page, err := proxy.HandleGetUserHistory(userAddress, getNetworkID(req), limit, req.Form.Get("cursor"))
+	if err == proxy.ErrInvalidCursor {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if page.NextCursor != "" {
+		w.Header().Set(proxy.NextCursorHeader, page.NextCursor)
+	}
+	bs, _ := json.Marshal(page.Events)
+	fmt.Fprint(w, string(bs))
+}
+
+func oauthHandler(w http.ResponseWriter, req *http.Request) {
+	platformName, action, ok := proxy.ParseOAuthPath(req.URL.Path)
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	if _, err := proxy.LookupProvider(platformName); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+
+	switch action {
+	case "authorize_url":
+		authorizeURLHandler(w, req, platformName)
+	case "callback":
+		callbackHandler(w, req, platformName)
+	case "result":
+		loginResultHandler(w, req, platformName)
+	case "verify":
+		requireNetworkID(func(w http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodDelete {
+				revokeHandler(w, req, platformName)
+				return
+			}
+			verifyHandler(w, req, platformName)
+		})(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func authorizeURLHandler(w http.ResponseWriter, req *http.Request, platformName db.PlatformName) {
+	loginURL, err := proxy.HandleLoginURL(platformName, req)
+	if _, ok := err.(*proxy.LoginError); ok {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
 	if err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -187,18 +279,33 @@ func twitterAuthorizeURLHandler(w http.ResponseWriter, req *http.Request) {
 	fmt.Fprint(w, loginURL)
 }
 
-func twitterCallbackHandler(w http.ResponseWriter, req *http.Request) {
-	userBytes, err := proxy.HandleTwitterCallback(req)
+func callbackHandler(w http.ResponseWriter, req *http.Request, platformName db.PlatformName) {
+	resp, err := proxy.HandleCallback(platformName, req)
 	if err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	fmt.Fprint(w, string(userBytes))
+	for k, v := range resp.Headers {
+		w.Header().Set(k, v)
+	}
+	w.WriteHeader(resp.StatusCode)
+	fmt.Fprint(w, resp.Body)
 }
 
-func twitterVerifyHandler(w http.ResponseWriter, req *http.Request) {
+func loginResultHandler(w http.ResponseWriter, req *http.Request, platformName db.PlatformName) {
+	resultBytes, err := proxy.HandleLoginResult(platformName, req.URL.Query().Get("token"))
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	fmt.Fprint(w, string(resultBytes))
+}
+
+func verifyHandler(w http.ResponseWriter, req *http.Request, platformName db.PlatformName) {
 	networkID := getNetworkID(req)
 	err := req.ParseForm()
 	if err != nil {
@@ -215,11 +322,47 @@ func twitterVerifyHandler(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	err = proxy.HandleTwitterVerify(req.Form.Get("userAddress"), networkID, socialProof)
+	err = proxy.HandleVerify(platformName, req.Form.Get("userAddress"), networkID, socialProof)
+	if err == proxy.ErrRevokedByUser {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprint(w, err.Error())
+		return
+	}
 	if err != nil {
-		fmt.Println("proxy.HandleTwitterVerify error:", err.Error())
+		fmt.Println("proxy.HandleVerify error:", err.Error())
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	fmt.Fprint(w, "verified")
 }
+
+func revokeHandler(w http.ResponseWriter, req *http.Request, platformName db.PlatformName) {
+	issuedAt, err := strconv.ParseInt(req.Form.Get("issuedAt"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "issuedAt must be a Unix time")
+		return
+	}
+
+	err = proxy.HandleRevoke(platformName, req.Form.Get("userAddress"), getNetworkID(req), issuedAt, req.Form.Get("signature"))
+	switch err {
+	case nil:
+	case proxy.ErrInvalidRevokeSignature:
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, err.Error())
+		return
+	case proxy.ErrRevokeOutdated:
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprint(w, err.Error())
+		return
+	case db.ErrNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, err.Error())
+		return
+	default:
+		fmt.Println("proxy.HandleRevoke error:", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	fmt.Fprint(w, "revoked")
+}
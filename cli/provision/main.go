@@ -0,0 +1,76 @@
+// Command provision creates or updates the tables and indexes of the storage
+// backend configured by DB_BACKEND and DB_DSN, and reports the drift between
+// the provisioned schema and the expected one.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/eth"
+)
+
+func main() {
+	networks := flag.String("networks", "", "comma separated network IDs whose authorization tables are provisioned, defaults to the registered networks")
+	billingMode := flag.String("billing-mode", dynamodb.BillingModePayPerRequest, "DynamoDB billing mode, PAY_PER_REQUEST or PROVISIONED")
+	dryRun := flag.Bool("dry-run", false, "only report the drift, exits with 1 if there is any")
+	flag.Parse()
+
+	networkIDs, err := parseNetworkIDs(*networks)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := db.NewStore(os.Getenv("DB_BACKEND"), os.Getenv("DB_DSN"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	provisioner, ok := store.(db.Provisioner)
+	if !ok {
+		log.Fatalf("the %q backend has nothing to provision", os.Getenv("DB_BACKEND"))
+	}
+
+	drifts, err := provisioner.Provision(db.ProvisionOptions{
+		NetworkIDs:  networkIDs,
+		BillingMode: *billingMode,
+		DryRun:      *dryRun,
+	})
+	for _, drift := range drifts {
+		fmt.Println(drift)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(drifts) == 0 {
+		fmt.Println("no drift")
+	} else if *dryRun {
+		os.Exit(1)
+	}
+}
+
+func parseNetworkIDs(networks string) ([]int, error) {
+	if networks == "" {
+		return eth.NetworkIDs(), nil
+	}
+
+	networkIDs := make([]int, 0)
+	for _, networkIDStr := range strings.Split(networks, ",") {
+		networkID, err := strconv.Atoi(strings.TrimSpace(networkIDStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid network ID %q: %s", networkIDStr, err)
+		}
+		if _, err = eth.LookupNetwork(networkID); err != nil {
+			return nil, err
+		}
+		networkIDs = append(networkIDs, networkID)
+	}
+
+	return networkIDs, nil
+}
@@ -0,0 +1,131 @@
+// Command sweep checks again the verified proofs and revokes the ones which
+// are not valid anymore.
+//
+// In Lambda it is run by a schedule and configured by the environment:
+// SWEEP_MIN_AGE, SWEEP_TWITTER_INTERVAL and SWEEP_NETWORKS. It stops a
+// minute before the timeout of the function, the next runs resume with the
+// proofs which have not been checked for SWEEP_MIN_AGE.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/proxy"
+)
+
+// defaultMinAge is how often a proof is checked.
+const defaultMinAge = 24 * time.Hour
+
+// deadlineMargin is the time left to the Lambda function to record the last
+// check and report.
+const deadlineMargin = time.Minute
+
+func main() {
+	if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+		lambda.Start(lambdaHandler)
+		return
+	}
+
+	networks := flag.String("networks", "", "comma separated network IDs to sweep, all the registered networks if empty")
+	minAge := flag.Duration("min-age", defaultMinAge, "skip the proofs checked more recently")
+	twitterInterval := flag.Duration("twitter-interval", proxy.DefaultSweepIntervals[db.TwitterPlatformName], "minimum time between two Twitter API calls")
+	timeout := flag.Duration("timeout", 0, "stop the sweep after this time, 0 means no timeout")
+	dryRun := flag.Bool("dry-run", false, "check the proofs without revoking them")
+	flag.Parse()
+
+	networkIDs, err := parseNetworkIDs(*networks)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	options := proxy.SweepOptions{
+		NetworkIDs: networkIDs,
+		MinAge:     *minAge,
+		Intervals: map[db.PlatformName]time.Duration{
+			db.TwitterPlatformName: *twitterInterval,
+		},
+		DryRun: *dryRun,
+	}
+	if *timeout > 0 {
+		options.Deadline = time.Now().Add(*timeout)
+	}
+
+	report, err := proxy.SweepProofs(options)
+	if report != nil {
+		fmt.Printf("%d checked, %d revoked, %d errors\n", report.Checked, report.Revoked, report.Errors)
+		if report.Incomplete {
+			fmt.Println("the sweep stopped at its timeout")
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func lambdaHandler(ctx context.Context) (*proxy.SweepReport, error) {
+	networkIDs, err := parseNetworkIDs(os.Getenv("SWEEP_NETWORKS"))
+	if err != nil {
+		return nil, err
+	}
+	minAge, err := durationEnv("SWEEP_MIN_AGE", defaultMinAge)
+	if err != nil {
+		return nil, err
+	}
+	twitterInterval, err := durationEnv("SWEEP_TWITTER_INTERVAL", proxy.DefaultSweepIntervals[db.TwitterPlatformName])
+	if err != nil {
+		return nil, err
+	}
+
+	options := proxy.SweepOptions{
+		NetworkIDs: networkIDs,
+		MinAge:     minAge,
+		Intervals: map[db.PlatformName]time.Duration{
+			db.TwitterPlatformName: twitterInterval,
+		},
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		options.Deadline = deadline.Add(-deadlineMargin)
+	}
+
+	return proxy.SweepProofs(options)
+}
+
+func parseNetworkIDs(list string) ([]int, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	var networkIDs []int
+	for _, networkIDStr := range strings.Split(list, ",") {
+		networkID, err := strconv.Atoi(strings.TrimSpace(networkIDStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid network ID %q: %s", networkIDStr, err)
+		}
+		networkIDs = append(networkIDs, networkID)
+	}
+
+	return networkIDs, nil
+}
+
+func durationEnv(name string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", name, err)
+	}
+
+	return d, nil
+}
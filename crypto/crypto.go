@@ -1,31 +1,147 @@
 package crypto
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
-func VerifySig(from, sigHex string, msg []byte) bool {
+// SignatureError is a rejected signature, Reason is a stable code.
+type SignatureError struct {
+	Reason  string
+	Message string
+}
+
+func (e *SignatureError) Error() string {
+	return e.Message
+}
+
+// Signature errors, the typed data which can not be hashed are rejected with
+// the "malformed_typed_data" reason.
+var (
+	ErrMalformedSignature = &SignatureError{"malformed_signature", "crypto: the signature is not hex encoded"}
+	ErrSignatureLength    = &SignatureError{"signature_length", "crypto: the signature must be 64 or 65 bytes long"}
+	ErrInvalidRecoveryID  = &SignatureError{"invalid_recovery_id", "crypto: the recovery ID of the signature is invalid"}
+	ErrInvalidAddress     = &SignatureError{"invalid_address", "crypto: the signer is not an address"}
+	ErrAddressMismatch    = &SignatureError{"address_mismatch", "crypto: the signature was not made by the address"}
+)
+
+// Verification is the result of an accepted signature.
+type Verification struct {
+	// Signer is the address the signature was made by.
+	Signer common.Address
+	// Contract is set if the signer is a contract wallet which accepted the
+	// signature with ERC-1271, the signature was not recovered.
+	Contract bool
+}
+
+// VerifyMessage checks that sigHex is the personal_sign signature of msg by
+// from, see VerifyHash.
+func VerifyMessage(caller bind.ContractCaller, from, sigHex string, msg []byte) (*Verification, error) {
+	return VerifyHash(caller, from, sigHex, signHash(msg))
+}
+
+// VerifyTypedData checks that sigHex is the eth_signTypedData_v4 signature of
+// the typed data by from, see VerifyHash.
+func VerifyTypedData(caller bind.ContractCaller, from, sigHex string, td TypedData) (*Verification, error) {
+	hash, err := td.Hash()
+	if err != nil {
+		return nil, &SignatureError{"malformed_typed_data", "crypto: " + err.Error()}
+	}
+
+	return VerifyHash(caller, from, sigHex, hash)
+}
+
+// VerifyHash checks that sigHex is a signature of hash by from. The rejected
+// signatures return a *SignatureError. When the signature can not be
+// recovered to from, from is asked as a contract wallet through caller unless
+// it is nil, the other errors are returned when the wallet could not be asked.
+func VerifyHash(caller bind.ContractCaller, from, sigHex string, hash []byte) (*Verification, error) {
+	if !common.IsHexAddress(from) {
+		return nil, ErrInvalidAddress
+	}
 	fromAddr := common.HexToAddress(from)
 
-	sig := hexutil.MustDecode(sigHex)
-	// https://github.com/ethereum/go-ethereum/blob/55599ee95d4151a2502465e0afc7c47bd1acba77/internal/ethapi/api.go#L442
-	if sig[64] != 27 && sig[64] != 28 {
-		return false
+	sig, err := hexutil.Decode(sigHex)
+	if err != nil {
+		return nil, ErrMalformedSignature
 	}
-	sig[64] -= 27
 
-	pubKey, err := crypto.SigToPub(signHash(msg), sig)
+	signer, recoverErr := RecoverAddress(hash, sig)
+	if recoverErr == nil && signer == fromAddr {
+		return &Verification{Signer: signer}, nil
+	}
+	if recoverErr == nil {
+		recoverErr = ErrAddressMismatch
+	}
+	if caller == nil {
+		return nil, recoverErr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), contractCallTimeout)
+	defer cancel()
+
+	valid, err := IsValidSignature(ctx, caller, fromAddr, hash, sig)
 	if err != nil {
-		return false
+		return nil, err
+	}
+	if !valid {
+		return nil, recoverErr
 	}
 
-	recoveredAddr := crypto.PubkeyToAddress(*pubKey)
+	return &Verification{Signer: fromAddr, Contract: true}, nil
+}
+
+// RecoverAddress returns the address which signed hash. The signature is
+// either [R || S || V] where V is 27/28, 0/1 or an EIP-155 value, or the
+// compact [R || yParity and S] of EIP-2098.
+func RecoverAddress(hash []byte, sig []byte) (common.Address, error) {
+	normalized, err := normalizeSignature(sig)
+	if err != nil {
+		return common.Address{}, err
+	}
 
-	return fromAddr == recoveredAddr
+	pubKey, err := crypto.SigToPub(hash, normalized)
+	if err != nil {
+		return common.Address{}, ErrAddressMismatch
+	}
+
+	return crypto.PubkeyToAddress(*pubKey), nil
+}
+
+// normalizeSignature returns the [R || S || V] signature with V 0 or 1 which
+// is expected by SigToPub.
+func normalizeSignature(sig []byte) ([]byte, error) {
+	normalized := make([]byte, 65)
+	switch len(sig) {
+	case 65:
+		copy(normalized, sig)
+		v := sig[64]
+		switch {
+		case v == 0 || v == 1:
+		case v == 27 || v == 28:
+			v -= 27
+		case v >= 35:
+			// EIP-155, v = chainID * 2 + 35 + yParity
+			v = (v - 35) % 2
+		default:
+			return nil, ErrInvalidRecoveryID
+		}
+		normalized[64] = v
+	case 64:
+		// EIP-2098, the top bit of S is yParity
+		copy(normalized, sig)
+		normalized[64] = sig[32] >> 7
+		normalized[32] &= 0x7f
+	default:
+		return nil, ErrSignatureLength
+	}
+
+	return normalized, nil
 }
 
 // https://github.com/ethereum/go-ethereum/blob/55599ee95d4151a2502465e0afc7c47bd1acba77/internal/ethapi/api.go#L404
@@ -33,7 +149,8 @@ func VerifySig(from, sigHex string, msg []byte) bool {
 // safely used to calculate a signature from.
 //
 // The hash is calculated as
-//   keccak256("\x19Ethereum Signed Message:\n"${message length}${message}).
+//
+//	keccak256("\x19Ethereum Signed Message:\n"${message length}${message}).
 //
 // This gives context to the signed message and prevents signing of transactions.
 func signHash(data []byte) []byte {
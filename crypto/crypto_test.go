@@ -0,0 +1,93 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestVerifyMessage(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []byte("I am alice on twitter")
+	sig, err := crypto.Sign(signHash(msg), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSig, err := crypto.Sign(signHash(msg), other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// withV returns the signature with v replaced
+	withV := func(v byte) string {
+		s := make([]byte, 65)
+		copy(s, sig)
+		s[64] = v
+		return hexutil.Encode(s)
+	}
+	// the compact signature of EIP-2098 keeps yParity in the top bit of S
+	compact := make([]byte, 64)
+	copy(compact, sig)
+	compact[32] |= sig[64] << 7
+
+	tests := []struct {
+		name string
+		from string
+		sig  string
+		msg  string
+		err  error
+	}{
+		{"v of 0/1", from.Hex(), withV(sig[64]), string(msg), nil},
+		{"v of 27/28", from.Hex(), withV(sig[64] + 27), string(msg), nil},
+		{"EIP-155 v of mainnet", from.Hex(), withV(sig[64] + 37), string(msg), nil},
+		{"EIP-155 v of ropsten", from.Hex(), withV(sig[64] + 41), string(msg), nil},
+		{"compact", from.Hex(), hexutil.Encode(compact), string(msg), nil},
+		{"lowercase address", hexutil.Encode(from.Bytes()), withV(sig[64] + 27), string(msg), nil},
+		{"v of 2", from.Hex(), withV(2), string(msg), ErrInvalidRecoveryID},
+		{"v of 29", from.Hex(), withV(29), string(msg), ErrInvalidRecoveryID},
+		{"short", from.Hex(), hexutil.Encode(sig[:63]), string(msg), ErrSignatureLength},
+		{"long", from.Hex(), hexutil.Encode(append(sig[:65:65], 0)), string(msg), ErrSignatureLength},
+		{"not hex", from.Hex(), "0xzz", string(msg), ErrMalformedSignature},
+		{"no prefix", from.Hex(), hexutil.Encode(sig)[2:], string(msg), ErrMalformedSignature},
+		{"invalid address", "alice", withV(sig[64] + 27), string(msg), ErrInvalidAddress},
+		{"other signer", from.Hex(), hexutil.Encode(otherSig), string(msg), ErrAddressMismatch},
+		{"other message", from.Hex(), withV(sig[64] + 27), "I am bob on twitter", ErrAddressMismatch},
+	}
+
+	for _, test := range tests {
+		verification, err := VerifyMessage(nil, test.from, test.sig, []byte(test.msg))
+		if err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if err == nil && (verification.Signer != from || verification.Contract) {
+			t.Errorf("%s: got %+v", test.name, verification)
+		}
+	}
+}
+
+func TestSignatureErrorReasons(t *testing.T) {
+	reasons := map[*SignatureError]string{
+		ErrMalformedSignature: "malformed_signature",
+		ErrSignatureLength:    "signature_length",
+		ErrInvalidRecoveryID:  "invalid_recovery_id",
+		ErrInvalidAddress:     "invalid_address",
+		ErrAddressMismatch:    "address_mismatch",
+	}
+
+	for err, reason := range reasons {
+		if err.Reason != reason {
+			t.Errorf("%v: got reason %s, want %s", err, err.Reason, reason)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// erc1271MagicValue is the selector of isValidSignature(bytes32,bytes), which
+// the contract wallets return for the valid signatures.
+var erc1271MagicValue = []byte{0x16, 0x26, 0xba, 0x7e}
+
+// contractCallTimeout bounds the calls of the contract wallets.
+const contractCallTimeout = 10 * time.Second
+
+// revertErrorCode is the JSON-RPC error code of the calls which revert with
+// data.
+const revertErrorCode = 3
+
+// IsValidSignature asks the contract wallet whether sig is a valid signature
+// of hash, as defined by ERC-1271. The accounts without code are not contract
+// wallets, and a call which reverts is an invalid signature since some
+// wallets revert instead of returning. The other errors are returned, the
+// node could not tell.
+func IsValidSignature(ctx context.Context, caller bind.ContractCaller, wallet common.Address, hash []byte, sig []byte) (bool, error) {
+	code, err := caller.CodeAt(ctx, wallet, nil)
+	if err != nil {
+		return false, err
+	}
+	if len(code) == 0 {
+		return false, nil
+	}
+
+	output, err := caller.CallContract(ctx, ethereum.CallMsg{
+		To:   &wallet,
+		Data: encodeIsValidSignature(hash, sig),
+	}, nil)
+	if isRevert(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return len(output) >= 32 && bytes.Equal(output[:4], erc1271MagicValue), nil
+}
+
+// isRevert reports whether err is a call which reverted, as returned by the
+// nodes with or without the revert data and by the simulated backend.
+func isRevert(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, vm.ErrExecutionReverted) {
+		return true
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == revertErrorCode {
+		return true
+	}
+
+	return strings.HasPrefix(err.Error(), vm.ErrExecutionReverted.Error())
+}
+
+// encodeIsValidSignature returns the ABI encoded call of
+// isValidSignature(bytes32 hash, bytes sig).
+func encodeIsValidSignature(hash []byte, sig []byte) []byte {
+	var data bytes.Buffer
+	data.Write(erc1271MagicValue)
+	data.Write(common.LeftPadBytes(hash, 32))
+	// offset of sig in the arguments
+	data.Write(common.LeftPadBytes([]byte{0x40}, 32))
+	data.Write(common.LeftPadBytes(big.NewInt(int64(len(sig))).Bytes(), 32))
+	data.Write(sig)
+	if rest := len(sig) % 32; rest != 0 {
+		data.Write(make([]byte, 32-rest))
+	}
+
+	return data.Bytes()
+}
@@ -0,0 +1,133 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// stubWallet is a node serving a contract wallet whose isValidSignature
+// calls return output or fail with err.
+type stubWallet struct {
+	code   []byte
+	output []byte
+	err    error
+	calls  [][]byte
+}
+
+func (w *stubWallet) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return w.code, nil
+}
+
+func (w *stubWallet) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	w.calls = append(w.calls, call.Data)
+	return w.output, w.err
+}
+
+// rpcError is an error answered by a JSON-RPC node.
+type rpcError struct {
+	code    int
+	message string
+}
+
+func (e *rpcError) Error() string {
+	return e.message
+}
+
+func (e *rpcError) ErrorCode() int {
+	return e.code
+}
+
+func TestIsValidSignature(t *testing.T) {
+	wallet := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	hash := crypto.Keccak256([]byte("hello"))
+	sig := bytes.Repeat([]byte{1}, 130)
+	magic := common.RightPadBytes(erc1271MagicValue, 32)
+	transportErr := errors.New("dial tcp: connection refused")
+	// a node which can not answer is not a revert
+	nodeErr := &rpcError{-32000, "header not found"}
+
+	tests := []struct {
+		name   string
+		wallet *stubWallet
+		valid  bool
+		err    error
+	}{
+		{"magic value", &stubWallet{code: []byte{1}, output: magic}, true, nil},
+		{"wrong value", &stubWallet{code: []byte{1}, output: make([]byte, 32)}, false, nil},
+		{"short output", &stubWallet{code: []byte{1}, output: erc1271MagicValue}, false, nil},
+		{"no code", &stubWallet{output: magic}, false, nil},
+		{"revert", &stubWallet{code: []byte{1}, err: vm.ErrExecutionReverted}, false, nil},
+		{"revert with data", &stubWallet{code: []byte{1}, err: &rpcError{3, "execution reverted: invalid signature"}}, false, nil},
+		{"revert with reason", &stubWallet{code: []byte{1}, err: errors.New("execution reverted: invalid signature")}, false, nil},
+		{"node error", &stubWallet{code: []byte{1}, err: nodeErr}, false, nodeErr},
+		{"transport error", &stubWallet{code: []byte{1}, err: transportErr}, false, transportErr},
+	}
+	for _, test := range tests {
+		valid, err := IsValidSignature(context.Background(), test.wallet, wallet, hash, sig)
+		if valid != test.valid || err != test.err {
+			t.Errorf("%s: got %v, %v, want %v, %v", test.name, valid, err, test.valid, test.err)
+		}
+	}
+
+	w := &stubWallet{code: []byte{1}, output: magic}
+	IsValidSignature(context.Background(), w, wallet, hash, sig)
+	if len(w.calls) != 1 || !bytes.Equal(w.calls[0], encodeIsValidSignature(hash, sig)) {
+		t.Errorf("got calls %x", w.calls)
+	}
+}
+
+func TestEncodeIsValidSignature(t *testing.T) {
+	hash := bytes.Repeat([]byte{0xff}, 32)
+	data := encodeIsValidSignature(hash, []byte{1, 2, 3})
+
+	want := "1626ba7e" +
+		strings.Repeat("ff", 32) +
+		fmt.Sprintf("%064x", 0x40) +
+		fmt.Sprintf("%064x", 3) +
+		"010203" + strings.Repeat("00", 29)
+	if hexutil.Encode(data) != "0x"+want {
+		t.Errorf("got %x", data)
+	}
+}
+
+func TestVerifyHashAsksContractWallets(t *testing.T) {
+	from := "0x00000000000000000000000000000000000000aa"
+	hash := crypto.Keccak256([]byte("hello"))
+	// a multisig signature of two owners
+	sigHex := hexutil.Encode(bytes.Repeat([]byte{1}, 130))
+	magic := common.RightPadBytes(erc1271MagicValue, 32)
+
+	verification, err := VerifyHash(&stubWallet{code: []byte{1}, output: magic}, from, sigHex, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verification.Contract || verification.Signer != common.HexToAddress(from) {
+		t.Errorf("got %+v", verification)
+	}
+
+	// the signatures which can not be recovered are rejected without a wallet
+	if _, err = VerifyHash(nil, from, sigHex, hash); err != ErrSignatureLength {
+		t.Errorf("got %v without a caller, want ErrSignatureLength", err)
+	}
+	if _, err = VerifyHash(&stubWallet{code: []byte{1}, err: vm.ErrExecutionReverted}, from, sigHex, hash); err != ErrSignatureLength {
+		t.Errorf("got %v for a revert, want ErrSignatureLength", err)
+	}
+
+	// the wallets which could not be asked are not a rejection
+	transportErr := errors.New("dial tcp: connection refused")
+	_, err = VerifyHash(&stubWallet{code: []byte{1}, err: transportErr}, from, sigHex, hash)
+	if err != transportErr {
+		t.Errorf("got %v, want the transport error", err)
+	}
+}
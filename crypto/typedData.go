@@ -0,0 +1,52 @@
+package crypto
+
+import (
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// The EIP-712 domain of the KeyMesh signatures, the chain ID is the one of
+// the network the signature is for.
+const (
+	DomainName    = "KeyMesh"
+	DomainVersion = "1"
+)
+
+// TypedDataField is a member of a struct type.
+type TypedDataField = apitypes.Type
+
+// TypedData is the argument of eth_signTypedData_v4, Types must hold the
+// EIP712Domain type and the ones of the message. The integers of the
+// message are *big.Int, float64 or decimal and hex strings.
+type TypedData apitypes.TypedData
+
+var domainFields = []TypedDataField{
+	{Name: "name", Type: "string"},
+	{Name: "version", Type: "string"},
+	{Name: "chainId", Type: "uint256"},
+}
+
+// NewTypedData returns the message of the primary type in the KeyMesh domain
+// of the chain.
+func NewTypedData(chainID int64, primaryType string, fields []TypedDataField, message map[string]interface{}) TypedData {
+	return TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": domainFields,
+			primaryType:    fields,
+		},
+		PrimaryType: primaryType,
+		Domain: apitypes.TypedDataDomain{
+			Name:    DomainName,
+			Version: DomainVersion,
+			ChainId: math.NewHexOrDecimal256(chainID),
+		},
+		Message: message,
+	}
+}
+
+// Hash returns the hash signed by eth_signTypedData_v4,
+// keccak256("\x19\x01" ‖ domainSeparator ‖ hashStruct(message)).
+func (td TypedData) Hash() ([]byte, error) {
+	hash, _, err := apitypes.TypedDataAndHash(apitypes.TypedData(td))
+	return hash, err
+}
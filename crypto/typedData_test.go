@@ -0,0 +1,156 @@
+package crypto
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// etherMailDomain is the domain of the examples of EIP-712.
+var etherMailDomain = apitypes.TypedDataDomain{
+	Name:              "Ether Mail",
+	Version:           "1",
+	ChainId:           math.NewHexOrDecimal256(1),
+	VerifyingContract: "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC",
+}
+
+var etherMailDomainFields = []TypedDataField{
+	{Name: "name", Type: "string"},
+	{Name: "version", Type: "string"},
+	{Name: "chainId", Type: "uint256"},
+	{Name: "verifyingContract", Type: "address"},
+}
+
+func TestTypedDataHash(t *testing.T) {
+	// the Mail example of EIP-712
+	td := TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": etherMailDomainFields,
+			"Person": {
+				{Name: "name", Type: "string"},
+				{Name: "wallet", Type: "address"},
+			},
+			"Mail": {
+				{Name: "from", Type: "Person"},
+				{Name: "to", Type: "Person"},
+				{Name: "contents", Type: "string"},
+			},
+		},
+		PrimaryType: "Mail",
+		Domain:      etherMailDomain,
+		Message: map[string]interface{}{
+			"from": map[string]interface{}{
+				"name":   "Cow",
+				"wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826",
+			},
+			"to": map[string]interface{}{
+				"name":   "Bob",
+				"wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB",
+			},
+			"contents": "Hello, Bob!",
+		},
+	}
+
+	hash, err := td.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hexutil.Encode(hash); got != "0xbe609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2" {
+		t.Errorf("got hash %s", got)
+	}
+}
+
+func TestVerifyTypedDataOfWallet(t *testing.T) {
+	// the eth_signTypedData_v4 example of MetaMask's eth-sig-util, signed by
+	// the key keccak256("cow") of the address of Cow. Its types nest structs
+	// in arrays.
+	from := "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"
+	sig := "0x65cbd956f2fae28a601bebc9b906cea0191744bd4c4247bcd27cd08f8eb6b71c78efdf7a31dc9abee78f492292721f362d296cf86b4538e07b51303b67f749061b"
+	td := TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": etherMailDomainFields,
+			"Person": {
+				{Name: "name", Type: "string"},
+				{Name: "wallets", Type: "address[]"},
+			},
+			"Mail": {
+				{Name: "from", Type: "Person"},
+				{Name: "to", Type: "Person[]"},
+				{Name: "contents", Type: "string"},
+			},
+			"Group": {
+				{Name: "name", Type: "string"},
+				{Name: "members", Type: "Person[]"},
+			},
+		},
+		PrimaryType: "Mail",
+		Domain:      etherMailDomain,
+		Message: map[string]interface{}{
+			"from": map[string]interface{}{
+				"name": "Cow",
+				"wallets": []interface{}{
+					"0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826",
+					"0xDeaDbeefdEAdbeefdEadbEEFdeadbeEFdEaDbeeF",
+				},
+			},
+			"to": []interface{}{
+				map[string]interface{}{
+					"name": "Bob",
+					"wallets": []interface{}{
+						"0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB",
+						"0xB0BdaBea57B0BDABeA57b0bdABEA57b0BDabEa57",
+						"0xB0B0b0b0b0b0B000000000000000000000000000",
+					},
+				},
+			},
+			"contents": "Hello, Bob!",
+		},
+	}
+
+	hash, err := td.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hexutil.Encode(hash); got != "0xa85c2e2b118698e88db68a8105b794a8cc7cec074e89ef991cb4f5f533819cc2" {
+		t.Errorf("got hash %s", got)
+	}
+	if _, err = VerifyTypedData(nil, from, sig, td); err != nil {
+		t.Errorf("got %v for the signature of the wallet", err)
+	}
+
+	// a wallet of a member of the array changed
+	bob := td.Message["to"].([]interface{})[0].(map[string]interface{})
+	bob["wallets"].([]interface{})[2] = "0xB0B0b0b0b0b0B000000000000000000000000001"
+	if _, err = VerifyTypedData(nil, from, sig, td); err != ErrAddressMismatch {
+		t.Errorf("got %v, want ErrAddressMismatch", err)
+	}
+}
+
+func TestVerifyTypedDataMalformed(t *testing.T) {
+	fields := []TypedDataField{
+		{Name: "platform", Type: "string"},
+		{Name: "issuedAt", Type: "uint256"},
+	}
+
+	tests := []struct {
+		name    string
+		message map[string]interface{}
+	}{
+		{"missing member", map[string]interface{}{"platform": "github"}},
+		{"extra member", map[string]interface{}{"platform": "github", "issuedAt": big.NewInt(1), "nonce": "1"}},
+		{"negative uint", map[string]interface{}{"platform": "github", "issuedAt": big.NewInt(-1)}},
+		{"not a string", map[string]interface{}{"platform": 1.0, "issuedAt": big.NewInt(1)}},
+	}
+
+	sig := hexutil.Encode(make([]byte, 65))
+	for _, test := range tests {
+		td := NewTypedData(1, "LoginStart", fields, test.message)
+		_, err := VerifyTypedData(nil, "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826", sig, td)
+		if sigErr, ok := err.(*SignatureError); !ok || sigErr.Reason != "malformed_typed_data" {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+	}
+}
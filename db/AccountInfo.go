@@ -1,12 +1,10 @@
 package db
 
 import (
-	"fmt"
 	"os"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 var accountTableName = os.Getenv("ACCOUNT_TABLE_NAME")
@@ -22,39 +20,17 @@ type AccountInfo struct {
 	CreatedAt   time.Time `json:"createdAt"`
 }
 
-func PutAccountInfo(info AccountInfo) (*dynamodb.PutItemOutput, error) {
-	return putItem(info, aws.String(accountTableName))
+type accountInfoTable struct{}
+
+func (accountInfoTable) PutAccountInfo(info AccountInfo) error {
+	_, err := putItem(info, aws.String(accountTableName))
+	return err
 }
 
-func tryToCreateAccountTable() {
-	input := &dynamodb.CreateTableInput{
-		TableName: aws.String(accountTableName),
-		AttributeDefinitions: []*dynamodb.AttributeDefinition{
-			{
-				AttributeName: aws.String("email"),
-				AttributeType: aws.String("S"),
-			},
-			{
-				AttributeName: aws.String("userAddress"),
-				AttributeType: aws.String("S"),
-			},
-		},
-		KeySchema: []*dynamodb.KeySchemaElement{
-			{
-				AttributeName: aws.String("email"),
-				KeyType:       aws.String("HASH"),
-			},
-			{
-				AttributeName: aws.String("userAddress"),
-				KeyType:       aws.String("RANGE"),
-			},
-		},
-		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-			ReadCapacityUnits:  aws.Int64(5),
-			WriteCapacityUnits: aws.Int64(5),
-		},
+func accountTableSpec() dynamoDBTableSpec {
+	return dynamoDBTableSpec{
+		name:       accountTableName,
+		attributes: stringAttributes("email", "userAddress"),
+		keySchema:  keySchema("email", "userAddress"),
 	}
-	output, err := conn.CreateTable(input)
-	fmt.Println(output)
-	fmt.Println(err)
 }
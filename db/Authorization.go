@@ -3,11 +3,13 @@ package db
 import (
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 )
 
 var (
@@ -21,15 +23,171 @@ type AuthorizationItem struct {
 	PlatformName PlatformName `json:"platformName"`
 	Username     string       `json:"username"`
 	ProofURL     string       `json:"proofURL"`
-	Verified     bool         `json:"verified"`
-	VerifiedAt   time.Time    `json:"verified_at"`
+	// Status is the state of the proof, see StatusAt. Verified is kept in sync
+	// with it for the readers which predate it.
+	Status     AuthorizationStatus `json:"status,omitempty"`
+	Verified   bool                `json:"verified"`
+	VerifiedAt time.Time           `json:"verified_at"`
+	// FailureReason is the reason why the last check of the proof failed.
+	FailureReason string    `json:"failureReason,omitempty"`
+	CheckedAt     time.Time `json:"checkedAt"`
+	// Attempts is the number of checks which rejected the proof in a row.
+	Attempts int `json:"attempts,omitempty"`
+	// ProofPayload is the claim and the signature found by the last check.
+	ProofPayload string `json:"proofPayload,omitempty"`
+	// UserID is the ID of the account on the platform the address logged in
+	// with, the proofs are only accepted for that account.
+	UserID   string    `json:"userID,omitempty"`
+	LinkedAt time.Time `json:"linkedAt"`
+	// RevokedAt is when a verified proof was found to be gone by the sweep,
+	// FailureReason is why.
+	RevokedAt time.Time `json:"revokedAt"`
+}
+
+// AuthorizationStatus is the state of the proof of an authorization.
+type AuthorizationStatus string
+
+const (
+	// StatusPending is an account linked by a login whose proof has not been
+	// checked yet.
+	StatusPending AuthorizationStatus = "pending"
+	// StatusVerified is a proof which was accepted.
+	StatusVerified AuthorizationStatus = "verified"
+	// StatusFailed is a proof which was rejected before it was ever
+	// verified.
+	StatusFailed AuthorizationStatus = "failed"
+	// StatusRevoked is a verified proof which was found to be invalid since.
+	StatusRevoked AuthorizationStatus = "revoked"
+	// StatusExpired is an account linked more than PendingTTL ago whose proof
+	// was never checked.
+	StatusExpired AuthorizationStatus = "expired"
+)
+
+// PendingTTL is how long a linked account waits for its proof.
+const PendingTTL = 7 * 24 * time.Hour
+
+// StatusAt returns the state of the proof at now. The items stored before the
+// statuses existed have none, their state is read from the other fields so
+// that the verified ones stay verified.
+func (item *AuthorizationItem) StatusAt(now time.Time) AuthorizationStatus {
+	status := item.Status
+	if status == "" {
+		switch {
+		case item.Verified:
+			status = StatusVerified
+		case !item.RevokedAt.IsZero():
+			status = StatusRevoked
+		case item.FailureReason != "":
+			status = StatusFailed
+		default:
+			status = StatusPending
+		}
+	}
+
+	if status == StatusPending && !item.LinkedAt.IsZero() && now.Sub(item.LinkedAt) > PendingTTL {
+		return StatusExpired
+	}
+
+	return status
+}
+
+// MarkVerified records that the proof was accepted at.
+func (item *AuthorizationItem) MarkVerified(at time.Time, payload string) {
+	item.Status = StatusVerified
+	item.Verified = true
+	item.VerifiedAt = at
+	item.MarkChecked(at, payload)
+}
+
+// MarkChecked records that a verified proof was found to be still valid.
+func (item *AuthorizationItem) MarkChecked(at time.Time, payload string) {
+	item.CheckedAt = at
+	item.FailureReason = ""
+	item.Attempts = 0
+	item.ProofPayload = payload
+}
+
+// MarkFailed records that the proof was rejected for reason.
+func (item *AuthorizationItem) MarkFailed(at time.Time, reason string, payload string) {
+	item.Status = StatusFailed
+	item.Verified = false
+	item.CheckedAt = at
+	item.FailureReason = reason
+	item.Attempts++
+	item.ProofPayload = payload
+}
+
+// MarkRevoked records that the verified proof is not valid anymore.
+func (item *AuthorizationItem) MarkRevoked(at time.Time, reason string, payload string) {
+	item.MarkFailed(at, reason, payload)
+	item.Status = StatusRevoked
+	item.RevokedAt = at
+}
+
+// RevokedByUserReason is the FailureReason of the authorizations revoked by
+// their address.
+const RevokedByUserReason = "revoked_by_user"
+
+// MarkRevokedByUser records that the address unlinked the account, the
+// account and the proof are kept.
+func (item *AuthorizationItem) MarkRevokedByUser(at time.Time) {
+	item.Status = StatusRevoked
+	item.Verified = false
+	item.FailureReason = RevokedByUserReason
+	item.RevokedAt = at
+}
+
+// RevokedByUser reports whether the address unlinked the account, only a new
+// link through a login lifts it.
+func (item *AuthorizationItem) RevokedByUser() bool {
+	return item.FailureReason == RevokedByUserReason
+}
+
+// usernameIndexName is the global secondary index used to look up the
+// authorizations by username. Its hash key is the first character of the
+// normalized username so that both exact and prefix lookups can be served by a
+// single Query. That spreads the index over a few dozen partitions at most and
+// the common first letters are hot, the key must become a longer prefix or a
+// sharded bucket once a partition outgrows its throughput.
+const usernameIndexName = "usernameIndex"
+
+// authorizationRecord is how an AuthorizationItem is stored in DynamoDB.
+type authorizationRecord struct {
+	AuthorizationItem
+	UsernameHead       string `json:"usernameHead,omitempty"`
+	UsernameNormalized string `json:"usernameNormalized,omitempty"`
+}
+
+func newAuthorizationRecord(item AuthorizationItem) authorizationRecord {
+	normalized := NormalizeUsername(item.Username)
+	return authorizationRecord{
+		AuthorizationItem:  item,
+		UsernameHead:       usernameHead(normalized),
+		UsernameNormalized: normalized,
+	}
+}
+
+// NormalizeUsername returns the form of username which is used for lookups,
+// usernames are case insensitive on all the supported platforms.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func usernameHead(normalized string) string {
+	for _, r := range normalized {
+		return string(r)
+	}
+	return ""
 }
 
 type AuthorizationTable struct {
 	networkID int
+
+	mutex    sync.Mutex
+	verified bool
 }
 
-func GetAuthorizationTable(networkID int) *AuthorizationTable {
+func getAuthorizationTable(networkID int) *AuthorizationTable {
 	rwmutex.RLock()
 	table, ok := authorizationTables[networkID]
 	rwmutex.RUnlock()
@@ -37,7 +195,6 @@ func GetAuthorizationTable(networkID int) *AuthorizationTable {
 		table = &AuthorizationTable{
 			networkID: networkID,
 		}
-		table.init()
 
 		rwmutex.Lock()
 		authorizationTables[networkID] = table
@@ -47,79 +204,256 @@ func GetAuthorizationTable(networkID int) *AuthorizationTable {
 	return table
 }
 
-func (at *AuthorizationTable) init() {
-	at.tryToCreateAuthorizationTable()
+// verify checks that the table has been provisioned the first time it is
+// used.
+func (at *AuthorizationTable) verify() error {
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+
+	if at.verified {
+		return nil
+	}
+	if err := verifyDynamoDBTable(aws.StringValue(at.getAuthorizationTableName())); err != nil {
+		return err
+	}
+	at.verified = true
+
+	return nil
+}
+
+func (at *AuthorizationTable) PutAuthorizationItem(item AuthorizationItem) error {
+	if err := at.verify(); err != nil {
+		return err
+	}
+
+	_, err := putItem(newAuthorizationRecord(item), at.getAuthorizationTableName())
+	return err
 }
 
-func (at *AuthorizationTable) PutAuthorizationItem(item AuthorizationItem) (*dynamodb.PutItemOutput, error) {
-	return putItem(item, at.getAuthorizationTableName())
+func (at *AuthorizationTable) GetAuthorizationItem(userAddress string, platformName PlatformName) (*AuthorizationItem, error) {
+	if err := at.verify(); err != nil {
+		return nil, err
+	}
+
+	key := map[string]string{
+		"userAddress":  userAddress,
+		"platformName": string(platformName),
+	}
+	output, err := getItem(key, at.getAuthorizationTableName())
+	if err != nil {
+		return nil, err
+	}
+	if output.Item == nil {
+		return nil, ErrNotFound
+	}
+
+	var item AuthorizationItem
+	err = dynamodbattribute.UnmarshalMap(output.Item, &item)
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
 }
 
-func (at *AuthorizationTable) GetAuthorizationItemByUserAddress(userAddress *string) (*dynamodb.QueryOutput, error) {
+func (at *AuthorizationTable) GetAuthorizationItemsByUserAddress(userAddress string, limit int, after string) ([]AuthorizationItem, string, error) {
 	input := &dynamodb.QueryInput{
 		TableName:              at.getAuthorizationTableName(),
 		KeyConditionExpression: aws.String("userAddress = :userAddress"),
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 			":userAddress": &dynamodb.AttributeValue{
-				S: userAddress,
+				S: aws.String(userAddress),
 			},
 		},
 	}
-	return conn.Query(input)
+
+	return at.query(input, limit, after)
 }
 
-func (at *AuthorizationTable) ScanUsername(username string) (*dynamodb.ScanOutput, error) {
-	return at.scanUsername(username, aws.String("username = :username"))
+func (at *AuthorizationTable) GetAuthorizationItemsByUsername(username string, limit int, after string) ([]AuthorizationItem, string, error) {
+	return at.queryUsername(username, "usernameNormalized = :username", limit, after)
 }
 
-func (at *AuthorizationTable) ScanUsernamePrefix(usernamePrefix string) (*dynamodb.ScanOutput, error) {
-	return at.scanUsername(usernamePrefix, aws.String("begins_with(username, :username)"))
+func (at *AuthorizationTable) GetAuthorizationItemsByUsernamePrefix(usernamePrefix string, limit int, after string) ([]AuthorizationItem, string, error) {
+	return at.queryUsername(usernamePrefix, "begins_with(usernameNormalized, :username)", limit, after)
 }
 
-func (at *AuthorizationTable) scanUsername(username string, filterExpression *string) (*dynamodb.ScanOutput, error) {
-	input := &dynamodb.ScanInput{
+func (at *AuthorizationTable) queryUsername(username string, keyCondition string, limit int, after string) ([]AuthorizationItem, string, error) {
+	normalized := NormalizeUsername(username)
+	if normalized == "" {
+		return []AuthorizationItem{}, "", nil
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              at.getAuthorizationTableName(),
+		IndexName:              aws.String(usernameIndexName),
+		KeyConditionExpression: aws.String("usernameHead = :head AND " + keyCondition),
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":head": {
+				S: aws.String(usernameHead(normalized)),
+			},
 			":username": {
-				S: aws.String(username),
+				S: aws.String(normalized),
+			},
+		},
+	}
+
+	return at.query(input, limit, after)
+}
+
+// ScanAuthorizationItems filters the platform out of a scan of the table.
+func (at *AuthorizationTable) ScanAuthorizationItems(platformName PlatformName, limit int, after string) ([]AuthorizationItem, string, error) {
+	input := &dynamodb.ScanInput{
+		TableName:        at.getAuthorizationTableName(),
+		FilterExpression: aws.String("platformName = :platformName"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":platformName": {
+				S: aws.String(string(platformName)),
 			},
 		},
-		FilterExpression: filterExpression,
+	}
+
+	return at.paginate(limit, after, func(startKey map[string]*dynamodb.AttributeValue, pageLimit *int64) ([]map[string]*dynamodb.AttributeValue, map[string]*dynamodb.AttributeValue, error) {
+		input.ExclusiveStartKey = startKey
+		input.Limit = pageLimit
+		output, err := conn.Scan(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		return output.Items, output.LastEvaluatedKey, nil
+	})
+}
+
+// query runs the query until limit items are found or the results are
+// exhausted, see paginate.
+func (at *AuthorizationTable) query(input *dynamodb.QueryInput, limit int, after string) ([]AuthorizationItem, string, error) {
+	return at.paginate(limit, after, func(startKey map[string]*dynamodb.AttributeValue, pageLimit *int64) ([]map[string]*dynamodb.AttributeValue, map[string]*dynamodb.AttributeValue, error) {
+		input.ExclusiveStartKey = startKey
+		input.Limit = pageLimit
+		output, err := conn.Query(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		return output.Items, output.LastEvaluatedKey, nil
+	})
+}
+
+// dynamoDBPage reads the page starting after startKey, pageLimit is nil when
+// there is no limit.
+type dynamoDBPage func(startKey map[string]*dynamodb.AttributeValue, pageLimit *int64) ([]map[string]*dynamodb.AttributeValue, map[string]*dynamodb.AttributeValue, error)
+
+// paginate reads the pages until limit items are found or the results are
+// exhausted, limit < 1 means no limit. after and the returned position are
+// the JSON encoded DynamoDB keys of the last evaluated item.
+func (at *AuthorizationTable) paginate(limit int, after string, page dynamoDBPage) ([]AuthorizationItem, string, error) {
+	if err := at.verify(); err != nil {
+		return nil, "", err
+	}
+
+	var startKey map[string]*dynamodb.AttributeValue
+	if after != "" {
+		var err error
+		if startKey, err = decodeDynamoDBKey(after); err != nil {
+			return nil, "", err
+		}
+	}
+
+	items := make([]AuthorizationItem, 0)
+	for {
+		var pageLimit *int64
+		if limit > 0 {
+			pageLimit = aws.Int64(int64(limit - len(items)))
+		}
+		pageItems, lastKey, err := page(startKey, pageLimit)
+		if err != nil {
+			return nil, "", err
+		}
+
+		typedItems, err := unmarshalAuthorizationItems(pageItems)
+		if err != nil {
+			return nil, "", err
+		}
+		items = append(items, typedItems...)
+
+		if len(lastKey) == 0 {
+			return items, "", nil
+		}
+		if limit > 0 && len(items) >= limit {
+			next, err := encodeDynamoDBKey(lastKey)
+			return items, next, err
+		}
+		startKey = lastKey
+	}
+}
+
+// BackfillUsernameIndex rewrites the items of the network which were stored
+// before the username index existed, it returns the number of rewritten
+// items. The index must have been added by the provision command first. The
+// items are rewritten unchanged, so their history has no event.
+func BackfillUsernameIndex(networkID int) (int, error) {
+	if _, ok := getStore().(*dynamoDBStore); !ok {
+		return 0, fmt.Errorf("the username index only exists in the %s backend", DynamoDBBackend)
+	}
+
+	at := getAuthorizationTable(networkID)
+
+	count := 0
+	var putErr error
+	input := &dynamodb.ScanInput{
 		TableName:        at.getAuthorizationTableName(),
+		FilterExpression: aws.String("attribute_not_exists(usernameNormalized)"),
+	}
+	err := conn.ScanPages(input, func(output *dynamodb.ScanOutput, lastPage bool) bool {
+		typedItems, err := unmarshalAuthorizationItems(output.Items)
+		if err != nil {
+			putErr = err
+			return false
+		}
+		for _, item := range typedItems {
+			if err = at.PutAuthorizationItem(item); err != nil {
+				putErr = err
+				return false
+			}
+			count++
+		}
+		return true
+	})
+	if err == nil {
+		err = putErr
 	}
-	return conn.Scan(input)
+
+	return count, err
+}
+
+func unmarshalAuthorizationItems(items []map[string]*dynamodb.AttributeValue) ([]AuthorizationItem, error) {
+	typedItems := make([]AuthorizationItem, 0)
+	err := dynamodbattribute.UnmarshalListOfMaps(items, &typedItems)
+	if err != nil {
+		return nil, err
+	}
+
+	return typedItems, nil
 }
 
 func (at *AuthorizationTable) getAuthorizationTableName() *string {
 	return aws.String(fmt.Sprintf("%s_%d", authorizationTableName, at.networkID))
 }
 
-func (at *AuthorizationTable) tryToCreateAuthorizationTable() {
-	input := &dynamodb.CreateTableInput{
-		TableName: at.getAuthorizationTableName(),
-		AttributeDefinitions: []*dynamodb.AttributeDefinition{
-			{
-				AttributeName: aws.String("userAddress"),
-				AttributeType: aws.String("S"),
-			},
-			{
-				AttributeName: aws.String("platformName"),
-				AttributeType: aws.String("S"),
-			},
-		},
-		KeySchema: []*dynamodb.KeySchemaElement{
+func (at *AuthorizationTable) tableSpec() dynamoDBTableSpec {
+	return dynamoDBTableSpec{
+		name: aws.StringValue(at.getAuthorizationTableName()),
+		attributes: stringAttributes(
+			"userAddress",
+			"platformName",
+			"usernameHead",
+			"usernameNormalized",
+		),
+		keySchema: keySchema("userAddress", "platformName"),
+		indexes: []dynamoDBIndexSpec{
 			{
-				AttributeName: aws.String("userAddress"),
-				KeyType:       aws.String("HASH"),
+				name:      usernameIndexName,
+				keySchema: keySchema("usernameHead", "usernameNormalized"),
 			},
-			{
-				AttributeName: aws.String("platformName"),
-				KeyType:       aws.String("RANGE"),
-			},
-		},
-		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-			ReadCapacityUnits:  aws.Int64(5),
-			WriteCapacityUnits: aws.Int64(5),
 		},
 	}
-	conn.CreateTable(input)
 }
@@ -0,0 +1,248 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+var authorizationEventTableName = os.Getenv("AUTHORIZATION_EVENT_TABLE_NAME")
+
+// ErrEventExists is returned when an event with the same ID has already been
+// appended.
+var ErrEventExists = errors.New("the event already exists")
+
+// AuthorizationEventType is the kind of change recorded by an
+// AuthorizationEvent.
+type AuthorizationEventType string
+
+const (
+	// EventLink is a login which linked an account to the address.
+	EventLink AuthorizationEventType = "link"
+	// EventVerify is a proof accepted for an authorization which was not
+	// verified.
+	EventVerify AuthorizationEventType = "verify"
+	// EventReverify is a verified proof which was found to be still valid.
+	EventReverify AuthorizationEventType = "reverify"
+	// EventFail is a proof rejected before it was verified.
+	EventFail AuthorizationEventType = "fail"
+	// EventRevoke is a verified proof revoked by the sweep or the address.
+	EventRevoke AuthorizationEventType = "revoke"
+	// EventAdminOverride is a status set by an operator.
+	EventAdminOverride AuthorizationEventType = "admin_override"
+	// EventBackfill is a field filled in by a backfill command.
+	EventBackfill AuthorizationEventType = "backfill"
+)
+
+// Actors of the authorization events.
+const (
+	ActorUser     = "user"
+	ActorSweep    = "sweep"
+	ActorAdmin    = "admin"
+	ActorBackfill = "backfill"
+)
+
+// AuthorizationChange describes why an authorization is stored, see
+// ChangeAuthorization.
+type AuthorizationChange struct {
+	Type  AuthorizationEventType
+	Actor string
+	// Operator is who made the admin overrides.
+	Operator string
+	// Reason defaults to the FailureReason of the item.
+	Reason string
+}
+
+// AuthorizationEvent is an entry of the history of the authorizations of an
+// address, it holds the state of the authorization after the change. The
+// events are never updated nor deleted.
+type AuthorizationEvent struct {
+	UserAddress string `json:"userAddress"`
+	// EventID orders the events of the address by time.
+	EventID      string                 `json:"eventID"`
+	PlatformName PlatformName           `json:"platformName"`
+	Type         AuthorizationEventType `json:"type"`
+	Actor        string                 `json:"actor"`
+	Operator     string                 `json:"operator,omitempty"`
+	Reason       string                 `json:"reason,omitempty"`
+	Status       AuthorizationStatus    `json:"status"`
+	Username     string                 `json:"username"`
+	UserID       string                 `json:"userID,omitempty"`
+	ProofURL     string                 `json:"proofURL,omitempty"`
+	ProofPayload string                 `json:"proofPayload,omitempty"`
+	CreatedAt    time.Time              `json:"createdAt"`
+}
+
+// eventIDLayout has a fixed width so that the event IDs sort by time.
+const eventIDLayout = "2006-01-02T15:04:05.000000000Z"
+
+// NewAuthorizationEvent records the change of the item at the given time.
+func NewAuthorizationEvent(item AuthorizationItem, change AuthorizationChange, at time.Time) AuthorizationEvent {
+	reason := change.Reason
+	if reason == "" {
+		reason = item.FailureReason
+	}
+
+	return AuthorizationEvent{
+		UserAddress:  item.UserAddress,
+		EventID:      fmt.Sprintf("%s#%s", at.UTC().Format(eventIDLayout), item.PlatformName),
+		PlatformName: item.PlatformName,
+		Type:         change.Type,
+		Actor:        change.Actor,
+		Operator:     change.Operator,
+		Reason:       reason,
+		Status:       item.StatusAt(at),
+		Username:     item.Username,
+		UserID:       item.UserID,
+		ProofURL:     item.ProofURL,
+		ProofPayload: item.ProofPayload,
+		CreatedAt:    at,
+	}
+}
+
+// ChangeAuthorization stores the authorization of the network and appends the
+// change to its history. The event is appended first so that no change is
+// missing from the history, it is left without its change if the item could
+// not be stored.
+func ChangeAuthorization(networkID int, item AuthorizationItem, change AuthorizationChange) error {
+	event := NewAuthorizationEvent(item, change, time.Now())
+	if err := getStore().AuthorizationEventTable(networkID).AppendAuthorizationEvent(event); err != nil {
+		return err
+	}
+
+	return getStore().AuthorizationTable(networkID).PutAuthorizationItem(item)
+}
+
+type authorizationEventTable struct {
+	networkID int
+
+	mutex    sync.Mutex
+	verified bool
+}
+
+var (
+	authorizationEventTables      = make(map[int]*authorizationEventTable)
+	authorizationEventTablesMutex sync.Mutex
+)
+
+func getAuthorizationEventTable(networkID int) *authorizationEventTable {
+	authorizationEventTablesMutex.Lock()
+	defer authorizationEventTablesMutex.Unlock()
+
+	table, ok := authorizationEventTables[networkID]
+	if !ok {
+		table = &authorizationEventTable{
+			networkID: networkID,
+		}
+		authorizationEventTables[networkID] = table
+	}
+
+	return table
+}
+
+// verify checks that the table has been provisioned the first time it is
+// used.
+func (t *authorizationEventTable) verify() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.verified {
+		return nil
+	}
+	if err := verifyDynamoDBTable(t.tableName()); err != nil {
+		return err
+	}
+	t.verified = true
+
+	return nil
+}
+
+// AppendAuthorizationEvent fails rather than replace an existing event.
+func (t *authorizationEventTable) AppendAuthorizationEvent(event AuthorizationEvent) error {
+	if err := t.verify(); err != nil {
+		return err
+	}
+
+	item, err := dynamodbattribute.MarshalMap(event)
+	if err != nil {
+		return err
+	}
+	_, err = conn.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(t.tableName()),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(eventID)"),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrEventExists
+	}
+
+	return err
+}
+
+func (t *authorizationEventTable) GetAuthorizationEvents(userAddress string, limit int, after string) ([]AuthorizationEvent, string, error) {
+	if err := t.verify(); err != nil {
+		return nil, "", err
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(t.tableName()),
+		KeyConditionExpression: aws.String("userAddress = :userAddress"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":userAddress": {
+				S: aws.String(userAddress),
+			},
+		},
+	}
+	if after != "" {
+		startKey, err := decodeDynamoDBKey(after)
+		if err != nil {
+			return nil, "", err
+		}
+		input.ExclusiveStartKey = startKey
+	}
+
+	events := make([]AuthorizationEvent, 0)
+	for {
+		if limit > 0 {
+			input.Limit = aws.Int64(int64(limit - len(events)))
+		}
+		output, err := conn.Query(input)
+		if err != nil {
+			return nil, "", err
+		}
+
+		var page []AuthorizationEvent
+		if err = dynamodbattribute.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			return nil, "", err
+		}
+		events = append(events, page...)
+
+		if len(output.LastEvaluatedKey) == 0 {
+			return events, "", nil
+		}
+		if limit > 0 && len(events) >= limit {
+			next, err := encodeDynamoDBKey(output.LastEvaluatedKey)
+			return events, next, err
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
+
+func (t *authorizationEventTable) tableName() string {
+	return fmt.Sprintf("%s_%d", authorizationEventTableName, t.networkID)
+}
+
+func (t *authorizationEventTable) tableSpec() dynamoDBTableSpec {
+	return dynamoDBTableSpec{
+		name:       t.tableName(),
+		attributes: stringAttributes("userAddress", "eventID"),
+		keySchema:  keySchema("userAddress", "eventID"),
+	}
+}
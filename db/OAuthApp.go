@@ -0,0 +1,77 @@
+package db
+
+import (
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+var oauthAppTableName = os.Getenv("OAUTH_APP_TABLE_NAME")
+
+// OAuthApp is the application the service registered on an instance of a
+// federated platform.
+type OAuthApp struct {
+	PlatformName PlatformName `json:"platformName"`
+	Instance     string       `json:"instance"`
+	ClientID     string       `json:"clientID"`
+	ClientSecret string       `json:"clientSecret"`
+	CreatedAt    time.Time    `json:"createdAt"`
+}
+
+type oauthAppTable struct{}
+
+// CreateOAuthApp stores the app unless one has already been registered on
+// the instance, in which case the existing app is returned.
+func (t oauthAppTable) CreateOAuthApp(app OAuthApp) (*OAuthApp, error) {
+	item, err := dynamodbattribute.MarshalMap(app)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(oauthAppTableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(instance)"),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return t.GetOAuthApp(app.PlatformName, app.Instance)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &app, nil
+}
+
+func (oauthAppTable) GetOAuthApp(platformName PlatformName, instance string) (*OAuthApp, error) {
+	key := map[string]string{
+		"platformName": string(platformName),
+		"instance":     instance,
+	}
+	output, err := getItem(key, aws.String(oauthAppTableName))
+	if err != nil {
+		return nil, err
+	}
+	if output.Item == nil {
+		return nil, ErrNotFound
+	}
+
+	var app OAuthApp
+	if err = dynamodbattribute.UnmarshalMap(output.Item, &app); err != nil {
+		return nil, err
+	}
+
+	return &app, nil
+}
+
+func oauthAppTableSpec() dynamoDBTableSpec {
+	return dynamoDBTableSpec{
+		name:       oauthAppTableName,
+		attributes: stringAttributes("platformName", "instance"),
+		keySchema:  keySchema("platformName", "instance"),
+	}
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+var profileTableName = os.Getenv("PROFILE_TABLE_NAME")
+
+// Profile is the account of a user on a platform which is not stored in a
+// table of its own, Data is the profile as returned by the platform.
+type Profile struct {
+	PlatformName PlatformName    `json:"platformName"`
+	Username     string          `json:"username"`
+	UserID       string          `json:"userID"`
+	Data         json.RawMessage `json:"data"`
+	UpdatedAt    time.Time       `json:"updatedAt"`
+}
+
+// profileRecord is how a Profile is stored in DynamoDB.
+type profileRecord struct {
+	Profile
+	UsernameNormalized string `json:"usernameNormalized"`
+}
+
+type profileTable struct{}
+
+func (profileTable) PutProfile(profile Profile) error {
+	_, err := putItem(profileRecord{
+		Profile:            profile,
+		UsernameNormalized: NormalizeUsername(profile.Username),
+	}, aws.String(profileTableName))
+	return err
+}
+
+func (profileTable) GetProfile(platformName PlatformName, username string) (*Profile, error) {
+	key := map[string]string{
+		"platformName":       string(platformName),
+		"usernameNormalized": NormalizeUsername(username),
+	}
+	output, err := getItem(key, aws.String(profileTableName))
+	if err != nil {
+		return nil, err
+	}
+	if output.Item == nil {
+		return nil, ErrNotFound
+	}
+
+	var record profileRecord
+	if err = dynamodbattribute.UnmarshalMap(output.Item, &record); err != nil {
+		return nil, err
+	}
+
+	return &record.Profile, nil
+}
+
+func (profileTable) BatchGetProfiles(platformName PlatformName, usernames []string) (map[string]Profile, error) {
+	mappedItems := make(map[string]Profile)
+
+	keys := make([]map[string]*dynamodb.AttributeValue, 0, len(usernames))
+	seen := make(map[string]bool)
+	for _, username := range usernames {
+		normalized := NormalizeUsername(username)
+		// BatchGetItem rejects duplicated keys
+		if seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+
+		key, err := dynamodbattribute.MarshalMap(map[string]string{
+			"platformName":       string(platformName),
+			"usernameNormalized": normalized,
+		})
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) < 1 {
+		return mappedItems, nil
+	}
+
+	output, err := conn.BatchGetItem(&dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*dynamodb.KeysAndAttributes{
+			profileTableName: {
+				Keys: keys,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []profileRecord
+	err = dynamodbattribute.UnmarshalListOfMaps(output.Responses[profileTableName], &records)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		mappedItems[record.UsernameNormalized] = record.Profile
+	}
+
+	return mappedItems, nil
+}
+
+func profileTableSpec() dynamoDBTableSpec {
+	return dynamoDBTableSpec{
+		name:       profileTableName,
+		attributes: stringAttributes("platformName", "usernameNormalized"),
+		keySchema:  keySchema("platformName", "usernameNormalized"),
+	}
+}
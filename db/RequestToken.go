@@ -0,0 +1,78 @@
+package db
+
+import (
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+var requestTokenTableName = os.Getenv("REQUEST_TOKEN_TABLE_NAME")
+
+// RequestToken is the short-lived secret of a login which has been started
+// but not completed yet.
+type RequestToken struct {
+	Token string `json:"token"`
+	// Secret is what the platform needs to complete the login, such as the
+	// OAuth1 token secret.
+	Secret       string       `json:"secret"`
+	PlatformName PlatformName `json:"platformName"`
+	// ExpiresAt is a unix timestamp so that DynamoDB can expire the item.
+	ExpiresAt int64 `json:"expiresAt"`
+}
+
+// Expired reports whether the token can not be used anymore.
+func (t RequestToken) Expired() bool {
+	return time.Now().Unix() >= t.ExpiresAt
+}
+
+type requestTokenTable struct{}
+
+func (requestTokenTable) PutRequestToken(token RequestToken) error {
+	_, err := putItem(token, aws.String(requestTokenTableName))
+	return err
+}
+
+// TakeRequestToken deletes the token so that it can only be taken once.
+func (requestTokenTable) TakeRequestToken(token string) (*RequestToken, error) {
+	key, err := dynamodbattribute.MarshalMap(map[string]string{
+		"token": token,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := conn.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:    aws.String(requestTokenTableName),
+		Key:          key,
+		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Attributes) == 0 {
+		return nil, ErrNotFound
+	}
+
+	var typedItem RequestToken
+	if err = dynamodbattribute.UnmarshalMap(output.Attributes, &typedItem); err != nil {
+		return nil, err
+	}
+	// DynamoDB deletes the expired items up to 48 hours late
+	if typedItem.Expired() {
+		return nil, ErrNotFound
+	}
+
+	return &typedItem, nil
+}
+
+func requestTokenTableSpec() dynamoDBTableSpec {
+	return dynamoDBTableSpec{
+		name:         requestTokenTableName,
+		attributes:   stringAttributes("token"),
+		keySchema:    keySchema("token", ""),
+		ttlAttribute: "expiresAt",
+	}
+}
@@ -1,7 +1,9 @@
 package db
 
 import (
+	"encoding/json"
 	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
@@ -9,6 +11,8 @@ import (
 	goTwitter "github.com/dghubble/go-twitter/twitter"
 )
 
+// twitterOAuthTableName is the legacy table of the Twitter profiles keyed by
+// screen name, it is only read by MigrateTwitterProfiles.
 var twitterOAuthTableName = os.Getenv("TWITTER_OAUTH_TABLE_NAME")
 
 type PlatformName string
@@ -17,77 +21,144 @@ var (
 	TwitterPlatformName  PlatformName = "twitter"
 	FacebookPlatformName PlatformName = "facebook"
 	GitHubPlatformName   PlatformName = "github"
+	MastodonPlatformName PlatformName = "mastodon"
+	DNSPlatformName      PlatformName = "dns"
+	WebPlatformName      PlatformName = "web"
 )
 
-func GetTwitterOAuthItem(screenName string) (*dynamodb.GetItemOutput, error) {
-	item := map[string]string{
-		"screen_name": screenName,
+// MigrateTwitterProfiles copies the profiles of the legacy table keyed by
+// screen name to the table keyed by user ID, it returns the number of copied
+// profiles. The users who logged in since the profiles table exists are
+// skipped so that their profile is not replaced by an older one.
+func MigrateTwitterProfiles() (int, error) {
+	var (
+		users []goTwitter.User
+		err   error
+	)
+	switch s := getStore().(type) {
+	case *dynamoDBStore:
+		users, err = scanLegacyTwitterOAuthTable()
+	case *SQLStore:
+		users, err = s.legacyTwitterOAuthUsers()
+	default:
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
 	}
-	return getItem(item, aws.String(twitterOAuthTableName))
-}
 
-func PutTwitterOAuthItem(user goTwitter.User) (*dynamodb.PutItemOutput, error) {
-	return putItem(user, aws.String(twitterOAuthTableName))
-}
+	table := getStore().TwitterProfileTable()
+	count := 0
+	now := time.Now()
+	for _, user := range users {
+		if user.IDStr == "" {
+			continue
+		}
+		_, err = table.GetTwitterProfile(user.IDStr)
+		if err == nil {
+			continue
+		}
+		if err != ErrNotFound {
+			return count, err
+		}
 
-func BatchGetTwitterOAuth(screenNames []string) (map[string]goTwitter.User, error) {
-	tableName := twitterOAuthTableName
-	keys := make([]map[string]*dynamodb.AttributeValue, len(screenNames))
-	for i, screenName := range screenNames {
-		keys[i], _ = dynamodbattribute.MarshalMap(map[string]string{
-			"screen_name": screenName,
-		})
+		if _, err = table.PutTwitterProfile(user, now); err != nil {
+			return count, err
+		}
+		count++
 	}
-	input := &dynamodb.BatchGetItemInput{
-		RequestItems: map[string]*dynamodb.KeysAndAttributes{
-			tableName: &dynamodb.KeysAndAttributes{
-				Keys: keys,
-			},
-		},
+
+	return count, nil
+}
+
+func scanLegacyTwitterOAuthTable() ([]goTwitter.User, error) {
+	users := make([]goTwitter.User, 0)
+	var unmarshalErr error
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(twitterOAuthTableName),
 	}
-	output, err := conn.BatchGetItem(input)
-	if err != nil {
-		return nil, err
+	err := conn.ScanPages(input, func(output *dynamodb.ScanOutput, lastPage bool) bool {
+		var page []goTwitter.User
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(output.Items, &page); unmarshalErr != nil {
+			return false
+		}
+		users = append(users, page...)
+		return true
+	})
+	if err == nil {
+		err = unmarshalErr
 	}
 
-	items, ok := output.Responses[tableName]
-	if !ok {
-		return map[string]goTwitter.User{}, nil
-	}
+	return users, err
+}
 
-	typedItems := make([]goTwitter.User, len(items))
-	err = dynamodbattribute.UnmarshalListOfMaps(items, &typedItems)
+func (s *SQLStore) legacyTwitterOAuthUsers() ([]goTwitter.User, error) {
+	rows, err := s.db.Query(`SELECT profile FROM twitter_oauth`)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	mappedItems := make(map[string]goTwitter.User)
-	for _, v := range typedItems {
-		mappedItems[v.ScreenName] = v
+	users := make([]goTwitter.User, 0)
+	for rows.Next() {
+		var profile string
+		if err = rows.Scan(&profile); err != nil {
+			return nil, err
+		}
+
+		var user goTwitter.User
+		if err = json.Unmarshal([]byte(profile), &user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
 	}
 
-	return mappedItems, nil
+	return users, rows.Err()
 }
 
-func tryToCreateTwitterOAuthTable() {
-	input := &dynamodb.CreateTableInput{
-		TableName: aws.String(twitterOAuthTableName),
-		AttributeDefinitions: []*dynamodb.AttributeDefinition{
-			{
-				AttributeName: aws.String("screen_name"),
-				AttributeType: aws.String("S"),
-			},
-		},
-		KeySchema: []*dynamodb.KeySchemaElement{
-			{
-				AttributeName: aws.String("screen_name"),
-				KeyType:       aws.String("HASH"),
-			},
-		},
-		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-			ReadCapacityUnits:  aws.Int64(5),
-			WriteCapacityUnits: aws.Int64(5),
-		},
+// BackfillTwitterUserIDs sets the Twitter user ID of the authorizations of
+// the network which were stored before the IDs were recorded, it returns the
+// number of updated items. The screen names are resolved with the profiles,
+// so MigrateTwitterProfiles must run first.
+func BackfillTwitterUserIDs(networkID int) (int, error) {
+	table := GetAuthorizationTable(networkID)
+	profiles := getStore().TwitterProfileTable()
+
+	count := 0
+	after := ""
+	for {
+		items, next, err := table.ScanAuthorizationItems(TwitterPlatformName, 100, after)
+		if err != nil {
+			return count, err
+		}
+
+		for _, item := range items {
+			if item.UserID != "" {
+				continue
+			}
+			profile, err := profiles.GetTwitterProfileByScreenName(item.Username)
+			if err == ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return count, err
+			}
+
+			item.UserID = profile.IDStr
+			err = ChangeAuthorization(networkID, item, AuthorizationChange{
+				Type:   EventBackfill,
+				Actor:  ActorBackfill,
+				Reason: "twitter_user_id",
+			})
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if next == "" {
+			return count, nil
+		}
+		after = next
 	}
-	conn.CreateTable(input)
 }
@@ -0,0 +1,286 @@
+package db
+
+import (
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	goTwitter "github.com/dghubble/go-twitter/twitter"
+)
+
+var twitterProfileTableName = os.Getenv("TWITTER_PROFILE_TABLE_NAME")
+
+// screenNameIndexName is the global secondary index used to look up the
+// Twitter profiles by screen name, the released profiles are not in it.
+const screenNameIndexName = "screenNameIndex"
+
+// TwitterProfile is the Twitter user as returned by its last login. The
+// profiles are keyed by IDStr since the screen names can change and be taken
+// by other users.
+type TwitterProfile struct {
+	goTwitter.User
+	// ScreenNameHistory lists the screen names the user logged in with,
+	// oldest first.
+	ScreenNameHistory []TwitterScreenName `json:"screenNameHistory"`
+	// ScreenNameReleased is set once another user logged in with the screen
+	// name of the profile, the current screen name of the user is unknown
+	// until they log in again.
+	ScreenNameReleased bool      `json:"screenNameReleased,omitempty"`
+	UpdatedAt          time.Time `json:"updatedAt"`
+}
+
+// TwitterScreenName is a screen name the user had between FirstSeenAt and
+// LastSeenAt.
+type TwitterScreenName struct {
+	ScreenName  string    `json:"screenName"`
+	FirstSeenAt time.Time `json:"firstSeenAt"`
+	LastSeenAt  time.Time `json:"lastSeenAt"`
+}
+
+// nextTwitterProfile returns the profile of the user seen at seenAt, stored
+// is its previous profile or nil.
+func nextTwitterProfile(stored *TwitterProfile, user goTwitter.User, seenAt time.Time) TwitterProfile {
+	profile := TwitterProfile{
+		User:      user,
+		UpdatedAt: seenAt,
+	}
+	if stored != nil {
+		profile.ScreenNameHistory = append(profile.ScreenNameHistory, stored.ScreenNameHistory...)
+	}
+
+	n := len(profile.ScreenNameHistory)
+	if n > 0 && NormalizeUsername(profile.ScreenNameHistory[n-1].ScreenName) == NormalizeUsername(user.ScreenName) {
+		profile.ScreenNameHistory[n-1].ScreenName = user.ScreenName
+		profile.ScreenNameHistory[n-1].LastSeenAt = seenAt
+		return profile
+	}
+
+	profile.ScreenNameHistory = append(profile.ScreenNameHistory, TwitterScreenName{
+		ScreenName:  user.ScreenName,
+		FirstSeenAt: seenAt,
+		LastSeenAt:  seenAt,
+	})
+
+	return profile
+}
+
+// releaseTwitterProfile marks the profile as having lost its screen name.
+func releaseTwitterProfile(profile TwitterProfile) TwitterProfile {
+	profile.ScreenNameReleased = true
+	return profile
+}
+
+// twitterProfileRecord is how a TwitterProfile is stored in DynamoDB, the
+// released profiles have no ScreenNameNormalized so that they are left out of
+// the screen name index.
+type twitterProfileRecord struct {
+	TwitterProfile
+	ScreenNameNormalized string `json:"screenNameNormalized,omitempty"`
+}
+
+func newTwitterProfileRecord(profile TwitterProfile) twitterProfileRecord {
+	record := twitterProfileRecord{
+		TwitterProfile: profile,
+	}
+	if !profile.ScreenNameReleased {
+		record.ScreenNameNormalized = NormalizeUsername(profile.ScreenName)
+	}
+
+	return record
+}
+
+type twitterProfileTable struct{}
+
+func (t twitterProfileTable) PutTwitterProfile(user goTwitter.User, seenAt time.Time) (*TwitterProfile, error) {
+	stored, err := t.GetTwitterProfile(user.IDStr)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	profile := nextTwitterProfile(stored, user, seenAt)
+
+	holders, err := t.queryScreenName(user.ScreenName)
+	if err != nil {
+		return nil, err
+	}
+	for _, holder := range holders {
+		if holder.IDStr == user.IDStr {
+			continue
+		}
+		_, err = putItem(newTwitterProfileRecord(releaseTwitterProfile(holder.TwitterProfile)), aws.String(twitterProfileTableName))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = putItem(newTwitterProfileRecord(profile), aws.String(twitterProfileTableName))
+	if err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+func (twitterProfileTable) GetTwitterProfile(userID string) (*TwitterProfile, error) {
+	key := map[string]string{
+		"id_str": userID,
+	}
+	output, err := getItem(key, aws.String(twitterProfileTableName))
+	if err != nil {
+		return nil, err
+	}
+	if output.Item == nil {
+		return nil, ErrNotFound
+	}
+
+	var record twitterProfileRecord
+	if err = dynamodbattribute.UnmarshalMap(output.Item, &record); err != nil {
+		return nil, err
+	}
+
+	return &record.TwitterProfile, nil
+}
+
+func (t twitterProfileTable) GetTwitterProfileByScreenName(screenName string) (*TwitterProfile, error) {
+	records, err := t.queryScreenName(screenName)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 1 {
+		return nil, ErrNotFound
+	}
+
+	// a screen name is only held by one profile unless two users logged in
+	// with it at the same time, the last login wins
+	latest := records[0]
+	for _, record := range records[1:] {
+		if record.UpdatedAt.After(latest.UpdatedAt) {
+			latest = record
+		}
+	}
+
+	return &latest.TwitterProfile, nil
+}
+
+func (twitterProfileTable) queryScreenName(screenName string) ([]twitterProfileRecord, error) {
+	normalized := NormalizeUsername(screenName)
+	if normalized == "" {
+		return nil, nil
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(twitterProfileTableName),
+		IndexName:              aws.String(screenNameIndexName),
+		KeyConditionExpression: aws.String("screenNameNormalized = :screenName"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":screenName": {
+				S: aws.String(normalized),
+			},
+		},
+	}
+
+	records := make([]twitterProfileRecord, 0)
+	var unmarshalErr error
+	err := conn.QueryPages(input, func(output *dynamodb.QueryOutput, lastPage bool) bool {
+		var page []twitterProfileRecord
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(output.Items, &page); unmarshalErr != nil {
+			return false
+		}
+		records = append(records, page...)
+		return true
+	})
+	if err == nil {
+		err = unmarshalErr
+	}
+
+	return records, err
+}
+
+func (twitterProfileTable) BatchGetTwitterProfiles(userIDs []string) (map[string]TwitterProfile, error) {
+	mappedItems := make(map[string]TwitterProfile)
+
+	keys := make([]map[string]*dynamodb.AttributeValue, 0, len(userIDs))
+	seen := make(map[string]bool)
+	for _, userID := range userIDs {
+		// BatchGetItem rejects duplicated keys
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		key, err := dynamodbattribute.MarshalMap(map[string]string{
+			"id_str": userID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) < 1 {
+		return mappedItems, nil
+	}
+
+	output, err := conn.BatchGetItem(&dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*dynamodb.KeysAndAttributes{
+			twitterProfileTableName: {
+				Keys: keys,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []twitterProfileRecord
+	err = dynamodbattribute.UnmarshalListOfMaps(output.Responses[twitterProfileTableName], &records)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		mappedItems[record.IDStr] = record.TwitterProfile
+	}
+
+	return mappedItems, nil
+}
+
+func (t twitterProfileTable) BatchGetTwitterProfilesByScreenName(screenNames []string) (map[string]TwitterProfile, error) {
+	return batchGetTwitterProfilesByScreenName(t, screenNames)
+}
+
+// batchGetTwitterProfilesByScreenName looks the screen names up one by one,
+// for the backends which can not look up several at once.
+func batchGetTwitterProfilesByScreenName(table TwitterProfileStore, screenNames []string) (map[string]TwitterProfile, error) {
+	mappedItems := make(map[string]TwitterProfile)
+	for _, screenName := range screenNames {
+		normalized := NormalizeUsername(screenName)
+		if _, ok := mappedItems[normalized]; ok {
+			continue
+		}
+
+		profile, err := table.GetTwitterProfileByScreenName(normalized)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		mappedItems[normalized] = *profile
+	}
+
+	return mappedItems, nil
+}
+
+func twitterProfileTableSpec() dynamoDBTableSpec {
+	return dynamoDBTableSpec{
+		name:       twitterProfileTableName,
+		attributes: stringAttributes("id_str", "screenNameNormalized"),
+		keySchema:  keySchema("id_str", ""),
+		indexes: []dynamoDBIndexSpec{
+			{
+				name:      screenNameIndexName,
+				keySchema: keySchema("screenNameNormalized", ""),
+			},
+		},
+	}
+}
@@ -1,6 +1,8 @@
 package db
 
 import (
+	"encoding/json"
+	"errors"
 	"log"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -12,15 +14,54 @@ import (
 
 var conn *dynamodb.DynamoDB
 
-func init() {
+var (
+	// ErrNotFound is returned when the requested item does not exist.
+	ErrNotFound = errors.New("item not found")
+	// ErrInvalidPosition is returned when a pagination position could not be
+	// decoded.
+	ErrInvalidPosition = errors.New("invalid pagination position")
+)
+
+type dynamoDBStore struct{}
+
+// NewDynamoDBStore connects to DynamoDB with the credentials and region taken
+// from the environment.
+func NewDynamoDBStore() (Store, error) {
 	sess, err := session.NewSession()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	conn = dynamodb.New(sess, aws.NewConfig())
 
-	tryToCreateTwitterOAuthTable()
-	tryToCreateAccountTable()
+	return &dynamoDBStore{}, nil
+}
+
+func (s *dynamoDBStore) AuthorizationTable(networkID int) AuthorizationStore {
+	return getAuthorizationTable(networkID)
+}
+
+func (s *dynamoDBStore) AuthorizationEventTable(networkID int) AuthorizationEventStore {
+	return getAuthorizationEventTable(networkID)
+}
+
+func (s *dynamoDBStore) TwitterProfileTable() TwitterProfileStore {
+	return twitterProfileTable{}
+}
+
+func (s *dynamoDBStore) ProfileTable() ProfileStore {
+	return profileTable{}
+}
+
+func (s *dynamoDBStore) OAuthAppTable() OAuthAppStore {
+	return oauthAppTable{}
+}
+
+func (s *dynamoDBStore) AccountInfoTable() AccountInfoStore {
+	return accountInfoTable{}
+}
+
+func (s *dynamoDBStore) RequestTokenTable() RequestTokenStore {
+	return requestTokenTable{}
 }
 
 func putItem(item interface{}, tableName *string) (*dynamodb.PutItemOutput, error) {
@@ -51,6 +92,26 @@ func getItem(item interface{}, tableName *string) (*dynamodb.GetItemOutput, erro
 	return conn.GetItem(input)
 }
 
+// encodeDynamoDBKey encodes a LastEvaluatedKey made of string attributes.
+func encodeDynamoDBKey(key map[string]*dynamodb.AttributeValue) (string, error) {
+	var values map[string]string
+	if err := dynamodbattribute.UnmarshalMap(key, &values); err != nil {
+		return "", err
+	}
+
+	bs, err := json.Marshal(values)
+	return string(bs), err
+}
+
+func decodeDynamoDBKey(position string) (map[string]*dynamodb.AttributeValue, error) {
+	var values map[string]string
+	if err := json.Unmarshal([]byte(position), &values); err != nil {
+		return nil, ErrInvalidPosition
+	}
+
+	return dynamodbattribute.MarshalMap(values)
+}
+
 func DynamoErrHandler(err error) {
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
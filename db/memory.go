@@ -0,0 +1,461 @@
+package db
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	goTwitter "github.com/dghubble/go-twitter/twitter"
+)
+
+// MemoryStore is a thread-safe Store which keeps everything in memory, it is
+// meant for local development and tests.
+type MemoryStore struct {
+	mutex          sync.RWMutex
+	authorizations map[int]*memoryAuthorizationTable
+	events         map[int]*memoryAuthorizationEventTable
+	twitterProfile *memoryTwitterProfileTable
+	profiles       *memoryProfileTable
+	oauthApps      *memoryOAuthAppTable
+	accountInfo    *memoryAccountInfoTable
+	requestTokens  *memoryRequestTokenTable
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		authorizations: make(map[int]*memoryAuthorizationTable),
+		events:         make(map[int]*memoryAuthorizationEventTable),
+		twitterProfile: &memoryTwitterProfileTable{
+			profiles: make(map[string]TwitterProfile),
+		},
+		profiles: &memoryProfileTable{
+			profiles: make(map[memoryProfileKey]Profile),
+		},
+		oauthApps: &memoryOAuthAppTable{
+			apps: make(map[memoryOAuthAppKey]OAuthApp),
+		},
+		accountInfo: &memoryAccountInfoTable{},
+		requestTokens: &memoryRequestTokenTable{
+			tokens: make(map[string]RequestToken),
+		},
+	}
+}
+
+func (s *MemoryStore) AuthorizationTable(networkID int) AuthorizationStore {
+	s.mutex.RLock()
+	table, ok := s.authorizations[networkID]
+	s.mutex.RUnlock()
+	if ok {
+		return table
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	table, ok = s.authorizations[networkID]
+	if !ok {
+		table = &memoryAuthorizationTable{}
+		s.authorizations[networkID] = table
+	}
+
+	return table
+}
+
+func (s *MemoryStore) AuthorizationEventTable(networkID int) AuthorizationEventStore {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	table, ok := s.events[networkID]
+	if !ok {
+		table = &memoryAuthorizationEventTable{}
+		s.events[networkID] = table
+	}
+
+	return table
+}
+
+func (s *MemoryStore) TwitterProfileTable() TwitterProfileStore {
+	return s.twitterProfile
+}
+
+func (s *MemoryStore) ProfileTable() ProfileStore {
+	return s.profiles
+}
+
+func (s *MemoryStore) OAuthAppTable() OAuthAppStore {
+	return s.oauthApps
+}
+
+func (s *MemoryStore) AccountInfoTable() AccountInfoStore {
+	return s.accountInfo
+}
+
+func (s *MemoryStore) RequestTokenTable() RequestTokenStore {
+	return s.requestTokens
+}
+
+type memoryAuthorizationTable struct {
+	mutex sync.RWMutex
+	items []AuthorizationItem
+}
+
+func (t *memoryAuthorizationTable) PutAuthorizationItem(item AuthorizationItem) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for i, v := range t.items {
+		if v.UserAddress == item.UserAddress && v.PlatformName == item.PlatformName {
+			t.items[i] = item
+			return nil
+		}
+	}
+	t.items = append(t.items, item)
+
+	return nil
+}
+
+func (t *memoryAuthorizationTable) GetAuthorizationItem(userAddress string, platformName PlatformName) (*AuthorizationItem, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	for _, v := range t.items {
+		if v.UserAddress == userAddress && v.PlatformName == platformName {
+			item := v
+			return &item, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (t *memoryAuthorizationTable) GetAuthorizationItemsByUserAddress(userAddress string, limit int, after string) ([]AuthorizationItem, string, error) {
+	return t.filter(func(item AuthorizationItem) bool {
+		return item.UserAddress == userAddress
+	}, platformSortKey, limit, after)
+}
+
+func (t *memoryAuthorizationTable) GetAuthorizationItemsByUsername(username string, limit int, after string) ([]AuthorizationItem, string, error) {
+	normalized := NormalizeUsername(username)
+	return t.filter(func(item AuthorizationItem) bool {
+		return NormalizeUsername(item.Username) == normalized
+	}, usernameSortKey, limit, after)
+}
+
+func (t *memoryAuthorizationTable) GetAuthorizationItemsByUsernamePrefix(usernamePrefix string, limit int, after string) ([]AuthorizationItem, string, error) {
+	normalized := NormalizeUsername(usernamePrefix)
+	if normalized == "" {
+		return []AuthorizationItem{}, "", nil
+	}
+	return t.filter(func(item AuthorizationItem) bool {
+		return strings.HasPrefix(NormalizeUsername(item.Username), normalized)
+	}, usernameSortKey, limit, after)
+}
+
+func (t *memoryAuthorizationTable) ScanAuthorizationItems(platformName PlatformName, limit int, after string) ([]AuthorizationItem, string, error) {
+	return t.filter(func(item AuthorizationItem) bool {
+		return item.PlatformName == platformName
+	}, userAddressSortKey, limit, after)
+}
+
+func platformSortKey(item AuthorizationItem) []string {
+	return []string{string(item.PlatformName)}
+}
+
+func userAddressSortKey(item AuthorizationItem) []string {
+	return []string{item.UserAddress, string(item.PlatformName)}
+}
+
+func usernameSortKey(item AuthorizationItem) []string {
+	return []string{NormalizeUsername(item.Username), item.UserAddress, string(item.PlatformName)}
+}
+
+// filter returns at most limit matched items ordered by sortKey, the
+// positions are the JSON encoded sort keys of the last returned items.
+func (t *memoryAuthorizationTable) filter(
+	match func(AuthorizationItem) bool,
+	sortKey func(AuthorizationItem) []string,
+	limit int,
+	after string,
+) ([]AuthorizationItem, string, error) {
+	var afterKey []string
+	if after != "" {
+		if err := json.Unmarshal([]byte(after), &afterKey); err != nil {
+			return nil, "", ErrInvalidPosition
+		}
+	}
+
+	t.mutex.RLock()
+	items := make([]AuthorizationItem, 0)
+	for _, v := range t.items {
+		if match(v) && (afterKey == nil || compareSortKeys(sortKey(v), afterKey) > 0) {
+			items = append(items, v)
+		}
+	}
+	t.mutex.RUnlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		return compareSortKeys(sortKey(items[i]), sortKey(items[j])) < 0
+	})
+	if limit < 1 || len(items) <= limit {
+		return items, "", nil
+	}
+
+	items = items[:limit]
+	next, err := json.Marshal(sortKey(items[limit-1]))
+
+	return items, string(next), err
+}
+
+func compareSortKeys(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := strings.Compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+
+	return len(a) - len(b)
+}
+
+type memoryAuthorizationEventTable struct {
+	mutex  sync.RWMutex
+	events []AuthorizationEvent
+}
+
+func (t *memoryAuthorizationEventTable) AppendAuthorizationEvent(event AuthorizationEvent) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, v := range t.events {
+		if v.UserAddress == event.UserAddress && v.EventID == event.EventID {
+			return ErrEventExists
+		}
+	}
+	t.events = append(t.events, event)
+
+	return nil
+}
+
+// GetAuthorizationEvents returns the events of the address ordered by ID, the
+// positions are the IDs of the last returned events.
+func (t *memoryAuthorizationEventTable) GetAuthorizationEvents(userAddress string, limit int, after string) ([]AuthorizationEvent, string, error) {
+	t.mutex.RLock()
+	events := make([]AuthorizationEvent, 0)
+	for _, v := range t.events {
+		if v.UserAddress == userAddress && v.EventID > after {
+			events = append(events, v)
+		}
+	}
+	t.mutex.RUnlock()
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].EventID < events[j].EventID
+	})
+	if limit < 1 || len(events) <= limit {
+		return events, "", nil
+	}
+
+	events = events[:limit]
+	return events, events[limit-1].EventID, nil
+}
+
+type memoryTwitterProfileTable struct {
+	mutex    sync.RWMutex
+	profiles map[string]TwitterProfile
+}
+
+func (t *memoryTwitterProfileTable) PutTwitterProfile(user goTwitter.User, seenAt time.Time) (*TwitterProfile, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var stored *TwitterProfile
+	if v, ok := t.profiles[user.IDStr]; ok {
+		stored = &v
+	}
+	profile := nextTwitterProfile(stored, user, seenAt)
+
+	normalized := NormalizeUsername(user.ScreenName)
+	for userID, v := range t.profiles {
+		if userID != user.IDStr && !v.ScreenNameReleased && NormalizeUsername(v.ScreenName) == normalized {
+			t.profiles[userID] = releaseTwitterProfile(v)
+		}
+	}
+	t.profiles[user.IDStr] = profile
+
+	return &profile, nil
+}
+
+func (t *memoryTwitterProfileTable) GetTwitterProfile(userID string) (*TwitterProfile, error) {
+	t.mutex.RLock()
+	profile, ok := t.profiles[userID]
+	t.mutex.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &profile, nil
+}
+
+func (t *memoryTwitterProfileTable) GetTwitterProfileByScreenName(screenName string) (*TwitterProfile, error) {
+	normalized := NormalizeUsername(screenName)
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	for _, v := range t.profiles {
+		if !v.ScreenNameReleased && NormalizeUsername(v.ScreenName) == normalized {
+			profile := v
+			return &profile, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (t *memoryTwitterProfileTable) BatchGetTwitterProfiles(userIDs []string) (map[string]TwitterProfile, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	mappedItems := make(map[string]TwitterProfile)
+	for _, userID := range userIDs {
+		if profile, ok := t.profiles[userID]; ok {
+			mappedItems[userID] = profile
+		}
+	}
+
+	return mappedItems, nil
+}
+
+func (t *memoryTwitterProfileTable) BatchGetTwitterProfilesByScreenName(screenNames []string) (map[string]TwitterProfile, error) {
+	return batchGetTwitterProfilesByScreenName(t, screenNames)
+}
+
+type memoryProfileKey struct {
+	platformName PlatformName
+	username     string
+}
+
+type memoryProfileTable struct {
+	mutex    sync.RWMutex
+	profiles map[memoryProfileKey]Profile
+}
+
+func (t *memoryProfileTable) PutProfile(profile Profile) error {
+	t.mutex.Lock()
+	t.profiles[memoryProfileKey{profile.PlatformName, NormalizeUsername(profile.Username)}] = profile
+	t.mutex.Unlock()
+
+	return nil
+}
+
+func (t *memoryProfileTable) GetProfile(platformName PlatformName, username string) (*Profile, error) {
+	t.mutex.RLock()
+	profile, ok := t.profiles[memoryProfileKey{platformName, NormalizeUsername(username)}]
+	t.mutex.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &profile, nil
+}
+
+func (t *memoryProfileTable) BatchGetProfiles(platformName PlatformName, usernames []string) (map[string]Profile, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	mappedItems := make(map[string]Profile)
+	for _, username := range usernames {
+		normalized := NormalizeUsername(username)
+		if profile, ok := t.profiles[memoryProfileKey{platformName, normalized}]; ok {
+			mappedItems[normalized] = profile
+		}
+	}
+
+	return mappedItems, nil
+}
+
+type memoryOAuthAppKey struct {
+	platformName PlatformName
+	instance     string
+}
+
+type memoryOAuthAppTable struct {
+	mutex sync.Mutex
+	apps  map[memoryOAuthAppKey]OAuthApp
+}
+
+func (t *memoryOAuthAppTable) CreateOAuthApp(app OAuthApp) (*OAuthApp, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := memoryOAuthAppKey{app.PlatformName, app.Instance}
+	if existing, ok := t.apps[key]; ok {
+		return &existing, nil
+	}
+	t.apps[key] = app
+
+	return &app, nil
+}
+
+func (t *memoryOAuthAppTable) GetOAuthApp(platformName PlatformName, instance string) (*OAuthApp, error) {
+	t.mutex.Lock()
+	app, ok := t.apps[memoryOAuthAppKey{platformName, instance}]
+	t.mutex.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &app, nil
+}
+
+type memoryAccountInfoTable struct {
+	mutex sync.Mutex
+	infos []AccountInfo
+}
+
+func (t *memoryAccountInfoTable) PutAccountInfo(info AccountInfo) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for i, v := range t.infos {
+		if v.Email == info.Email && v.UserAddress == info.UserAddress {
+			t.infos[i] = info
+			return nil
+		}
+	}
+	t.infos = append(t.infos, info)
+
+	return nil
+}
+
+type memoryRequestTokenTable struct {
+	mutex  sync.Mutex
+	tokens map[string]RequestToken
+}
+
+func (t *memoryRequestTokenTable) PutRequestToken(token RequestToken) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for k, v := range t.tokens {
+		if v.Expired() {
+			delete(t.tokens, k)
+		}
+	}
+	t.tokens[token.Token] = token
+
+	return nil
+}
+
+func (t *memoryRequestTokenTable) TakeRequestToken(token string) (*RequestToken, error) {
+	t.mutex.Lock()
+	typedItem, ok := t.tokens[token]
+	delete(t.tokens, token)
+	t.mutex.Unlock()
+
+	if !ok || typedItem.Expired() {
+		return nil, ErrNotFound
+	}
+
+	return &typedItem, nil
+}
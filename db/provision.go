@@ -0,0 +1,368 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ProvisionOptions configures Provisioner.Provision.
+type ProvisionOptions struct {
+	// NetworkIDs are the networks whose authorization tables are provisioned.
+	NetworkIDs []int
+	// BillingMode is the DynamoDB billing mode of the tables.
+	BillingMode string
+	// DryRun only reports the drift without changing anything.
+	DryRun bool
+}
+
+// Drift is a difference between the provisioned schema and the expected one.
+type Drift struct {
+	Table  string
+	Detail string
+	// Fixed is false if the drift has only been reported, either because of
+	// a dry run or because it can not be fixed automatically.
+	Fixed bool
+}
+
+func (d Drift) String() string {
+	status := "not fixed"
+	if d.Fixed {
+		status = "fixed"
+	}
+	return fmt.Sprintf("%s: %s (%s)", d.Table, d.Detail, status)
+}
+
+// dynamoDBTableSpec is the expected schema of a DynamoDB table.
+type dynamoDBTableSpec struct {
+	name       string
+	attributes []*dynamodb.AttributeDefinition
+	keySchema  []*dynamodb.KeySchemaElement
+	indexes    []dynamoDBIndexSpec
+	// ttlAttribute is the attribute holding the expiry time of the items,
+	// TTL is disabled if it is empty.
+	ttlAttribute string
+}
+
+type dynamoDBIndexSpec struct {
+	name      string
+	keySchema []*dynamodb.KeySchemaElement
+}
+
+func stringAttributes(names ...string) []*dynamodb.AttributeDefinition {
+	attributes := make([]*dynamodb.AttributeDefinition, len(names))
+	for i, name := range names {
+		attributes[i] = &dynamodb.AttributeDefinition{
+			AttributeName: aws.String(name),
+			AttributeType: aws.String(dynamodb.ScalarAttributeTypeS),
+		}
+	}
+	return attributes
+}
+
+// keySchema returns the key schema made of the hash key and the optional
+// range key.
+func keySchema(hashKey, rangeKey string) []*dynamodb.KeySchemaElement {
+	schema := []*dynamodb.KeySchemaElement{
+		{
+			AttributeName: aws.String(hashKey),
+			KeyType:       aws.String(dynamodb.KeyTypeHash),
+		},
+	}
+	if rangeKey != "" {
+		schema = append(schema, &dynamodb.KeySchemaElement{
+			AttributeName: aws.String(rangeKey),
+			KeyType:       aws.String(dynamodb.KeyTypeRange),
+		})
+	}
+	return schema
+}
+
+func defaultThroughput(billingMode string) *dynamodb.ProvisionedThroughput {
+	if billingMode == dynamodb.BillingModePayPerRequest {
+		return nil
+	}
+	return &dynamodb.ProvisionedThroughput{
+		ReadCapacityUnits:  aws.Int64(5),
+		WriteCapacityUnits: aws.Int64(5),
+	}
+}
+
+func (s *dynamoDBStore) tableSpecs(networkIDs []int) []dynamoDBTableSpec {
+	specs := []dynamoDBTableSpec{
+		twitterProfileTableSpec(),
+		profileTableSpec(),
+		oauthAppTableSpec(),
+		accountTableSpec(),
+		requestTokenTableSpec(),
+	}
+	for _, networkID := range networkIDs {
+		specs = append(specs,
+			getAuthorizationTable(networkID).tableSpec(),
+			getAuthorizationEventTable(networkID).tableSpec(),
+		)
+	}
+	return specs
+}
+
+// requiredTableNames are the environment variables naming the DynamoDB tables
+// the service uses.
+func requiredTableNames() map[string]string {
+	return map[string]string{
+		"AUTHORIZATION_TABLE_NAME":       authorizationTableName,
+		"AUTHORIZATION_EVENT_TABLE_NAME": authorizationEventTableName,
+		"TWITTER_PROFILE_TABLE_NAME":     twitterProfileTableName,
+		"PROFILE_TABLE_NAME":             profileTableName,
+		"OAUTH_APP_TABLE_NAME":           oauthAppTableName,
+		"ACCOUNT_TABLE_NAME":             accountTableName,
+		"REQUEST_TOKEN_TABLE_NAME":       requestTokenTableName,
+	}
+}
+
+// checkTableNames returns an error listing the table names which are not
+// set, rather than let DynamoDB reject the empty names.
+func checkTableNames() error {
+	missing := make([]string, 0)
+	for envName, tableName := range requiredTableNames() {
+		if tableName == "" {
+			missing = append(missing, envName)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%s must be set", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+func (s *dynamoDBStore) Provision(options ProvisionOptions) ([]Drift, error) {
+	if err := checkTableNames(); err != nil {
+		return nil, err
+	}
+	if options.BillingMode == "" {
+		options.BillingMode = dynamodb.BillingModePayPerRequest
+	}
+
+	drifts := make([]Drift, 0)
+	for _, spec := range s.tableSpecs(options.NetworkIDs) {
+		tableDrifts, err := provisionDynamoDBTable(spec, options)
+		drifts = append(drifts, tableDrifts...)
+		if err != nil {
+			return drifts, fmt.Errorf("%s: %s", spec.name, err)
+		}
+	}
+
+	return drifts, nil
+}
+
+// Verify checks that the global tables exist, the authorization tables are
+// verified the first time they are used.
+func (s *dynamoDBStore) Verify() error {
+	if err := checkTableNames(); err != nil {
+		return err
+	}
+	for _, spec := range s.tableSpecs(nil) {
+		if err := verifyDynamoDBTable(spec.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verifyDynamoDBTable(tableName string) error {
+	_, err := conn.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if isResourceNotFound(err) {
+		return fmt.Errorf("table %s does not exist, run the provision command", tableName)
+	}
+	return err
+}
+
+func isResourceNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeResourceNotFoundException
+}
+
+func provisionDynamoDBTable(spec dynamoDBTableSpec, options ProvisionOptions) ([]Drift, error) {
+	drifts := make([]Drift, 0)
+	report := func(fixable bool, format string, args ...interface{}) {
+		drifts = append(drifts, Drift{
+			Table:  spec.name,
+			Detail: fmt.Sprintf(format, args...),
+			Fixed:  fixable && !options.DryRun,
+		})
+	}
+
+	output, err := conn.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(spec.name),
+	})
+	if isResourceNotFound(err) {
+		report(true, "table does not exist")
+		if options.DryRun {
+			return drifts, nil
+		}
+		if err = createDynamoDBTable(spec, options.BillingMode); err != nil {
+			return drifts, err
+		}
+		return drifts, provisionTimeToLive(spec, options, report)
+	}
+	if err != nil {
+		return drifts, err
+	}
+	table := output.Table
+
+	if !sameKeySchema(table.KeySchema, spec.keySchema) {
+		report(false, "key schema differs, the table must be recreated")
+	}
+
+	billingMode := dynamodb.BillingModeProvisioned
+	if table.BillingModeSummary != nil {
+		billingMode = aws.StringValue(table.BillingModeSummary.BillingMode)
+	}
+	if billingMode != options.BillingMode {
+		report(true, "billing mode is %s instead of %s", billingMode, options.BillingMode)
+		if !options.DryRun {
+			err = updateDynamoDBTable(&dynamodb.UpdateTableInput{
+				TableName:             aws.String(spec.name),
+				BillingMode:           aws.String(options.BillingMode),
+				ProvisionedThroughput: defaultThroughput(options.BillingMode),
+			})
+			if err != nil {
+				return drifts, err
+			}
+		}
+	}
+
+	for _, index := range spec.indexes {
+		existing := findIndex(table.GlobalSecondaryIndexes, index.name)
+		if existing != nil {
+			if !sameKeySchema(existing.KeySchema, index.keySchema) {
+				report(false, "key schema of index %s differs, the index must be recreated", index.name)
+			}
+			continue
+		}
+
+		report(true, "index %s does not exist", index.name)
+		if options.DryRun {
+			continue
+		}
+		err = updateDynamoDBTable(&dynamodb.UpdateTableInput{
+			TableName:            aws.String(spec.name),
+			AttributeDefinitions: spec.attributes,
+			GlobalSecondaryIndexUpdates: []*dynamodb.GlobalSecondaryIndexUpdate{
+				{
+					Create: &dynamodb.CreateGlobalSecondaryIndexAction{
+						IndexName:             aws.String(index.name),
+						KeySchema:             index.keySchema,
+						Projection:            &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)},
+						ProvisionedThroughput: defaultThroughput(options.BillingMode),
+					},
+				},
+			},
+		})
+		if err != nil {
+			return drifts, err
+		}
+	}
+
+	return drifts, provisionTimeToLive(spec, options, report)
+}
+
+func provisionTimeToLive(spec dynamoDBTableSpec, options ProvisionOptions, report func(bool, string, ...interface{})) error {
+	if spec.ttlAttribute == "" {
+		return nil
+	}
+
+	output, err := conn.DescribeTimeToLive(&dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(spec.name),
+	})
+	if err != nil {
+		return err
+	}
+
+	description := output.TimeToLiveDescription
+	if description != nil &&
+		aws.StringValue(description.TimeToLiveStatus) != dynamodb.TimeToLiveStatusDisabled &&
+		aws.StringValue(description.AttributeName) == spec.ttlAttribute {
+		return nil
+	}
+
+	report(true, "TTL is not enabled on %s", spec.ttlAttribute)
+	if options.DryRun {
+		return nil
+	}
+	_, err = conn.UpdateTimeToLive(&dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(spec.name),
+		TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+			AttributeName: aws.String(spec.ttlAttribute),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	return err
+}
+
+func createDynamoDBTable(spec dynamoDBTableSpec, billingMode string) error {
+	input := &dynamodb.CreateTableInput{
+		TableName:             aws.String(spec.name),
+		AttributeDefinitions:  spec.attributes,
+		KeySchema:             spec.keySchema,
+		BillingMode:           aws.String(billingMode),
+		ProvisionedThroughput: defaultThroughput(billingMode),
+	}
+	for _, index := range spec.indexes {
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, &dynamodb.GlobalSecondaryIndex{
+			IndexName:             aws.String(index.name),
+			KeySchema:             index.keySchema,
+			Projection:            &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)},
+			ProvisionedThroughput: defaultThroughput(billingMode),
+		})
+	}
+
+	if _, err := conn.CreateTable(input); err != nil {
+		return err
+	}
+	return waitUntilTableActive(spec.name)
+}
+
+// updateDynamoDBTable applies the update and waits for it to complete since
+// DynamoDB rejects the updates of a table which is being updated.
+func updateDynamoDBTable(input *dynamodb.UpdateTableInput) error {
+	if _, err := conn.UpdateTable(input); err != nil {
+		return err
+	}
+	return waitUntilTableActive(aws.StringValue(input.TableName))
+}
+
+func waitUntilTableActive(tableName string) error {
+	return conn.WaitUntilTableExists(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+}
+
+func findIndex(indexes []*dynamodb.GlobalSecondaryIndexDescription, name string) *dynamodb.GlobalSecondaryIndexDescription {
+	for _, index := range indexes {
+		if aws.StringValue(index.IndexName) == name {
+			return index
+		}
+	}
+	return nil
+}
+
+func sameKeySchema(a, b []*dynamodb.KeySchemaElement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if aws.StringValue(a[i].AttributeName) != aws.StringValue(b[i].AttributeName) ||
+			aws.StringValue(a[i].KeyType) != aws.StringValue(b[i].KeyType) {
+			return false
+		}
+	}
+	return true
+}
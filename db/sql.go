@@ -0,0 +1,835 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	goTwitter "github.com/dghubble/go-twitter/twitter"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLStore is a Store backed by SQLite or Postgres.
+type SQLStore struct {
+	db         *sql.DB
+	driverName string
+}
+
+// NewSQLStore opens the database, driverName is either "sqlite3" or
+// "postgres".
+func NewSQLStore(driverName, dataSourceName string) (*SQLStore, error) {
+	conn, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLStore{
+		db:         conn,
+		driverName: driverName,
+	}, nil
+}
+
+// Provision applies the migrations which have not been applied yet.
+func (s *SQLStore) Provision(options ProvisionOptions) ([]Drift, error) {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL PRIMARY KEY)`)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := s.schemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	drifts := make([]Drift, 0)
+	for i := version; i < len(sqlMigrations); i++ {
+		drifts = append(drifts, Drift{
+			Table:  "schema_migrations",
+			Detail: fmt.Sprintf("migration %d is not applied", i+1),
+			Fixed:  !options.DryRun,
+		})
+		if options.DryRun {
+			continue
+		}
+		if err = s.applyMigration(i+1, sqlMigrations[i]); err != nil {
+			return drifts, fmt.Errorf("migration %d: %s", i+1, err)
+		}
+	}
+
+	return drifts, nil
+}
+
+// Verify checks that all the migrations have been applied.
+func (s *SQLStore) Verify() error {
+	version, err := s.schemaVersion()
+	if err != nil {
+		return fmt.Errorf("could not read the schema version, run the provision command: %s", err)
+	}
+	if version != len(sqlMigrations) {
+		return fmt.Errorf("schema version is %d instead of %d, run the provision command", version, len(sqlMigrations))
+	}
+
+	return nil
+}
+
+func (s *SQLStore) schemaVersion() (int, error) {
+	var version sql.NullInt64
+	err := s.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(version.Int64), nil
+}
+
+func (s *SQLStore) applyMigration(version int, statements []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range statements {
+		if _, err = tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec(s.rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), version)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// rebind replaces the "?" placeholders with "$1", "$2"... for Postgres.
+func (s *SQLStore) rebind(query string) string {
+	if s.driverName != "postgres" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func (s *SQLStore) AuthorizationTable(networkID int) AuthorizationStore {
+	return &sqlAuthorizationTable{
+		store:     s,
+		networkID: networkID,
+	}
+}
+
+func (s *SQLStore) AuthorizationEventTable(networkID int) AuthorizationEventStore {
+	return &sqlAuthorizationEventTable{
+		store:     s,
+		networkID: networkID,
+	}
+}
+
+func (s *SQLStore) TwitterProfileTable() TwitterProfileStore {
+	return &sqlTwitterProfileTable{store: s}
+}
+
+func (s *SQLStore) ProfileTable() ProfileStore {
+	return &sqlProfileTable{store: s}
+}
+
+func (s *SQLStore) OAuthAppTable() OAuthAppStore {
+	return &sqlOAuthAppTable{store: s}
+}
+
+func (s *SQLStore) AccountInfoTable() AccountInfoStore {
+	return &sqlAccountInfoTable{store: s}
+}
+
+func (s *SQLStore) RequestTokenTable() RequestTokenStore {
+	return &sqlRequestTokenTable{store: s}
+}
+
+type sqlAuthorizationTable struct {
+	store     *SQLStore
+	networkID int
+}
+
+// sqlAuthorizationColumns are the columns holding the fields of an
+// AuthorizationItem, in the order of sqlAuthorizationValues and
+// sqlAuthorizationFields.
+var sqlAuthorizationColumns = []string{
+	"user_address",
+	"platform_name",
+	"username",
+	"proof_url",
+	"status",
+	"verified",
+	"verified_at",
+	"failure_reason",
+	"checked_at",
+	"attempts",
+	"proof_payload",
+	"user_id",
+	"linked_at",
+	"revoked_at",
+}
+
+func sqlAuthorizationValues(item AuthorizationItem) []interface{} {
+	return []interface{}{
+		item.UserAddress,
+		string(item.PlatformName),
+		item.Username,
+		item.ProofURL,
+		string(item.Status),
+		item.Verified,
+		item.VerifiedAt,
+		item.FailureReason,
+		item.CheckedAt,
+		item.Attempts,
+		item.ProofPayload,
+		item.UserID,
+		item.LinkedAt,
+		item.RevokedAt,
+	}
+}
+
+func sqlAuthorizationFields(item *AuthorizationItem) []interface{} {
+	return []interface{}{
+		&item.UserAddress,
+		&item.PlatformName,
+		&item.Username,
+		&item.ProofURL,
+		&item.Status,
+		&item.Verified,
+		&item.VerifiedAt,
+		&item.FailureReason,
+		&item.CheckedAt,
+		&item.Attempts,
+		&item.ProofPayload,
+		&item.UserID,
+		&item.LinkedAt,
+		&item.RevokedAt,
+	}
+}
+
+func (t *sqlAuthorizationTable) PutAuthorizationItem(item AuthorizationItem) error {
+	columns := append([]string{"network_id", "username_normalized"}, sqlAuthorizationColumns...)
+	updates := make([]string, 0, len(columns))
+	for _, column := range columns {
+		switch column {
+		case "network_id", "user_address", "platform_name":
+		default:
+			updates = append(updates, column+" = excluded."+column)
+		}
+	}
+
+	query := t.store.rebind(`INSERT INTO authorizations (` + strings.Join(columns, ", ") + `)
+		VALUES (` + sqlPlaceholders(len(columns)) + `)
+		ON CONFLICT (network_id, user_address, platform_name) DO UPDATE SET ` + strings.Join(updates, ", "))
+	args := append([]interface{}{t.networkID, NormalizeUsername(item.Username)}, sqlAuthorizationValues(item)...)
+	_, err := t.store.db.Exec(query, args...)
+
+	return err
+}
+
+func (t *sqlAuthorizationTable) GetAuthorizationItem(userAddress string, platformName PlatformName) (*AuthorizationItem, error) {
+	query := t.store.rebind(`SELECT ` + strings.Join(sqlAuthorizationColumns, ", ") + ` FROM authorizations
+		WHERE network_id = ? AND user_address = ? AND platform_name = ?`)
+
+	var item AuthorizationItem
+	err := t.store.db.QueryRow(query, t.networkID, userAddress, string(platformName)).
+		Scan(sqlAuthorizationFields(&item)...)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+func sqlPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+var (
+	sqlPlatformOrder    = []string{"platform_name"}
+	sqlUserAddressOrder = []string{"user_address", "platform_name"}
+	sqlUsernameOrder    = []string{"username_normalized", "user_address", "platform_name"}
+)
+
+func (t *sqlAuthorizationTable) GetAuthorizationItemsByUserAddress(userAddress string, limit int, after string) ([]AuthorizationItem, string, error) {
+	return t.query(`user_address = ?`, userAddress, sqlPlatformOrder, limit, after)
+}
+
+func (t *sqlAuthorizationTable) GetAuthorizationItemsByUsername(username string, limit int, after string) ([]AuthorizationItem, string, error) {
+	return t.query(`username_normalized = ?`, NormalizeUsername(username), sqlUsernameOrder, limit, after)
+}
+
+func (t *sqlAuthorizationTable) GetAuthorizationItemsByUsernamePrefix(usernamePrefix string, limit int, after string) ([]AuthorizationItem, string, error) {
+	normalized := NormalizeUsername(usernamePrefix)
+	if normalized == "" {
+		return []AuthorizationItem{}, "", nil
+	}
+	return t.query(`username_normalized LIKE ? ESCAPE '\'`, escapeLike(normalized)+"%", sqlUsernameOrder, limit, after)
+}
+
+func (t *sqlAuthorizationTable) ScanAuthorizationItems(platformName PlatformName, limit int, after string) ([]AuthorizationItem, string, error) {
+	return t.query(`platform_name = ?`, string(platformName), sqlUserAddressOrder, limit, after)
+}
+
+// query returns at most limit items matching condition ordered by the order
+// columns, the positions are the JSON encoded order column values of the last
+// returned items.
+func (t *sqlAuthorizationTable) query(condition string, arg interface{}, order []string, limit int, after string) ([]AuthorizationItem, string, error) {
+	args := []interface{}{t.networkID, arg}
+	query := `SELECT ` + strings.Join(sqlAuthorizationColumns, ", ") + `, ` + strings.Join(order, ", ") + `
+		FROM authorizations
+		WHERE network_id = ? AND ` + condition
+
+	if after != "" {
+		var afterKey []string
+		if err := json.Unmarshal([]byte(after), &afterKey); err != nil || len(afterKey) != len(order) {
+			return nil, "", ErrInvalidPosition
+		}
+		query += ` AND (` + strings.Join(order, ", ") + `) > (` + sqlPlaceholders(len(order)) + `)`
+		for _, v := range afterKey {
+			args = append(args, v)
+		}
+	}
+
+	query += ` ORDER BY ` + strings.Join(order, ", ")
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit+1)
+	}
+
+	rows, err := t.store.db.Query(t.store.rebind(query), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	items := make([]AuthorizationItem, 0)
+	var lastKey []string
+	for rows.Next() {
+		if limit > 0 && len(items) == limit {
+			next, err := json.Marshal(lastKey)
+			return items, string(next), err
+		}
+
+		var item AuthorizationItem
+		key := make([]string, len(order))
+		dest := sqlAuthorizationFields(&item)
+		for i := range key {
+			dest = append(dest, &key[i])
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, "", err
+		}
+		items = append(items, item)
+		lastKey = key
+	}
+
+	return items, "", rows.Err()
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+type sqlAuthorizationEventTable struct {
+	store     *SQLStore
+	networkID int
+}
+
+// sqlAuthorizationEventColumns are the columns holding the fields of an
+// AuthorizationEvent, in the order of sqlAuthorizationEventFields.
+var sqlAuthorizationEventColumns = []string{
+	"user_address",
+	"event_id",
+	"platform_name",
+	"type",
+	"actor",
+	"operator",
+	"reason",
+	"status",
+	"username",
+	"user_id",
+	"proof_url",
+	"proof_payload",
+	"created_at",
+}
+
+func sqlAuthorizationEventFields(event *AuthorizationEvent) []interface{} {
+	return []interface{}{
+		&event.UserAddress,
+		&event.EventID,
+		&event.PlatformName,
+		&event.Type,
+		&event.Actor,
+		&event.Operator,
+		&event.Reason,
+		&event.Status,
+		&event.Username,
+		&event.UserID,
+		&event.ProofURL,
+		&event.ProofPayload,
+		&event.CreatedAt,
+	}
+}
+
+// AppendAuthorizationEvent returns ErrEventExists rather than replace an
+// existing event, the primary key rejects the events appended concurrently.
+func (t *sqlAuthorizationEventTable) AppendAuthorizationEvent(event AuthorizationEvent) error {
+	query := t.store.rebind(`INSERT INTO authorization_events (network_id, ` + strings.Join(sqlAuthorizationEventColumns, ", ") + `)
+		VALUES (` + sqlPlaceholders(len(sqlAuthorizationEventColumns)+1) + `)
+		ON CONFLICT (network_id, user_address, event_id) DO NOTHING`)
+	result, err := t.store.db.Exec(query,
+		t.networkID,
+		event.UserAddress,
+		event.EventID,
+		string(event.PlatformName),
+		string(event.Type),
+		event.Actor,
+		event.Operator,
+		event.Reason,
+		string(event.Status),
+		event.Username,
+		event.UserID,
+		event.ProofURL,
+		event.ProofPayload,
+		event.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	// only the caller which inserts the row appends the event
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted != 1 {
+		return ErrEventExists
+	}
+
+	return nil
+}
+
+// GetAuthorizationEvents returns the events of the address ordered by ID, the
+// positions are the IDs of the last returned events.
+func (t *sqlAuthorizationEventTable) GetAuthorizationEvents(userAddress string, limit int, after string) ([]AuthorizationEvent, string, error) {
+	args := []interface{}{t.networkID, userAddress, after}
+	query := `SELECT ` + strings.Join(sqlAuthorizationEventColumns, ", ") + ` FROM authorization_events
+		WHERE network_id = ? AND user_address = ? AND event_id > ?
+		ORDER BY event_id`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit+1)
+	}
+
+	rows, err := t.store.db.Query(t.store.rebind(query), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	events := make([]AuthorizationEvent, 0)
+	for rows.Next() {
+		if limit > 0 && len(events) == limit {
+			return events, events[limit-1].EventID, nil
+		}
+
+		var event AuthorizationEvent
+		if err = rows.Scan(sqlAuthorizationEventFields(&event)...); err != nil {
+			return nil, "", err
+		}
+		events = append(events, event)
+	}
+
+	return events, "", rows.Err()
+}
+
+type sqlTwitterProfileTable struct {
+	store *SQLStore
+}
+
+// PutTwitterProfile updates the profile and releases its screen name in a
+// transaction, the released profiles have an empty screen_name_normalized.
+func (t *sqlTwitterProfileTable) PutTwitterProfile(user goTwitter.User, seenAt time.Time) (*TwitterProfile, error) {
+	tx, err := t.store.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := t.putTwitterProfile(tx, user, seenAt)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return profile, tx.Commit()
+}
+
+func (t *sqlTwitterProfileTable) putTwitterProfile(tx *sql.Tx, user goTwitter.User, seenAt time.Time) (*TwitterProfile, error) {
+	stored, err := scanTwitterProfile(tx.QueryRow(t.store.rebind(`SELECT profile FROM twitter_profiles WHERE id_str = ?`), user.IDStr))
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	profile := nextTwitterProfile(stored, user, seenAt)
+
+	normalized := NormalizeUsername(user.ScreenName)
+	holders, err := t.queryProfiles(tx, `screen_name_normalized = ? AND id_str <> ?`, normalized, user.IDStr)
+	if err != nil {
+		return nil, err
+	}
+	for _, holder := range holders {
+		if err = t.upsert(tx, releaseTwitterProfile(holder)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = t.upsert(tx, profile); err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+func (t *sqlTwitterProfileTable) upsert(tx *sql.Tx, profile TwitterProfile) error {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+
+	normalized := ""
+	if !profile.ScreenNameReleased {
+		normalized = NormalizeUsername(profile.ScreenName)
+	}
+
+	query := t.store.rebind(`INSERT INTO twitter_profiles (id_str, screen_name_normalized, profile, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (id_str) DO UPDATE SET
+			screen_name_normalized = excluded.screen_name_normalized,
+			profile = excluded.profile,
+			updated_at = excluded.updated_at`)
+	_, err = tx.Exec(query, profile.IDStr, normalized, string(data), profile.UpdatedAt)
+
+	return err
+}
+
+func (t *sqlTwitterProfileTable) GetTwitterProfile(userID string) (*TwitterProfile, error) {
+	query := t.store.rebind(`SELECT profile FROM twitter_profiles WHERE id_str = ?`)
+	return scanTwitterProfile(t.store.db.QueryRow(query, userID))
+}
+
+func (t *sqlTwitterProfileTable) GetTwitterProfileByScreenName(screenName string) (*TwitterProfile, error) {
+	normalized := NormalizeUsername(screenName)
+	if normalized == "" {
+		return nil, ErrNotFound
+	}
+
+	query := t.store.rebind(`SELECT profile FROM twitter_profiles WHERE screen_name_normalized = ?
+		ORDER BY updated_at DESC LIMIT 1`)
+	return scanTwitterProfile(t.store.db.QueryRow(query, normalized))
+}
+
+func scanTwitterProfile(row *sql.Row) (*TwitterProfile, error) {
+	var data string
+	err := row.Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var profile TwitterProfile
+	if err = json.Unmarshal([]byte(data), &profile); err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+func (t *sqlTwitterProfileTable) BatchGetTwitterProfiles(userIDs []string) (map[string]TwitterProfile, error) {
+	mappedItems := make(map[string]TwitterProfile)
+	if len(userIDs) < 1 {
+		return mappedItems, nil
+	}
+
+	args := make([]interface{}, len(userIDs))
+	for i, userID := range userIDs {
+		args[i] = userID
+	}
+
+	profiles, err := t.queryProfiles(t.store.db, `id_str IN (`+sqlPlaceholders(len(userIDs))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, profile := range profiles {
+		mappedItems[profile.IDStr] = profile
+	}
+
+	return mappedItems, nil
+}
+
+func (t *sqlTwitterProfileTable) BatchGetTwitterProfilesByScreenName(screenNames []string) (map[string]TwitterProfile, error) {
+	mappedItems := make(map[string]TwitterProfile)
+	if len(screenNames) < 1 {
+		return mappedItems, nil
+	}
+
+	args := make([]interface{}, len(screenNames))
+	for i, screenName := range screenNames {
+		args[i] = NormalizeUsername(screenName)
+	}
+
+	profiles, err := t.queryProfiles(t.store.db, `screen_name_normalized IN (`+sqlPlaceholders(len(screenNames))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, profile := range profiles {
+		normalized := NormalizeUsername(profile.ScreenName)
+		if existing, ok := mappedItems[normalized]; !ok || profile.UpdatedAt.After(existing.UpdatedAt) {
+			mappedItems[normalized] = profile
+		}
+	}
+
+	return mappedItems, nil
+}
+
+// sqlQueryer is implemented by both *sql.DB and *sql.Tx.
+type sqlQueryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (t *sqlTwitterProfileTable) queryProfiles(q sqlQueryer, condition string, args ...interface{}) ([]TwitterProfile, error) {
+	rows, err := q.Query(t.store.rebind(`SELECT profile FROM twitter_profiles WHERE `+condition), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := make([]TwitterProfile, 0)
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var profile TwitterProfile
+		if err = json.Unmarshal([]byte(data), &profile); err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, rows.Err()
+}
+
+type sqlProfileTable struct {
+	store *SQLStore
+}
+
+func (t *sqlProfileTable) PutProfile(profile Profile) error {
+	query := t.store.rebind(`INSERT INTO profiles
+		(platform_name, username_normalized, username, user_id, data, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (platform_name, username_normalized) DO UPDATE SET
+			username = excluded.username,
+			user_id = excluded.user_id,
+			data = excluded.data,
+			updated_at = excluded.updated_at`)
+	_, err := t.store.db.Exec(query,
+		string(profile.PlatformName),
+		NormalizeUsername(profile.Username),
+		profile.Username,
+		profile.UserID,
+		string(profile.Data),
+		profile.UpdatedAt,
+	)
+
+	return err
+}
+
+func (t *sqlProfileTable) GetProfile(platformName PlatformName, username string) (*Profile, error) {
+	query := t.store.rebind(`SELECT username, user_id, data, updated_at FROM profiles
+		WHERE platform_name = ? AND username_normalized = ?`)
+
+	profile := Profile{PlatformName: platformName}
+	var data string
+	err := t.store.db.QueryRow(query, string(platformName), NormalizeUsername(username)).
+		Scan(&profile.Username, &profile.UserID, &data, &profile.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	profile.Data = json.RawMessage(data)
+
+	return &profile, nil
+}
+
+func (t *sqlProfileTable) BatchGetProfiles(platformName PlatformName, usernames []string) (map[string]Profile, error) {
+	mappedItems := make(map[string]Profile)
+	if len(usernames) < 1 {
+		return mappedItems, nil
+	}
+
+	args := []interface{}{string(platformName)}
+	for _, username := range usernames {
+		args = append(args, NormalizeUsername(username))
+	}
+
+	query := t.store.rebind(`SELECT username_normalized, username, user_id, data, updated_at FROM profiles
+		WHERE platform_name = ? AND username_normalized IN (` + sqlPlaceholders(len(usernames)) + `)`)
+	rows, err := t.store.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		profile := Profile{PlatformName: platformName}
+		var normalized, data string
+		if err = rows.Scan(&normalized, &profile.Username, &profile.UserID, &data, &profile.UpdatedAt); err != nil {
+			return nil, err
+		}
+		profile.Data = json.RawMessage(data)
+		mappedItems[normalized] = profile
+	}
+
+	return mappedItems, rows.Err()
+}
+
+type sqlOAuthAppTable struct {
+	store *SQLStore
+}
+
+func (t *sqlOAuthAppTable) CreateOAuthApp(app OAuthApp) (*OAuthApp, error) {
+	query := t.store.rebind(`INSERT INTO oauth_apps
+		(platform_name, instance, client_id, client_secret, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (platform_name, instance) DO NOTHING`)
+	_, err := t.store.db.Exec(query,
+		string(app.PlatformName),
+		app.Instance,
+		app.ClientID,
+		app.ClientSecret,
+		app.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.GetOAuthApp(app.PlatformName, app.Instance)
+}
+
+func (t *sqlOAuthAppTable) GetOAuthApp(platformName PlatformName, instance string) (*OAuthApp, error) {
+	query := t.store.rebind(`SELECT client_id, client_secret, created_at FROM oauth_apps
+		WHERE platform_name = ? AND instance = ?`)
+
+	app := OAuthApp{
+		PlatformName: platformName,
+		Instance:     instance,
+	}
+	err := t.store.db.QueryRow(query, string(platformName), instance).
+		Scan(&app.ClientID, &app.ClientSecret, &app.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &app, nil
+}
+
+type sqlAccountInfoTable struct {
+	store *SQLStore
+}
+
+func (t *sqlAccountInfoTable) PutAccountInfo(info AccountInfo) error {
+	query := t.store.rebind(`INSERT INTO account_info
+		(email, user_address, name, msg, sig, valid_sig, ref, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (email, user_address) DO UPDATE SET
+			name = excluded.name,
+			msg = excluded.msg,
+			sig = excluded.sig,
+			valid_sig = excluded.valid_sig,
+			ref = excluded.ref,
+			created_at = excluded.created_at`)
+	_, err := t.store.db.Exec(query,
+		info.Email,
+		info.UserAddress,
+		info.Name,
+		info.Msg,
+		info.Sig,
+		info.ValidSig,
+		info.Ref,
+		info.CreatedAt,
+	)
+
+	return err
+}
+
+type sqlRequestTokenTable struct {
+	store *SQLStore
+}
+
+func (t *sqlRequestTokenTable) PutRequestToken(token RequestToken) error {
+	_, err := t.store.db.Exec(t.store.rebind(`DELETE FROM request_tokens WHERE expires_at <= ?`), time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	query := t.store.rebind(`INSERT INTO request_tokens (token, secret, platform_name, expires_at) VALUES (?, ?, ?, ?)`)
+	_, err = t.store.db.Exec(query, token.Token, token.Secret, string(token.PlatformName), token.ExpiresAt)
+
+	return err
+}
+
+func (t *sqlRequestTokenTable) TakeRequestToken(token string) (*RequestToken, error) {
+	typedItem := RequestToken{Token: token}
+	query := t.store.rebind(`SELECT secret, platform_name, expires_at FROM request_tokens WHERE token = ?`)
+	err := t.store.db.QueryRow(query, token).Scan(&typedItem.Secret, &typedItem.PlatformName, &typedItem.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// only the caller which deletes the row gets the token
+	result, err := t.store.db.Exec(t.store.rebind(`DELETE FROM request_tokens WHERE token = ?`), token)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if deleted != 1 || typedItem.Expired() {
+		return nil, ErrNotFound
+	}
+
+	return &typedItem, nil
+}
@@ -0,0 +1,128 @@
+package db
+
+// sqlMigrations is the schema of the SQL backend, the statements are written
+// in the subset of SQL understood by both SQLite and Postgres. Migrations are
+// applied in order and must never be edited once released, append a new one
+// instead.
+var sqlMigrations = [][]string{
+	// 1: initial schema
+	{
+		`CREATE TABLE authorizations (
+			network_id    INTEGER   NOT NULL,
+			user_address  TEXT      NOT NULL,
+			platform_name TEXT      NOT NULL,
+			username      TEXT      NOT NULL,
+			proof_url     TEXT      NOT NULL,
+			verified      BOOLEAN   NOT NULL,
+			verified_at   TIMESTAMP NOT NULL,
+			PRIMARY KEY (network_id, user_address, platform_name)
+		)`,
+		`CREATE INDEX authorizations_username ON authorizations (network_id, username)`,
+		`CREATE TABLE twitter_oauth (
+			screen_name TEXT NOT NULL PRIMARY KEY,
+			profile     TEXT NOT NULL
+		)`,
+		`CREATE TABLE account_info (
+			email        TEXT      NOT NULL,
+			user_address TEXT      NOT NULL,
+			name         TEXT      NOT NULL,
+			msg          TEXT      NOT NULL,
+			sig          TEXT      NOT NULL,
+			valid_sig    BOOLEAN   NOT NULL,
+			ref          TEXT      NOT NULL,
+			created_at   TIMESTAMP NOT NULL,
+			PRIMARY KEY (email, user_address)
+		)`,
+	},
+	// 2: normalized username lookups
+	{
+		`ALTER TABLE authorizations ADD COLUMN username_normalized TEXT NOT NULL DEFAULT ''`,
+		`UPDATE authorizations SET username_normalized = LOWER(TRIM(username))`,
+		`DROP INDEX authorizations_username`,
+		`CREATE INDEX authorizations_username_normalized ON authorizations (network_id, username_normalized)`,
+	},
+	// 3: proof verification failures
+	{
+		`ALTER TABLE authorizations ADD COLUMN failure_reason TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE authorizations ADD COLUMN checked_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00'`,
+	},
+	// 4: OAuth request tokens
+	{
+		`CREATE TABLE request_tokens (
+			token         TEXT   NOT NULL PRIMARY KEY,
+			secret        TEXT   NOT NULL,
+			platform_name TEXT   NOT NULL,
+			expires_at    BIGINT NOT NULL
+		)`,
+	},
+	// 5: profiles of the platforms other than Twitter
+	{
+		`CREATE TABLE profiles (
+			platform_name       TEXT      NOT NULL,
+			username_normalized TEXT      NOT NULL,
+			username            TEXT      NOT NULL,
+			user_id             TEXT      NOT NULL,
+			data                TEXT      NOT NULL,
+			updated_at          TIMESTAMP NOT NULL,
+			PRIMARY KEY (platform_name, username_normalized)
+		)`,
+	},
+	// 6: applications registered on the federated instances
+	{
+		`CREATE TABLE oauth_apps (
+			platform_name TEXT      NOT NULL,
+			instance      TEXT      NOT NULL,
+			client_id     TEXT      NOT NULL,
+			client_secret TEXT      NOT NULL,
+			created_at    TIMESTAMP NOT NULL,
+			PRIMARY KEY (platform_name, instance)
+		)`,
+	},
+	// 7: accounts linked to the addresses through the logins
+	{
+		`ALTER TABLE authorizations ADD COLUMN user_id TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE authorizations ADD COLUMN linked_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00'`,
+	},
+	// 8: Twitter profiles keyed by user ID, the profiles of twitter_oauth are
+	// copied by the backfill command
+	{
+		`CREATE TABLE twitter_profiles (
+			id_str                 TEXT      NOT NULL PRIMARY KEY,
+			screen_name_normalized TEXT      NOT NULL,
+			profile                TEXT      NOT NULL,
+			updated_at             TIMESTAMP NOT NULL
+		)`,
+		`CREATE INDEX twitter_profiles_screen_name ON twitter_profiles (screen_name_normalized)`,
+	},
+	// 9: proofs revoked by the sweep
+	{
+		`ALTER TABLE authorizations ADD COLUMN revoked_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00'`,
+	},
+	// 10: states of the proofs, the existing rows have no status and read
+	// as before
+	{
+		`ALTER TABLE authorizations ADD COLUMN status TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE authorizations ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE authorizations ADD COLUMN proof_payload TEXT NOT NULL DEFAULT ''`,
+	},
+	// 11: append-only history of the authorizations
+	{
+		`CREATE TABLE authorization_events (
+			network_id    INTEGER   NOT NULL,
+			user_address  TEXT      NOT NULL,
+			event_id      TEXT      NOT NULL,
+			platform_name TEXT      NOT NULL,
+			type          TEXT      NOT NULL,
+			actor         TEXT      NOT NULL,
+			operator      TEXT      NOT NULL,
+			reason        TEXT      NOT NULL,
+			status        TEXT      NOT NULL,
+			username      TEXT      NOT NULL,
+			user_id       TEXT      NOT NULL,
+			proof_url     TEXT      NOT NULL,
+			proof_payload TEXT      NOT NULL,
+			created_at    TIMESTAMP NOT NULL,
+			PRIMARY KEY (network_id, user_address, event_id)
+		)`,
+	},
+}
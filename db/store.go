@@ -0,0 +1,226 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	goTwitter "github.com/dghubble/go-twitter/twitter"
+)
+
+// AuthorizationStore keeps the social proofs of one Ethereum network.
+//
+// The lookups return at most limit items, limit < 1 means no limit. They
+// resume after the position returned by the previous call and return an
+// empty position once the results are exhausted. Positions are specific to
+// the backend and must be treated as opaque.
+type AuthorizationStore interface {
+	PutAuthorizationItem(item AuthorizationItem) error
+	GetAuthorizationItem(userAddress string, platformName PlatformName) (*AuthorizationItem, error)
+	GetAuthorizationItemsByUserAddress(userAddress string, limit int, after string) ([]AuthorizationItem, string, error)
+	// GetAuthorizationItemsByUsername and GetAuthorizationItemsByUsernamePrefix
+	// compare normalized usernames.
+	GetAuthorizationItemsByUsername(username string, limit int, after string) ([]AuthorizationItem, string, error)
+	GetAuthorizationItemsByUsernamePrefix(usernamePrefix string, limit int, after string) ([]AuthorizationItem, string, error)
+	// ScanAuthorizationItems walks through the authorizations of the
+	// platform in no particular order.
+	ScanAuthorizationItems(platformName PlatformName, limit int, after string) ([]AuthorizationItem, string, error)
+}
+
+// AuthorizationEventStore keeps the history of the authorizations of one
+// Ethereum network, the events can only be appended. The events of an address
+// are returned oldest first, the positions are as in AuthorizationStore.
+type AuthorizationEventStore interface {
+	AppendAuthorizationEvent(event AuthorizationEvent) error
+	GetAuthorizationEvents(userAddress string, limit int, after string) ([]AuthorizationEvent, string, error)
+}
+
+// TwitterProfileStore keeps the Twitter profiles of the users who logged in
+// by user ID. A screen name only finds the profile which last logged in with
+// it, the screen names are compared normalized.
+type TwitterProfileStore interface {
+	// PutTwitterProfile records the user seen by a login and returns its
+	// updated profile, the other profiles holding its screen name are
+	// released.
+	PutTwitterProfile(user goTwitter.User, seenAt time.Time) (*TwitterProfile, error)
+	GetTwitterProfile(userID string) (*TwitterProfile, error)
+	GetTwitterProfileByScreenName(screenName string) (*TwitterProfile, error)
+	// BatchGetTwitterProfiles maps the profiles found by user ID.
+	BatchGetTwitterProfiles(userIDs []string) (map[string]TwitterProfile, error)
+	// BatchGetTwitterProfilesByScreenName maps the profiles found by
+	// normalized screen name.
+	BatchGetTwitterProfilesByScreenName(screenNames []string) (map[string]TwitterProfile, error)
+}
+
+// ProfileStore keeps the profiles of the users who logged in with the
+// platforms which do not have a table of their own. The profiles are looked
+// up by normalized username and BatchGetProfiles maps them by normalized
+// username.
+type ProfileStore interface {
+	PutProfile(profile Profile) error
+	GetProfile(platformName PlatformName, username string) (*Profile, error)
+	BatchGetProfiles(platformName PlatformName, usernames []string) (map[string]Profile, error)
+}
+
+// OAuthAppStore keeps the applications registered on the instances of the
+// federated platforms.
+type OAuthAppStore interface {
+	// CreateOAuthApp stores the app unless one has already been registered
+	// on the instance, in which case the existing app is returned.
+	CreateOAuthApp(app OAuthApp) (*OAuthApp, error)
+	GetOAuthApp(platformName PlatformName, instance string) (*OAuthApp, error)
+}
+
+// AccountInfoStore keeps the account info submitted by the users.
+type AccountInfoStore interface {
+	PutAccountInfo(info AccountInfo) error
+}
+
+// RequestTokenStore keeps the secrets of the logins in progress.
+type RequestTokenStore interface {
+	PutRequestToken(token RequestToken) error
+	// TakeRequestToken deletes the token and returns it, ErrNotFound is
+	// returned for the unknown, expired and already taken tokens.
+	TakeRequestToken(token string) (*RequestToken, error)
+}
+
+// Store is a storage backend.
+type Store interface {
+	AuthorizationTable(networkID int) AuthorizationStore
+	AuthorizationEventTable(networkID int) AuthorizationEventStore
+	TwitterProfileTable() TwitterProfileStore
+	ProfileTable() ProfileStore
+	OAuthAppTable() OAuthAppStore
+	AccountInfoTable() AccountInfoStore
+	RequestTokenTable() RequestTokenStore
+}
+
+// Storage backend names accepted by NewStore.
+const (
+	DynamoDBBackend = "dynamodb"
+	MemoryBackend   = "memory"
+	SQLiteBackend   = "sqlite3"
+	PostgresBackend = "postgres"
+)
+
+// Provisioner is implemented by the backends whose schema must be created
+// before use.
+type Provisioner interface {
+	// Provision creates or updates the schema idempotently and returns the
+	// differences it found with the expected schema.
+	Provision(options ProvisionOptions) ([]Drift, error)
+	// Verify checks that the schema has been provisioned.
+	Verify() error
+}
+
+var (
+	store     Store
+	storeOnce sync.Once
+)
+
+// getStore returns the store set by SetStore or opens the one configured by
+// the environment the first time it is called.
+func getStore() Store {
+	storeOnce.Do(func() {
+		if store != nil {
+			return
+		}
+
+		s, err := NewStore(os.Getenv("DB_BACKEND"), os.Getenv("DB_DSN"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if p, ok := s.(Provisioner); ok {
+			if err = p.Verify(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		store = s
+	})
+
+	return store
+}
+
+// NewStore creates the storage backend with the given name, DynamoDB is used
+// if the name is empty. dataSourceName is only used by the SQL backends. The
+// schema is not verified.
+func NewStore(backend, dataSourceName string) (Store, error) {
+	switch backend {
+	case "", DynamoDBBackend:
+		return NewDynamoDBStore()
+	case MemoryBackend:
+		return NewMemoryStore(), nil
+	case SQLiteBackend, PostgresBackend:
+		return NewSQLStore(backend, dataSourceName)
+	}
+
+	return nil, fmt.Errorf("unknown storage backend %q", backend)
+}
+
+// SetStore replaces the storage backend used by the package level functions.
+func SetStore(s Store) {
+	storeOnce.Do(func() {})
+	store = s
+}
+
+func GetAuthorizationTable(networkID int) AuthorizationStore {
+	return getStore().AuthorizationTable(networkID)
+}
+
+func GetAuthorizationEventTable(networkID int) AuthorizationEventStore {
+	return getStore().AuthorizationEventTable(networkID)
+}
+
+func PutTwitterProfile(user goTwitter.User, seenAt time.Time) (*TwitterProfile, error) {
+	return getStore().TwitterProfileTable().PutTwitterProfile(user, seenAt)
+}
+
+func GetTwitterProfile(userID string) (*TwitterProfile, error) {
+	return getStore().TwitterProfileTable().GetTwitterProfile(userID)
+}
+
+func GetTwitterProfileByScreenName(screenName string) (*TwitterProfile, error) {
+	return getStore().TwitterProfileTable().GetTwitterProfileByScreenName(screenName)
+}
+
+func BatchGetTwitterProfiles(userIDs []string) (map[string]TwitterProfile, error) {
+	return getStore().TwitterProfileTable().BatchGetTwitterProfiles(userIDs)
+}
+
+func BatchGetTwitterProfilesByScreenName(screenNames []string) (map[string]TwitterProfile, error) {
+	return getStore().TwitterProfileTable().BatchGetTwitterProfilesByScreenName(screenNames)
+}
+
+func PutProfile(profile Profile) error {
+	return getStore().ProfileTable().PutProfile(profile)
+}
+
+func GetProfile(platformName PlatformName, username string) (*Profile, error) {
+	return getStore().ProfileTable().GetProfile(platformName, username)
+}
+
+func BatchGetProfiles(platformName PlatformName, usernames []string) (map[string]Profile, error) {
+	return getStore().ProfileTable().BatchGetProfiles(platformName, usernames)
+}
+
+func CreateOAuthApp(app OAuthApp) (*OAuthApp, error) {
+	return getStore().OAuthAppTable().CreateOAuthApp(app)
+}
+
+func GetOAuthApp(platformName PlatformName, instance string) (*OAuthApp, error) {
+	return getStore().OAuthAppTable().GetOAuthApp(platformName, instance)
+}
+
+func PutAccountInfo(info AccountInfo) error {
+	return getStore().AccountInfoTable().PutAccountInfo(info)
+}
+
+func PutRequestToken(token RequestToken) error {
+	return getStore().RequestTokenTable().PutRequestToken(token)
+}
+
+func TakeRequestToken(token string) (*RequestToken, error) {
+	return getStore().RequestTokenTable().TakeRequestToken(token)
+}
@@ -0,0 +1,333 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testStores returns every backend which can run without a server, the SQL
+// one is a provisioned SQLite database.
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+
+	sqlStore, err := NewSQLStore(SQLiteBackend, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sqlStore.Provision(ProvisionOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = sqlStore.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sqlStore.db.Close()
+	})
+
+	return map[string]Store{
+		MemoryBackend: NewMemoryStore(),
+		SQLiteBackend: sqlStore,
+	}
+}
+
+func usernames(items []AuthorizationItem) []string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.Username
+	}
+	return names
+}
+
+func TestAuthorizationStore(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			table := s.AuthorizationTable(1)
+
+			if _, err := table.GetAuthorizationItem("0x1", TwitterPlatformName); err != ErrNotFound {
+				t.Fatalf("got %v, want ErrNotFound", err)
+			}
+
+			items := []AuthorizationItem{
+				{UserAddress: "0x1", PlatformName: TwitterPlatformName, Username: "Alice", Status: StatusVerified},
+				{UserAddress: "0x1", PlatformName: GitHubPlatformName, Username: "alice-gh", Status: StatusPending},
+				{UserAddress: "0x2", PlatformName: TwitterPlatformName, Username: "alicia", Status: StatusFailed},
+				{UserAddress: "0x3", PlatformName: TwitterPlatformName, Username: "bob", Status: StatusVerified},
+			}
+			for _, item := range items {
+				if err := table.PutAuthorizationItem(item); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// a put replaces the item of the address on the platform
+			items[0].Username = "ALICE"
+			if err := table.PutAuthorizationItem(items[0]); err != nil {
+				t.Fatal(err)
+			}
+			item, err := table.GetAuthorizationItem("0x1", TwitterPlatformName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if item.Username != "ALICE" || item.Status != StatusVerified {
+				t.Errorf("got %+v", item)
+			}
+
+			// the other networks are separate
+			if _, err = s.AuthorizationTable(3).GetAuthorizationItem("0x1", TwitterPlatformName); err != ErrNotFound {
+				t.Errorf("got %v from another network, want ErrNotFound", err)
+			}
+
+			found, _, err := table.GetAuthorizationItemsByUsername("  alice ", 0, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(found) != 1 || found[0].UserAddress != "0x1" {
+				t.Errorf("by username: got %v", usernames(found))
+			}
+
+			found, _, err = table.GetAuthorizationItemsByUserAddress("0x1", 0, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(found) != 2 {
+				t.Errorf("by user address: got %v", usernames(found))
+			}
+
+			found, _, err = table.GetAuthorizationItemsByUsernamePrefix("", 0, "")
+			if err != nil || len(found) != 0 {
+				t.Errorf("empty prefix: got %v, %v", usernames(found), err)
+			}
+
+			found, _, err = table.ScanAuthorizationItems(TwitterPlatformName, 0, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(found) != 3 {
+				t.Errorf("scan: got %v", usernames(found))
+			}
+		})
+	}
+}
+
+func TestAuthorizationStorePagination(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			table := s.AuthorizationTable(1)
+			for _, username := range []string{"al_1", "al%2", "ALI3", "alo4", "bob"} {
+				item := AuthorizationItem{
+					UserAddress:  "0x" + username,
+					PlatformName: TwitterPlatformName,
+					Username:     username,
+				}
+				if err := table.PutAuthorizationItem(item); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// the pages do not overlap and the last one has no position
+			var (
+				walked []string
+				after  string
+				pages  int
+			)
+			for {
+				page, next, err := table.GetAuthorizationItemsByUsernamePrefix("Al", 2, after)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(page) > 2 {
+					t.Fatalf("got %d items, want at most 2", len(page))
+				}
+				walked = append(walked, usernames(page)...)
+				pages++
+				if next == "" {
+					break
+				}
+				after = next
+			}
+
+			want := []string{"al%2", "al_1", "ALI3", "alo4"}
+			if len(walked) != len(want) {
+				t.Fatalf("got %v, want %v", walked, want)
+			}
+			for i := range want {
+				if walked[i] != want[i] {
+					t.Fatalf("got %v, want %v", walked, want)
+				}
+			}
+			if pages != 2 {
+				t.Errorf("got %d pages, want 2", pages)
+			}
+
+			// the wildcards of the prefix are matched literally
+			found, _, err := table.GetAuthorizationItemsByUsernamePrefix("al_", 0, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(found) != 1 || found[0].Username != "al_1" {
+				t.Errorf("got %v, want [al_1]", usernames(found))
+			}
+
+			if _, _, err = table.GetAuthorizationItemsByUsernamePrefix("al", 2, "not a position"); err != ErrInvalidPosition {
+				t.Errorf("got %v, want ErrInvalidPosition", err)
+			}
+		})
+	}
+}
+
+func TestAuthorizationEventStore(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			table := s.AuthorizationEventTable(1)
+			item := AuthorizationItem{
+				UserAddress:  "0x1",
+				PlatformName: TwitterPlatformName,
+				Username:     "alice",
+			}
+
+			start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			for i := 2; i >= 0; i-- {
+				event := NewAuthorizationEvent(item, AuthorizationChange{Type: EventLink, Actor: ActorUser}, start.Add(time.Duration(i)*time.Minute))
+				if err := table.AppendAuthorizationEvent(event); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			existing := NewAuthorizationEvent(item, AuthorizationChange{Type: EventVerify, Actor: ActorUser}, start)
+			if err := table.AppendAuthorizationEvent(existing); err != ErrEventExists {
+				t.Fatalf("got %v, want ErrEventExists", err)
+			}
+
+			events, next, err := table.GetAuthorizationEvents("0x1", 2, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 2 || next == "" {
+				t.Fatalf("got %d events and position %q", len(events), next)
+			}
+			if !events[0].CreatedAt.Equal(start) || events[0].Type != EventLink {
+				t.Errorf("the oldest event is not first: %+v", events[0])
+			}
+
+			events, next, err = table.GetAuthorizationEvents("0x1", 2, next)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || next != "" {
+				t.Fatalf("got %d events and position %q on the last page", len(events), next)
+			}
+			if !events[0].CreatedAt.Equal(start.Add(2 * time.Minute)) {
+				t.Errorf("got %+v, want the newest event", events[0])
+			}
+		})
+	}
+}
+
+func TestRequestTokenStore(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			table := s.RequestTokenTable()
+			token := RequestToken{
+				Token:        "token",
+				Secret:       "secret",
+				PlatformName: TwitterPlatformName,
+				ExpiresAt:    time.Now().Add(time.Minute).Unix(),
+			}
+			if err := table.PutRequestToken(token); err != nil {
+				t.Fatal(err)
+			}
+
+			taken, err := table.TakeRequestToken("token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if taken.Secret != "secret" {
+				t.Errorf("got secret %q", taken.Secret)
+			}
+
+			// a token can only be taken once
+			if _, err = table.TakeRequestToken("token"); err != ErrNotFound {
+				t.Errorf("got %v, want ErrNotFound", err)
+			}
+
+			token.Token = "expired"
+			token.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+			if err = table.PutRequestToken(token); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = table.TakeRequestToken("expired"); err != ErrNotFound {
+				t.Errorf("got %v for an expired token, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestOAuthAppStore(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			table := s.OAuthAppTable()
+			if _, err := table.GetOAuthApp(MastodonPlatformName, "mastodon.social"); err != ErrNotFound {
+				t.Fatalf("got %v, want ErrNotFound", err)
+			}
+
+			app := OAuthApp{
+				PlatformName: MastodonPlatformName,
+				Instance:     "mastodon.social",
+				ClientID:     "first",
+				CreatedAt:    time.Now(),
+			}
+			if _, err := table.CreateOAuthApp(app); err != nil {
+				t.Fatal(err)
+			}
+
+			// the app registered first is kept
+			app.ClientID = "second"
+			created, err := table.CreateOAuthApp(app)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created.ClientID != "first" {
+				t.Errorf("got client ID %q, want the first one", created.ClientID)
+			}
+		})
+	}
+}
+
+func TestProfileStore(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			table := s.ProfileTable()
+			profile := Profile{
+				PlatformName: GitHubPlatformName,
+				Username:     "Alice",
+				UserID:       "42",
+				Data:         []byte(`{"login":"Alice"}`),
+				UpdatedAt:    time.Now(),
+			}
+			if err := table.PutProfile(profile); err != nil {
+				t.Fatal(err)
+			}
+
+			found, err := table.GetProfile(GitHubPlatformName, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found.UserID != "42" || string(found.Data) != `{"login":"Alice"}` {
+				t.Errorf("got %+v", found)
+			}
+
+			profiles, err := table.BatchGetProfiles(GitHubPlatformName, []string{"ALICE", "alice", "bob"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(profiles) != 1 || profiles["alice"].UserID != "42" {
+				t.Errorf("got %+v", profiles)
+			}
+
+			if _, err = table.GetProfile(MastodonPlatformName, "alice"); err != ErrNotFound {
+				t.Errorf("got %v from another platform, want ErrNotFound", err)
+			}
+		})
+	}
+}
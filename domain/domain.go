@@ -0,0 +1,171 @@
+// Package domain reads the proofs published by the owners of a domain, either
+// as a DNS TXT record or as a file under /.well-known.
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/safehttp"
+)
+
+// Domain errors
+var (
+	ErrInvalidDomain = errors.New("domain: invalid domain name")
+	ErrProofNotFound = errors.New("domain: proof not found")
+)
+
+const (
+	// WellKnownPath is where the proof file is published.
+	WellKnownPath = "/.well-known/keymesh.txt"
+	// TXTPrefix is the label of the TXT records which are checked besides
+	// the ones of the domain itself.
+	TXTPrefix = "_keymesh."
+)
+
+// maxProofFileSize is the largest proof file which is read.
+const maxProofFileSize = 64 * 1024
+
+// TXTResolver is implemented by *net.Resolver, it can be replaced by a local
+// stand-in.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Checker fetches the proofs of the domains.
+type Checker struct {
+	Resolver TXTResolver
+	// Scheme is https, it can be set to http to use a local stand-in.
+	Scheme     string
+	HTTPClient *http.Client
+	Timeout    time.Duration
+}
+
+// NewChecker uses the DNS server at DOMAIN_DNS_SERVER (host:port) if it is
+// set and the system resolver otherwise. DOMAIN_PROOF_SCHEME overrides the
+// scheme of the proof files. The proof files are only read from public
+// addresses, see safehttp.NewClient.
+func NewChecker() *Checker {
+	resolver := net.DefaultResolver
+	if server := os.Getenv("DOMAIN_DNS_SERVER"); server != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	scheme := os.Getenv("DOMAIN_PROOF_SCHEME")
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	timeout := 10 * time.Second
+	return &Checker{
+		Resolver:   resolver,
+		Scheme:     scheme,
+		HTTPClient: safehttp.NewClient(timeout),
+		Timeout:    timeout,
+	}
+}
+
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z][a-z0-9-]{0,61}[a-z0-9](:[0-9]+)?$`)
+
+// NormalizeDomain lower cases the domain name and removes its trailing dot,
+// ErrInvalidDomain is returned for anything but a fully qualified domain
+// name. A port is accepted to reach local stand-ins.
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if len(domain) > 253 || !domainPattern.MatchString(domain) {
+		return "", ErrInvalidDomain
+	}
+
+	return domain, nil
+}
+
+// TXTRecords returns the TXT records of the domain and of its _keymesh
+// subdomain.
+func (c *Checker) TXTRecords(domain string) ([]string, error) {
+	domain, err := NormalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+	host := domain
+	if h, _, err := net.SplitHostPort(domain); err == nil {
+		host = h
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	records := make([]string, 0)
+	for _, name := range []string{TXTPrefix + host, host} {
+		found, err := c.Resolver.LookupTXT(ctx, name)
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, found...)
+	}
+	if len(records) < 1 {
+		return nil, ErrProofNotFound
+	}
+
+	return records, nil
+}
+
+// WellKnownURL returns the URL of the proof file of the domain.
+func (c *Checker) WellKnownURL(domain string) string {
+	return c.Scheme + "://" + domain + WellKnownPath
+}
+
+// WellKnownFile returns the content of the proof file of the domain, the
+// redirections to other hosts are not followed and at most
+// safehttp.MaxRedirects are followed on the domain.
+func (c *Checker) WellKnownFile(domain string) (string, error) {
+	domain, err := NormalizeDomain(domain)
+	if err != nil {
+		return "", err
+	}
+
+	client := *c.HTTPClient
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= safehttp.MaxRedirects || !strings.EqualFold(req.URL.Host, domain) {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+
+	resp, err := client.Get(c.WellKnownURL(domain))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return "", ErrProofNotFound
+	default:
+		if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+			return "", ErrProofNotFound
+		}
+		return "", fmt.Errorf("domain: unexpected status %s for %s", resp.Status, c.WellKnownURL(domain))
+	}
+
+	bs, err := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: maxProofFileSize})
+	return string(bs), err
+}
@@ -0,0 +1,176 @@
+package domain
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeResolver is a local stand-in of the DNS, the names missing from it do
+// not exist.
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	records, ok := r[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+// newLocalChecker serves every host name from handler, as if they all
+// resolved to the local server.
+func newLocalChecker(t *testing.T, resolver TXTResolver, handler http.Handler) *Checker {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}
+
+	return &Checker{
+		Resolver:   resolver,
+		Scheme:     "http",
+		HTTPClient: &http.Client{Transport: transport},
+		Timeout:    time.Second,
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := map[string]string{
+		"Example.COM.":      "example.com",
+		" keymesh.io ":      "keymesh.io",
+		"sub.example.co.uk": "sub.example.co.uk",
+		"example.com:8080":  "example.com:8080",
+		"localhost":         "",
+		"127.0.0.1":         "",
+		"example.com/path":  "",
+		"-example.com":      "",
+		"example..com":      "",
+		"user@example.com":  "",
+		"":                  "",
+	}
+
+	for domain, want := range tests {
+		got, err := NormalizeDomain(domain)
+		if want == "" {
+			if err != ErrInvalidDomain {
+				t.Errorf("%q: got %q, %v, want ErrInvalidDomain", domain, got, err)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("%q: got %q, %v, want %q", domain, got, err, want)
+		}
+	}
+}
+
+func TestTXTRecords(t *testing.T) {
+	checker := &Checker{
+		Resolver: fakeResolver{
+			"example.com":          {"v=spf1 -all"},
+			"_keymesh.example.com": {"I am example.com on dns"},
+			"keymesh.io":           {"site-verification"},
+		},
+		Timeout: time.Second,
+	}
+
+	records, err := checker.TXTRecords("Example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(records, "|") != "I am example.com on dns|v=spf1 -all" {
+		t.Errorf("got %q", records)
+	}
+
+	// the port of a local stand-in is not part of the name
+	if records, err = checker.TXTRecords("keymesh.io:5353"); err != nil || len(records) != 1 {
+		t.Errorf("got %q, %v", records, err)
+	}
+
+	if _, err = checker.TXTRecords("unknown.example"); err != ErrProofNotFound {
+		t.Errorf("got %v, want ErrProofNotFound", err)
+	}
+	if _, err = checker.TXTRecords("localhost"); err != ErrInvalidDomain {
+		t.Errorf("got %v, want ErrInvalidDomain", err)
+	}
+}
+
+func TestWellKnownFile(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(WellKnownPath, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host {
+		case "example.com":
+			w.Write([]byte("I am example.com on web"))
+		case "moved.example.com":
+			http.Redirect(w, r, "/proofs/keymesh.txt", http.StatusMovedPermanently)
+		case "elsewhere.example.com":
+			http.Redirect(w, r, "http://attacker.example"+WellKnownPath, http.StatusFound)
+		case "loop.example.com":
+			http.Redirect(w, r, WellKnownPath, http.StatusFound)
+		case "large.example.com":
+			w.Write([]byte(strings.Repeat("a", maxProofFileSize+1)))
+		case "broken.example.com":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("/proofs/keymesh.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("moved proof"))
+	})
+	checker := newLocalChecker(t, nil, mux)
+
+	if url := checker.WellKnownURL("example.com"); url != "http://example.com/.well-known/keymesh.txt" {
+		t.Errorf("got URL %s", url)
+	}
+
+	content, err := checker.WellKnownFile("EXAMPLE.com")
+	if err != nil || content != "I am example.com on web" {
+		t.Errorf("got %q, %v", content, err)
+	}
+
+	// the redirections on the domain are followed
+	if content, err = checker.WellKnownFile("moved.example.com"); err != nil || content != "moved proof" {
+		t.Errorf("got %q, %v", content, err)
+	}
+
+	for _, domain := range []string{"unknown.example.com", "elsewhere.example.com", "loop.example.com"} {
+		if _, err = checker.WellKnownFile(domain); err != ErrProofNotFound {
+			t.Errorf("%s: got %v, want ErrProofNotFound", domain, err)
+		}
+	}
+
+	if content, err = checker.WellKnownFile("large.example.com"); err != nil || len(content) != maxProofFileSize {
+		t.Errorf("got %d bytes, %v", len(content), err)
+	}
+	if _, err = checker.WellKnownFile("broken.example.com"); err == nil {
+		t.Error("got no error for a server error")
+	}
+	if _, err = checker.WellKnownFile("localhost"); err != ErrInvalidDomain {
+		t.Errorf("got %v, want ErrInvalidDomain", err)
+	}
+}
+
+func TestNewCheckerRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the local server was reached")
+	}))
+	defer server.Close()
+
+	checker := NewChecker()
+	// localhost resolves to the loopback address
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	if _, err := checker.HTTPClient.Get("http://localhost:" + port + WellKnownPath); err == nil {
+		t.Error("got no error for a loopback address")
+	}
+}
@@ -0,0 +1,55 @@
+package eth
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+var (
+	callers      = make(map[int]bind.ContractCaller)
+	callersMutex sync.Mutex
+)
+
+// ContractCaller returns the JSON-RPC client of the network, which is dialed
+// to its RPCURL the first time. It is nil if the contract wallets are not
+// enabled on the network.
+func ContractCaller(networkID int) (bind.ContractCaller, error) {
+	network, err := LookupNetwork(networkID)
+	if err != nil {
+		return nil, err
+	}
+	if !network.ContractWallets {
+		return nil, nil
+	}
+
+	callersMutex.Lock()
+	defer callersMutex.Unlock()
+
+	if caller, ok := callers[networkID]; ok {
+		return caller, nil
+	}
+	client, err := ethclient.Dial(network.RPCURL)
+	if err != nil {
+		return nil, err
+	}
+	callers[networkID] = client
+
+	return client, nil
+}
+
+// SetContractCaller replaces the client of the network, such as with a
+// simulated backend, until the registry is replaced.
+func SetContractCaller(networkID int, caller bind.ContractCaller) {
+	callersMutex.Lock()
+	callers[networkID] = caller
+	callersMutex.Unlock()
+}
+
+// resetContractCallers drops the clients of the replaced registry.
+func resetContractCallers() {
+	callersMutex.Lock()
+	callers = make(map[int]bind.ContractCaller)
+	callersMutex.Unlock()
+}
@@ -1,26 +1,205 @@
 package eth
 
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Network is an Ethereum network supported by the service.
+type Network struct {
+	// ID is the network ID sent by the clients.
+	ID      int    `json:"id"`
+	ChainID int    `json:"chainID"`
+	Name    string `json:"name"`
+	// Testnet marks the public test networks.
+	Testnet bool `json:"testnet"`
+	// Private networks are not watched for proof events, the clients submit
+	// their proofs directly.
+	Private bool   `json:"private"`
+	RPCURL  string `json:"rpcURL"`
+	// ContractWallets enables the ERC-1271 checks of the signatures of the
+	// contract wallets through RPCURL.
+	ContractWallets bool `json:"contractWallets"`
+}
+
 // https://ethereum.stackexchange.com/questions/17051/how-to-select-a-network-id-or-is-there-a-list-of-network-ids?noredirect=1&lq=1
-var networkIDs = []int{
-	0,
-	1,
-	1,
-	1,
-	2,
-	3,
-	4,
-	8,
-	42,
-	77,
-	99,
-	7762959,
+// The networks which were served before the registry existed are kept so that
+// their authorizations can still be read.
+var defaultNetworks = []Network{
+	{ID: 0, ChainID: 0, Name: "olympic"},
+	{ID: 1, ChainID: 1, Name: "mainnet", RPCURL: "https://mainnet.infura.io"},
+	{ID: 2, ChainID: 2, Name: "morden", Testnet: true},
+	{ID: 3, ChainID: 3, Name: "ropsten", Testnet: true, RPCURL: "https://ropsten.infura.io"},
+	{ID: 4, ChainID: 4, Name: "rinkeby", Testnet: true, RPCURL: "https://rinkeby.infura.io"},
+	{ID: 8, ChainID: 8, Name: "ubiq"},
+	{ID: 42, ChainID: 42, Name: "kovan", Testnet: true, RPCURL: "https://kovan.infura.io"},
+	{ID: 77, ChainID: 77, Name: "sokol", Testnet: true},
+	{ID: 99, ChainID: 99, Name: "poa"},
+	{ID: 5777, ChainID: 1337, Name: "ganache", Private: true, RPCURL: "http://127.0.0.1:8545"},
+	{ID: 7762959, ChainID: 7762959, Name: "musicoin"},
 }
 
-func IsPrivateNetwork(networkID int) bool {
-	for _, id := range networkIDs {
-		if id == networkID {
-			return false
+// UnknownNetworkError is returned for the networks missing from the registry.
+type UnknownNetworkError struct {
+	NetworkID int
+}
+
+func (e *UnknownNetworkError) Error() string {
+	return fmt.Sprintf("unknown network %d", e.NetworkID)
+}
+
+// UnknownChainError is returned for the chains of no registered network.
+type UnknownChainError struct {
+	ChainID int
+}
+
+func (e *UnknownChainError) Error() string {
+	return fmt.Sprintf("unknown chain %d", e.ChainID)
+}
+
+var (
+	networks = make(map[int]Network)
+	rwmutex  = &sync.RWMutex{}
+)
+
+// The registry is read from the JSON file NETWORKS_CONFIG points to, which
+// holds an array of Network, the default networks are used if it is not set.
+// The IDs listed in PRIVATE_NETWORKS are added as private networks.
+func init() {
+	list := defaultNetworks
+	if configPath := os.Getenv("NETWORKS_CONFIG"); configPath != "" {
+		var err error
+		if list, err = readNetworks(configPath); err != nil {
+			log.Fatalf("%s: %s", configPath, err)
+		}
+	}
+
+	private, err := parsePrivateNetworks(os.Getenv("PRIVATE_NETWORKS"))
+	if err != nil {
+		log.Fatalf("PRIVATE_NETWORKS: %s", err)
+	}
+	if err = SetNetworks(append(append([]Network{}, list...), private...)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readNetworks(configPath string) ([]Network, error) {
+	f, err := os.Open(configPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var list []Network
+	err = json.NewDecoder(f).Decode(&list)
+
+	return list, err
+}
+
+// parsePrivateNetworks reads a comma separated list of network IDs, the chain
+// IDs of the networks are their network IDs. The unknown networks used to be
+// served as private networks, the list keeps them served.
+func parsePrivateNetworks(value string) ([]Network, error) {
+	list := make([]Network, 0)
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
 		}
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a network ID", s)
+		}
+		list = append(list, Network{
+			ID:      id,
+			ChainID: id,
+			Name:    fmt.Sprintf("private-%d", id),
+			Private: true,
+		})
+	}
+
+	return list, nil
+}
+
+// SetNetworks replaces the registry.
+func SetNetworks(list []Network) error {
+	registry := make(map[int]Network)
+	for _, network := range list {
+		if _, ok := registry[network.ID]; ok {
+			return fmt.Errorf("network %d is registered twice", network.ID)
+		}
+		registry[network.ID] = network
+	}
+
+	rwmutex.Lock()
+	networks = registry
+	rwmutex.Unlock()
+	resetContractCallers()
+
+	return nil
+}
+
+// LookupNetwork returns an *UnknownNetworkError if the network is not
+// registered.
+func LookupNetwork(networkID int) (*Network, error) {
+	rwmutex.RLock()
+	network, ok := networks[networkID]
+	rwmutex.RUnlock()
+	if !ok {
+		return nil, &UnknownNetworkError{NetworkID: networkID}
+	}
+
+	return &network, nil
+}
+
+// LookupChain returns the first registered network of the chain by ID, an
+// *UnknownChainError if there is none.
+func LookupChain(chainID int) (*Network, error) {
+	for _, network := range Networks() {
+		if network.ChainID == chainID {
+			return &network, nil
+		}
+	}
+
+	return nil, &UnknownChainError{ChainID: chainID}
+}
+
+// Networks returns the registered networks ordered by ID.
+func Networks() []Network {
+	rwmutex.RLock()
+	list := make([]Network, 0, len(networks))
+	for _, network := range networks {
+		list = append(list, network)
+	}
+	rwmutex.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	return list
+}
+
+// NetworkIDs returns the IDs of the registered networks in order.
+func NetworkIDs() []int {
+	list := Networks()
+	ids := make([]int, len(list))
+	for i, network := range list {
+		ids[i] = network.ID
+	}
+
+	return ids
+}
+
+func IsPrivateNetwork(networkID int) bool {
+	network, err := LookupNetwork(networkID)
+	if err != nil {
+		return false
 	}
-	return true
+	return network.Private
 }
@@ -0,0 +1,43 @@
+package eth
+
+import "testing"
+
+func TestParsePrivateNetworks(t *testing.T) {
+	list, err := parsePrivateNetworks(" 15, ,1515")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != 15 || list[1].ChainID != 1515 || !list[1].Private {
+		t.Errorf("got %+v", list)
+	}
+
+	if list, err = parsePrivateNetworks(""); err != nil || len(list) != 0 {
+		t.Errorf("got %+v, %v for an empty list", list, err)
+	}
+	if _, err = parsePrivateNetworks("15,abc"); err == nil {
+		t.Error("got no error for an invalid ID")
+	}
+}
+
+func TestDefaultNetworksKeepLegacyIDs(t *testing.T) {
+	if err := SetNetworks(defaultNetworks); err != nil {
+		t.Fatal(err)
+	}
+	defer SetNetworks(defaultNetworks)
+
+	// the IDs served as public networks before the registry
+	for _, id := range []int{0, 1, 2, 3, 4, 8, 42, 77, 99, 7762959} {
+		network, err := LookupNetwork(id)
+		if err != nil {
+			t.Errorf("network %d: %s", id, err)
+			continue
+		}
+		if network.Private {
+			t.Errorf("network %d is private", id)
+		}
+	}
+
+	if _, err := LookupNetwork(15); err == nil {
+		t.Error("an unlisted network is registered")
+	}
+}
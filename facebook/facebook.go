@@ -0,0 +1,291 @@
+package facebook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Facebook errors
+var (
+	ErrUnableToGetFacebookUser = errors.New("facebook: unable to get Facebook User")
+	ErrInvalidPostURL          = errors.New("facebook: invalid post URL")
+	ErrPostNotFound            = errors.New("facebook: post not found")
+	ErrMissingCode             = errors.New("facebook: callback is missing the code or the state")
+)
+
+// graphVersion is the version of the Graph API the service is written for.
+const graphVersion = "v3.2"
+
+// maxPostPages is how many pages of the posts of a user are searched for the
+// proof, the proof is expected to be recent.
+const maxPostPages = 3
+
+func graphURL() string {
+	if u := os.Getenv("FACEBOOK_GRAPH_URL"); u != "" {
+		return u
+	}
+	return "https://graph.facebook.com"
+}
+
+func wwwURL() string {
+	if u := os.Getenv("FACEBOOK_WWW_URL"); u != "" {
+		return u
+	}
+	return "https://www.facebook.com"
+}
+
+// NewConfig asks for the permission to read the posts of the user since the
+// proofs can only be read on behalf of their author. FACEBOOK_GRAPH_URL and
+// FACEBOOK_WWW_URL point the login to a fake Graph API.
+func NewConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     os.Getenv("FACEBOOK_APP_ID"),
+		ClientSecret: os.Getenv("FACEBOOK_APP_SECRET"),
+		RedirectURL:  os.Getenv("FACEBOOK_CALLBACK_URL"),
+		Scopes:       []string{"public_profile", "email", "user_posts"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  wwwURL() + "/" + graphVersion + "/dialog/oauth",
+			TokenURL: graphURL() + "/" + graphVersion + "/oauth/access_token",
+		},
+	}
+}
+
+// Client calls the Graph API on behalf of the users.
+type Client struct {
+	// BaseURL is the root of the Graph API, it can be pointed to a stub.
+	BaseURL    string
+	AppID      string
+	AppSecret  string
+	HTTPClient *http.Client
+}
+
+func NewClient() *Client {
+	return &Client{
+		BaseURL:    graphURL(),
+		AppID:      os.Getenv("FACEBOOK_APP_ID"),
+		AppSecret:  os.Getenv("FACEBOOK_APP_SECRET"),
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// User is the profile of a Facebook account, ID is scoped to the app.
+type User struct {
+	ID      string  `json:"id"`
+	Name    string  `json:"name"`
+	Email   string  `json:"email"`
+	Link    string  `json:"link"`
+	Picture Picture `json:"picture"`
+}
+
+type Picture struct {
+	Data struct {
+		URL string `json:"url"`
+	} `json:"data"`
+}
+
+type Post struct {
+	ID           string  `json:"id"`
+	Message      string  `json:"message"`
+	PermalinkURL string  `json:"permalink_url"`
+	From         *User   `json:"from"`
+	Privacy      Privacy `json:"privacy"`
+}
+
+// Privacy is the audience of a post, Value is EVERYONE, ALL_FRIENDS,
+// FRIENDS_OF_FRIENDS, SELF or CUSTOM.
+type Privacy struct {
+	Value string `json:"value"`
+}
+
+// Public reports whether anyone can read the post.
+func (p *Post) Public() bool {
+	return p.Privacy.Value == "EVERYONE"
+}
+
+func GenerateFacebookLoginURL(config *oauth2.Config, state string) string {
+	return config.AuthCodeURL(state)
+}
+
+// ParseAuthorizationCallback returns the authorization code and the state of
+// the callback request.
+func ParseAuthorizationCallback(req *http.Request) (code, state string, err error) {
+	if err = req.ParseForm(); err != nil {
+		return "", "", err
+	}
+
+	code = req.Form.Get("code")
+	state = req.Form.Get("state")
+	if code == "" || state == "" {
+		return "", "", ErrMissingCode
+	}
+
+	return code, state, nil
+}
+
+// GetFacebookUser exchanges the authorization code for a long-lived access
+// token and returns the user who logged in along with the token.
+func (c *Client) GetFacebookUser(config *oauth2.Config, code string) (*User, string, error) {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, c.HTTPClient)
+	token, err := config.Exchange(ctx, code)
+	if err != nil {
+		return nil, "", err
+	}
+
+	accessToken, err := c.exchangeLongLivedToken(token.AccessToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	params := url.Values{}
+	params.Set("fields", "id,name,email,link,picture")
+	var user User
+	if err = c.get("/me", accessToken, params, &user); err != nil {
+		return nil, "", err
+	}
+	if user.ID == "" {
+		return nil, "", ErrUnableToGetFacebookUser
+	}
+
+	return &user, accessToken, nil
+}
+
+// exchangeLongLivedToken swaps the short-lived token of the login for one
+// which lasts about 60 days, so that the proof can be checked again later.
+func (c *Client) exchangeLongLivedToken(accessToken string) (string, error) {
+	params := url.Values{}
+	params.Set("grant_type", "fb_exchange_token")
+	params.Set("client_id", c.AppID)
+	params.Set("client_secret", c.AppSecret)
+	params.Set("fb_exchange_token", accessToken)
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := c.get("/oauth/access_token", "", params, &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", ErrUnableToGetFacebookUser
+	}
+
+	return token.AccessToken, nil
+}
+
+var postPathPattern = regexp.MustCompile(`^/[A-Za-z0-9.]+/posts/([0-9]+)/?$`)
+
+// ParsePostURL returns the story ID of a post URL such as
+// https://www.facebook.com/4/posts/10100000000000000 or
+// https://www.facebook.com/permalink.php?story_fbid=10100000000000000&id=4.
+func ParsePostURL(postURL string) (string, error) {
+	u, err := url.Parse(postURL)
+	if err != nil {
+		return "", ErrInvalidPostURL
+	}
+
+	switch strings.ToLower(u.Host) {
+	case "facebook.com", "www.facebook.com", "m.facebook.com":
+	default:
+		return "", ErrInvalidPostURL
+	}
+
+	if matches := postPathPattern.FindStringSubmatch(u.Path); matches != nil {
+		return matches[1], nil
+	}
+	if storyID := u.Query().Get("story_fbid"); storyID != "" {
+		return storyID, nil
+	}
+
+	return "", ErrInvalidPostURL
+}
+
+// storyID returns the part of a post ID which appears in its URL, post IDs
+// are made of the ID of the author and the story ID.
+func (p *Post) storyID() string {
+	parts := strings.SplitN(p.ID, "_", 2)
+	return parts[len(parts)-1]
+}
+
+// FindPost looks for the post among the recent posts of the user whose
+// access token is given.
+func (c *Client) FindPost(accessToken string, postURL string) (*Post, error) {
+	storyID, err := ParsePostURL(postURL)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("fields", "id,message,permalink_url,from,privacy")
+	params.Set("limit", "100")
+	path := "/me/posts"
+	for page := 0; page < maxPostPages; page++ {
+		var posts struct {
+			Data   []Post `json:"data"`
+			Paging struct {
+				Cursors struct {
+					After string `json:"after"`
+				} `json:"cursors"`
+			} `json:"paging"`
+		}
+		if err = c.get(path, accessToken, params, &posts); err != nil {
+			return nil, err
+		}
+
+		for i := range posts.Data {
+			if posts.Data[i].storyID() == storyID {
+				return &posts.Data[i], nil
+			}
+		}
+
+		if posts.Paging.Cursors.After == "" {
+			break
+		}
+		params.Set("after", posts.Paging.Cursors.After)
+	}
+
+	return nil, ErrPostNotFound
+}
+
+// get calls the Graph API, the calls made with an access token are signed
+// with the app secret.
+func (c *Client) get(path string, accessToken string, params url.Values, v interface{}) error {
+	if accessToken != "" {
+		params.Set("access_token", accessToken)
+		params.Set("appsecret_proof", c.appSecretProof(accessToken))
+	}
+
+	resp, err := c.HTTPClient.Get(c.BaseURL + "/" + graphVersion + path + "?" + params.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var graphErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&graphErr)
+		return fmt.Errorf("facebook: unexpected status %s for %s: %s", resp.Status, path, graphErr.Error.Message)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Client) appSecretProof(accessToken string) string {
+	h := hmac.New(sha256.New, []byte(c.AppSecret))
+	h.Write([]byte(accessToken))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,164 @@
+package facebook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// fakeGraphAPI serves the token exchanges, /me and two pages of /me/posts
+// to the holder of the long-lived token.
+func fakeGraphAPI(t *testing.T) (*Client, *oauth2.Config) {
+	t.Helper()
+
+	client := &Client{AppID: "app", AppSecret: "secret"}
+
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	checkToken := func(w http.ResponseWriter, r *http.Request) bool {
+		query := r.URL.Query()
+		if query.Get("access_token") != "long-lived" || query.Get("appsecret_proof") != client.appSecretProof("long-lived") {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]interface{}{"error": map[string]string{"message": "Invalid OAuth access token."}})
+			return false
+		}
+		return true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3.2/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch {
+		case r.Method == http.MethodPost && r.Form.Get("code") == "code":
+			writeJSON(w, map[string]string{"access_token": "short-lived", "token_type": "bearer"})
+		case r.Form.Get("grant_type") == "fb_exchange_token" && r.Form.Get("fb_exchange_token") == "short-lived" && r.Form.Get("client_secret") == "secret":
+			writeJSON(w, map[string]string{"access_token": "long-lived", "token_type": "bearer"})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]interface{}{"error": map[string]string{"message": "Invalid code."}})
+		}
+	})
+	mux.HandleFunc("/v3.2/me", func(w http.ResponseWriter, r *http.Request) {
+		if checkToken(w, r) {
+			writeJSON(w, User{ID: "4", Name: "Mark", Email: "mark@example.com"})
+		}
+	})
+	mux.HandleFunc("/v3.2/me/posts", func(w http.ResponseWriter, r *http.Request) {
+		if !checkToken(w, r) {
+			return
+		}
+		if r.URL.Query().Get("fields") != "id,message,permalink_url,from,privacy" {
+			t.Errorf("got fields %q", r.URL.Query().Get("fields"))
+		}
+
+		from := &User{ID: "4"}
+		if r.URL.Query().Get("after") == "" {
+			writeJSON(w, map[string]interface{}{
+				"data": []Post{
+					{ID: "4_1", Message: "hello", From: from, Privacy: Privacy{Value: "EVERYONE"}},
+				},
+				"paging": map[string]interface{}{"cursors": map[string]string{"after": "page2"}},
+			})
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"data": []Post{
+				{ID: "4_2", Message: "friends only", From: from, Privacy: Privacy{Value: "ALL_FRIENDS"}},
+			},
+		})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client.BaseURL = server.URL
+	client.HTTPClient = server.Client()
+	config := &oauth2.Config{
+		ClientID:     "app",
+		ClientSecret: "secret",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  server.URL + "/v3.2/dialog/oauth",
+			TokenURL: server.URL + "/v3.2/oauth/access_token",
+		},
+	}
+
+	return client, config
+}
+
+func TestGetFacebookUser(t *testing.T) {
+	client, config := fakeGraphAPI(t)
+
+	user, accessToken, err := client.GetFacebookUser(config, "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "4" || user.Email != "mark@example.com" {
+		t.Errorf("got %+v", user)
+	}
+	if accessToken != "long-lived" {
+		t.Errorf("got access token %q, want the long-lived one", accessToken)
+	}
+
+	if _, _, err = client.GetFacebookUser(config, "wrong"); err == nil {
+		t.Error("got no error for an invalid code")
+	}
+}
+
+func TestParsePostURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		storyID string
+	}{
+		{"https://www.facebook.com/4/posts/10100000000000000", "10100000000000000"},
+		{"https://m.facebook.com/zuck/posts/10100000000000000/", "10100000000000000"},
+		{"https://www.facebook.com/permalink.php?story_fbid=10100000000000000&id=4", "10100000000000000"},
+		{"https://example.com/4/posts/10100000000000000", ""},
+		{"https://www.facebook.com/4/photos/10100000000000000", ""},
+	}
+
+	for _, test := range tests {
+		storyID, err := ParsePostURL(test.url)
+		if test.storyID == "" {
+			if err != ErrInvalidPostURL {
+				t.Errorf("%s: got %v, want ErrInvalidPostURL", test.url, err)
+			}
+			continue
+		}
+		if err != nil || storyID != test.storyID {
+			t.Errorf("%s: got %q, %v", test.url, storyID, err)
+		}
+	}
+}
+
+func TestFindPost(t *testing.T) {
+	client, _ := fakeGraphAPI(t)
+
+	post, err := client.FindPost("long-lived", "https://www.facebook.com/4/posts/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Message != "hello" || !post.Public() {
+		t.Errorf("got %+v", post)
+	}
+
+	// the second page is read when the post is not on the first one
+	post, err = client.FindPost("long-lived", "https://www.facebook.com/permalink.php?story_fbid=2&id=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Message != "friends only" || post.Public() {
+		t.Errorf("got %+v", post)
+	}
+
+	if _, err = client.FindPost("long-lived", "https://www.facebook.com/4/posts/3"); err != ErrPostNotFound {
+		t.Errorf("got %v, want ErrPostNotFound", err)
+	}
+	if _, err = client.FindPost("expired", "https://www.facebook.com/4/posts/1"); err == nil {
+		t.Error("got no error for an invalid access token")
+	}
+}
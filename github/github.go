@@ -1 +1,208 @@
 package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/oauth2"
+	githubOAuth2 "golang.org/x/oauth2/github"
+)
+
+// GitHub errors
+var (
+	ErrUnableToGetGitHubUser = errors.New("github: unable to get GitHub User")
+	ErrInvalidGistURL        = errors.New("github: invalid gist URL")
+	ErrGistNotFound          = errors.New("github: gist not found")
+	ErrMissingCode           = errors.New("github: callback is missing the code or the state")
+)
+
+var errNotFound = errors.New("github: not found")
+
+// maxGistFileSize is the largest gist file which is downloaded when GitHub
+// truncates its content.
+const maxGistFileSize = 64 * 1024
+
+func NewConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     os.Getenv("GITHUB_CLIENT_ID"),
+		ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("GITHUB_CALLBACK_URL"),
+		Endpoint:     githubOAuth2.Endpoint,
+	}
+}
+
+// Client calls the GitHub REST API.
+type Client struct {
+	// BaseURL is the root of the GitHub API, it can be pointed to a stub.
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient returns an unauthenticated client, GITHUB_API_URL overrides the
+// GitHub API root.
+func NewClient() *Client {
+	baseURL := os.Getenv("GITHUB_API_URL")
+	if baseURL == "" {
+		baseURL = "https://api.github.com"
+	}
+
+	return &Client{
+		BaseURL:    baseURL,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// User is the public profile of a GitHub account.
+type User struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	AvatarURL string `json:"avatar_url"`
+	HTMLURL   string `json:"html_url"`
+	Bio       string `json:"bio"`
+}
+
+type Gist struct {
+	ID      string               `json:"id"`
+	HTMLURL string               `json:"html_url"`
+	Public  bool                 `json:"public"`
+	Owner   *User                `json:"owner"`
+	Files   map[string]*GistFile `json:"files"`
+}
+
+type GistFile struct {
+	Filename  string `json:"filename"`
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated"`
+	RawURL    string `json:"raw_url"`
+}
+
+func GenerateGitHubLoginURL(config *oauth2.Config, state string) string {
+	return config.AuthCodeURL(state)
+}
+
+// ParseAuthorizationCallback returns the authorization code and the state of
+// the callback request.
+func ParseAuthorizationCallback(req *http.Request) (code, state string, err error) {
+	if err = req.ParseForm(); err != nil {
+		return "", "", err
+	}
+
+	code = req.Form.Get("code")
+	state = req.Form.Get("state")
+	if code == "" || state == "" {
+		return "", "", ErrMissingCode
+	}
+
+	return code, state, nil
+}
+
+// GetGitHubUser exchanges the authorization code for an access token and
+// returns the user who logged in.
+func (c *Client) GetGitHubUser(config *oauth2.Config, code string) (*User, error) {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, c.HTTPClient)
+	token, err := config.Exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	var user User
+	if err = c.get(config.Client(ctx, token), "/user", &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 || user.Login == "" {
+		return nil, ErrUnableToGetGitHubUser
+	}
+
+	return &user, nil
+}
+
+var gistPathPattern = regexp.MustCompile(`^/(?:[A-Za-z0-9-]+/)?([0-9a-f]+)/?$`)
+
+// ParseGistURL returns the ID of a gist URL such as
+// https://gist.github.com/octocat/6cad326836d38bd3a7ae.
+func ParseGistURL(gistURL string) (string, error) {
+	u, err := url.Parse(gistURL)
+	if err != nil || strings.ToLower(u.Host) != "gist.github.com" {
+		return "", ErrInvalidGistURL
+	}
+
+	matches := gistPathPattern.FindStringSubmatch(u.Path)
+	if matches == nil {
+		return "", ErrInvalidGistURL
+	}
+
+	return matches[1], nil
+}
+
+// FetchGist returns the gist with the full content of its files.
+func (c *Client) FetchGist(gistID string) (*Gist, error) {
+	var gist Gist
+	err := c.get(c.HTTPClient, "/gists/"+url.PathEscape(gistID), &gist)
+	if err == errNotFound {
+		return nil, ErrGistNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range gist.Files {
+		if !file.Truncated {
+			continue
+		}
+		if file.Content, err = c.fetchRaw(file.RawURL); err != nil {
+			return nil, err
+		}
+	}
+
+	return &gist, nil
+}
+
+func (c *Client) get(httpClient *http.Client, path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return errNotFound
+	default:
+		return fmt.Errorf("github: unexpected status %s for %s", resp.Status, path)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Client) fetchRaw(rawURL string) (string, error) {
+	resp, err := c.HTTPClient.Get(rawURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("github: unexpected status %s for %s", resp.Status, rawURL)
+	}
+
+	bs, err := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: maxGistFileSize})
+	return string(bs), err
+}
@@ -0,0 +1,156 @@
+package github
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// fakeGitHub serves the login of octocat, whose code is "code", and the
+// gists of octocat.
+func fakeGitHub(t *testing.T) (*Client, *oauth2.Config) {
+	t.Helper()
+
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "code" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "bad_verification_code"})
+			return
+		}
+		writeJSON(w, map[string]string{"access_token": "token", "token_type": "bearer"})
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer token":
+			writeJSON(w, User{ID: 583231, Login: "octocat", Name: "The Octocat"})
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	mux.HandleFunc("/gists/", func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/gists/") {
+		case "aa5a315d61ae9438b18d":
+			writeJSON(w, Gist{
+				ID:    "aa5a315d61ae9438b18d",
+				Owner: &User{ID: 583231, Login: "octocat"},
+				Files: map[string]*GistFile{
+					"keymesh.md": {Filename: "keymesh.md", Content: "proof"},
+					"large.md":   {Filename: "large.md", Content: "trunc", Truncated: true, RawURL: server.URL + "/raw/large.md"},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc("/raw/large.md", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", maxGistFileSize+1)))
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	config := &oauth2.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  server.URL + "/login/oauth/authorize",
+			TokenURL: server.URL + "/login/oauth/access_token",
+		},
+	}
+
+	return &Client{BaseURL: server.URL, HTTPClient: server.Client()}, config
+}
+
+func TestParseAuthorizationCallback(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/oauth/github/callback?code=code&state=state", nil)
+	code, state, err := ParseAuthorizationCallback(req)
+	if err != nil || code != "code" || state != "state" {
+		t.Errorf("got %q, %q, %v", code, state, err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/oauth/github/callback?state=state", nil)
+	if _, _, err = ParseAuthorizationCallback(req); err != ErrMissingCode {
+		t.Errorf("got %v, want ErrMissingCode", err)
+	}
+}
+
+func TestGetGitHubUser(t *testing.T) {
+	client, config := fakeGitHub(t)
+
+	loginURL, err := url.Parse(GenerateGitHubLoginURL(config, "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loginURL.Query().Get("state") != "state" || loginURL.Query().Get("client_id") != "client" {
+		t.Errorf("got login URL %s", loginURL)
+	}
+
+	user, err := client.GetGitHubUser(config, "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 583231 || user.Login != "octocat" {
+		t.Errorf("got %+v", user)
+	}
+
+	if _, err = client.GetGitHubUser(config, "wrong"); err == nil {
+		t.Error("got no error for an invalid code")
+	}
+}
+
+func TestParseGistURL(t *testing.T) {
+	tests := map[string]string{
+		"https://gist.github.com/octocat/aa5a315d61ae9438b18d":   "aa5a315d61ae9438b18d",
+		"https://Gist.GitHub.com/aa5a315d61ae9438b18d/":          "aa5a315d61ae9438b18d",
+		"https://github.com/octocat/aa5a315d61ae9438b18d":        "",
+		"https://gist.github.com/octocat/aa5a315d61ae9438b18d/x": "",
+		"https://gist.github.com/octocat":                        "",
+	}
+
+	for gistURL, want := range tests {
+		gistID, err := ParseGistURL(gistURL)
+		if want == "" {
+			if err != ErrInvalidGistURL {
+				t.Errorf("%s: got %q, %v, want ErrInvalidGistURL", gistURL, gistID, err)
+			}
+			continue
+		}
+		if err != nil || gistID != want {
+			t.Errorf("%s: got %q, %v, want %q", gistURL, gistID, err, want)
+		}
+	}
+}
+
+func TestFetchGist(t *testing.T) {
+	client, _ := fakeGitHub(t)
+
+	gist, err := client.FetchGist("aa5a315d61ae9438b18d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gist.Owner == nil || gist.Owner.ID != 583231 {
+		t.Errorf("got owner %+v", gist.Owner)
+	}
+	if gist.Files["keymesh.md"].Content != "proof" {
+		t.Errorf("got content %q", gist.Files["keymesh.md"].Content)
+	}
+	// the truncated files are downloaded up to maxGistFileSize
+	if content := gist.Files["large.md"].Content; len(content) != maxGistFileSize {
+		t.Errorf("got %d bytes for the truncated file", len(content))
+	}
+
+	if _, err = client.FetchGist("deleted"); err != ErrGistNotFound {
+		t.Errorf("got %v, want ErrGistNotFound", err)
+	}
+}
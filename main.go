@@ -4,17 +4,24 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"net/url"
 	"strconv"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/dcb9/keymeshOAuth/db"
 	"github.com/dcb9/keymeshOAuth/eth"
+	"github.com/dcb9/keymeshOAuth/proof"
 	"github.com/dcb9/keymeshOAuth/proxy"
 )
 
 func main() {
+	if err := proxy.VerifySecrets(); err != nil {
+		log.Fatal(err)
+	}
+
 	lambda.Start(corsHandler(errorHandler(handler)))
 }
 
@@ -23,17 +30,17 @@ var (
 )
 
 func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if platformName, action, ok := proxy.ParseOAuthPath(request.Path); ok {
+		return oauthHandler(&request, platformName, action)
+	}
+
 	switch request.Path {
-	case "/oauth/twitter/authorize_url":
-		return getTwitterAuthorizeURL()
-	case "/oauth/twitter/callback":
-		return twitterCallback(&request)
-	case "/oauth/twitter/verify":
-		return twitterVerify(&request)
 	case "/users/search":
-		return serializeUserInfoList(searchUsers(&request))
+		return serializeUserInfoPage(searchUsers(&request))
+	case "/users/history":
+		return getUserHistory(&request)
 	case "/users":
-		return serializeUserInfoList(getUsers(&request))
+		return serializeUserInfoPage(getUsers(&request))
 	case "/prekeys":
 		return putPrekeys(&request)
 	case "/account-info":
@@ -45,6 +52,24 @@ func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyRespo
 	return events.APIGatewayProxyResponse{}, errPathNotMatch
 }
 
+// httpError is an error which is returned to the client with a status code
+// other than 500.
+type httpError struct {
+	statusCode int
+	err        error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(err error) error {
+	return &httpError{
+		statusCode: http.StatusBadRequest,
+		err:        err,
+	}
+}
+
 var (
 	errNoNetworkID      = errors.New(`"networkID" must be set`)
 	errInvalidNetworkID = errors.New(`"networkID" must be a number`)
@@ -53,16 +78,46 @@ var (
 func requireNetworkID(request *events.APIGatewayProxyRequest) (int, error) {
 	networkIDStr := request.QueryStringParameters["networkID"]
 	if networkIDStr == "" {
-		return 0, errNoNetworkID
+		return 0, badRequest(errNoNetworkID)
 	}
 	networkID, err := strconv.Atoi(networkIDStr)
 	if err != nil {
-		return 0, errInvalidNetworkID
+		return 0, badRequest(errInvalidNetworkID)
+	}
+	if _, err = eth.LookupNetwork(networkID); err != nil {
+		return 0, badRequest(err)
 	}
 
 	return networkID, nil
 }
 
+var (
+	errInvalidLimit = errors.New(`"limit" must be a number`)
+)
+
+func getLimit(request *events.APIGatewayProxyRequest, defaultLimit int) (int, error) {
+	limitStr := request.QueryStringParameters["limit"]
+	if limitStr == "" {
+		return defaultLimit, nil
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		return 0, badRequest(errInvalidLimit)
+	}
+
+	return limit, nil
+}
+
+// userLookupError turns the errors caused by an invalid cursor into bad
+// requests.
+func userLookupError(err error) error {
+	if err == proxy.ErrInvalidCursor {
+		return badRequest(err)
+	}
+	return err
+}
+
 func putAccountInfo(request *events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	if request.HTTPMethod != http.MethodPut {
 		return events.APIGatewayProxyResponse{}, fmt.Errorf(`Method "%s" is not allowed`, request.HTTPMethod)
@@ -98,82 +153,181 @@ var (
 	errEmptyGetUsersParam = errors.New(`the query param "username" or "userAddress" must be set`)
 )
 
-func getUsers(request *events.APIGatewayProxyRequest) ([]*proxy.UserInfo, error) {
+func getUsers(request *events.APIGatewayProxyRequest) (*proxy.UserInfoPage, error) {
 	networkID, err := requireNetworkID(request)
 	if err != nil {
 		return nil, err
 	}
 
+	// all the users are returned unless a limit is set
+	limit, err := getLimit(request, 0)
+	if err != nil {
+		return nil, err
+	}
+	cursor := request.QueryStringParameters["cursor"]
+
 	username := request.QueryStringParameters["username"]
 	if username != "" {
-		userInfoList, err := proxy.HandleGetUserByUsername(username, networkID)
-		return userInfoList, err
+		page, err := proxy.HandleGetUserByUsername(username, networkID, limit, cursor)
+		return page, userLookupError(err)
 	}
 
 	userAddress := request.QueryStringParameters["userAddress"]
 	if userAddress != "" {
-		userInfoList, err := proxy.HandleGetUserByUserAddress(userAddress, networkID)
-		return userInfoList, err
+		page, err := proxy.HandleGetUserByUserAddress(userAddress, networkID, limit, cursor)
+		return page, userLookupError(err)
 	}
 
-	return nil, errEmptyGetUsersParam
+	return nil, badRequest(errEmptyGetUsersParam)
 }
 
 var (
 	errEmptySearchUsersParam = errors.New(`the query param "usernamePrefix" must be set`)
 )
 
-func searchUsers(request *events.APIGatewayProxyRequest) ([]*proxy.UserInfo, error) {
+func searchUsers(request *events.APIGatewayProxyRequest) (*proxy.UserInfoPage, error) {
 	networkID, err := requireNetworkID(request)
 	if err != nil {
 		return nil, err
 	}
 
-	limit := 10
-	limitStr := request.QueryStringParameters["limit"]
-	if limitStr != "" {
-		var err error
-		limit, err = strconv.Atoi(limitStr)
-		if err != nil {
-			return nil, err
-		}
+	limit, err := getLimit(request, 10)
+	if err != nil {
+		return nil, err
 	}
 
 	usernamePrefix := request.QueryStringParameters["usernamePrefix"]
 	if usernamePrefix != "" {
-		userInfoList, err := proxy.HandleSearchUserByUsernamePrefix(usernamePrefix, networkID, limit)
-		return userInfoList, err
+		page, err := proxy.HandleSearchUserByUsernamePrefix(usernamePrefix, networkID, limit, request.QueryStringParameters["cursor"])
+		return page, userLookupError(err)
 	}
 
-	return nil, errEmptySearchUsersParam
+	return nil, badRequest(errEmptySearchUsersParam)
 }
 
-func getTwitterAuthorizeURL() (events.APIGatewayProxyResponse, error) {
-	url, err := proxy.HandleTwitterLoginURL()
+func getUserHistory(request *events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	networkID, err := requireNetworkID(request)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
 
-	return events.APIGatewayProxyResponse{
-		Body:       url,
-		StatusCode: 200,
-	}, nil
+	limit, err := getLimit(request, proxy.MaxSearchLimit)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	userAddress := request.QueryStringParameters["userAddress"]
+	if userAddress == "" {
+		return events.APIGatewayProxyResponse{}, badRequest(errEmptyUserAddress)
+	}
+
+	page, err := proxy.HandleGetUserHistory(userAddress, networkID, limit, request.QueryStringParameters["cursor"])
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, userLookupError(err)
+	}
+
+	bs, _ := json.Marshal(page.Events)
+	resp := events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Body:       string(bs),
+	}
+	if page.NextCursor != "" {
+		resp.Headers = map[string]string{
+			proxy.NextCursorHeader: page.NextCursor,
+		}
+	}
+
+	return resp, nil
+}
+
+func oauthHandler(request *events.APIGatewayProxyRequest, platformName db.PlatformName, action string) (events.APIGatewayProxyResponse, error) {
+	if _, err := proxy.LookupProvider(platformName); err != nil {
+		return events.APIGatewayProxyResponse{}, &httpError{
+			statusCode: http.StatusNotFound,
+			err:        err,
+		}
+	}
+
+	switch action {
+	case "authorize_url":
+		return getAuthorizeURL(request, platformName)
+	case "callback":
+		return oauthCallback(request, platformName)
+	case "result":
+		return getLoginResult(request, platformName)
+	case "verify":
+		if request.HTTPMethod == http.MethodDelete {
+			return revokeProof(request, platformName)
+		}
+		return verifyProof(request, platformName)
+	}
+
+	return events.APIGatewayProxyResponse{}, errPathNotMatch
 }
 
-func twitterCallback(request *events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+// newQueryRequest returns an http.Request carrying the query params of the
+// request, for the handlers of the proxy package.
+func newQueryRequest(request *events.APIGatewayProxyRequest) *http.Request {
 	params := url.Values{}
 	for k, v := range request.QueryStringParameters {
 		params.Add(k, v)
 	}
 	req, _ := http.NewRequest(http.MethodGet, "?"+params.Encode(), nil)
 
-	userBytes, err := proxy.HandleTwitterCallback(req)
+	return req
+}
+
+func getAuthorizeURL(request *events.APIGatewayProxyRequest, platformName db.PlatformName) (events.APIGatewayProxyResponse, error) {
+	url, err := proxy.HandleLoginURL(platformName, newQueryRequest(request))
+	if _, ok := err.(*proxy.LoginError); ok {
+		return events.APIGatewayProxyResponse{}, badRequest(err)
+	}
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return events.APIGatewayProxyResponse{
+		Body:       url,
+		StatusCode: 200,
+	}, nil
+}
+
+func oauthCallback(request *events.APIGatewayProxyRequest, platformName db.PlatformName) (events.APIGatewayProxyResponse, error) {
+	resp, err := proxy.HandleCallback(platformName, newQueryRequest(request))
+	if _, ok := err.(*proxy.LoginError); ok {
+		return events.APIGatewayProxyResponse{}, badRequest(err)
+	}
+	if err == proxy.ErrUnknownRequestToken || err == proxy.ErrInvalidLoginState {
+		return events.APIGatewayProxyResponse{}, &httpError{
+			statusCode: http.StatusUnauthorized,
+			err:        err,
+		}
+	}
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: resp.StatusCode,
+		Headers:    resp.Headers,
+		Body:       resp.Body,
+	}, nil
+}
+
+func getLoginResult(request *events.APIGatewayProxyRequest, platformName db.PlatformName) (events.APIGatewayProxyResponse, error) {
+	resultBytes, err := proxy.HandleLoginResult(platformName, request.QueryStringParameters["token"])
+	if err == proxy.ErrInvalidLoginResult {
+		return events.APIGatewayProxyResponse{}, &httpError{
+			statusCode: http.StatusUnauthorized,
+			err:        err,
+		}
+	}
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
 
 	return events.APIGatewayProxyResponse{
-		Body:       string(userBytes),
+		Body:       string(resultBytes),
 		StatusCode: 200,
 	}, nil
 }
@@ -183,7 +337,7 @@ var (
 	errEmptyNetworkID   = errors.New("networkID could not be empty")
 )
 
-func twitterVerify(request *events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func verifyProof(request *events.APIGatewayProxyRequest, platformName db.PlatformName) (events.APIGatewayProxyResponse, error) {
 	networkID, err := requireNetworkID(request)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
@@ -203,7 +357,16 @@ func twitterVerify(request *events.APIGatewayProxyRequest) (events.APIGatewayPro
 		}
 	}
 
-	if err = proxy.HandleTwitterVerify(userAddress, networkID, socialProof); err != nil {
+	if err = proxy.HandleVerify(platformName, userAddress, networkID, socialProof); err != nil {
+		if _, ok := err.(*proof.Error); ok {
+			return events.APIGatewayProxyResponse{}, badRequest(err)
+		}
+		if err == proxy.ErrRevokedByUser {
+			return events.APIGatewayProxyResponse{}, &httpError{
+				statusCode: http.StatusConflict,
+				err:        err,
+			}
+		}
 		return events.APIGatewayProxyResponse{}, err
 	}
 
@@ -213,6 +376,53 @@ func twitterVerify(request *events.APIGatewayProxyRequest) (events.APIGatewayPro
 	}, nil
 }
 
+var errInvalidIssuedAt = errors.New(`"issuedAt" must be a Unix time`)
+
+func revokeProof(request *events.APIGatewayProxyRequest, platformName db.PlatformName) (events.APIGatewayProxyResponse, error) {
+	networkID, err := requireNetworkID(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	userAddress := request.QueryStringParameters["userAddress"]
+	if userAddress == "" {
+		return events.APIGatewayProxyResponse{}, badRequest(errEmptyUserAddress)
+	}
+	issuedAt, err := strconv.ParseInt(request.QueryStringParameters["issuedAt"], 10, 64)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, badRequest(errInvalidIssuedAt)
+	}
+
+	err = proxy.HandleRevoke(platformName, userAddress, networkID, issuedAt, request.QueryStringParameters["signature"])
+	switch err {
+	case nil:
+	case proxy.ErrInvalidRevokeSignature:
+		return events.APIGatewayProxyResponse{}, &httpError{
+			statusCode: http.StatusUnauthorized,
+			err:        err,
+		}
+	case proxy.ErrRevokeExpired:
+		return events.APIGatewayProxyResponse{}, badRequest(err)
+	case proxy.ErrRevokeOutdated:
+		return events.APIGatewayProxyResponse{}, &httpError{
+			statusCode: http.StatusConflict,
+			err:        err,
+		}
+	case db.ErrNotFound:
+		return events.APIGatewayProxyResponse{}, &httpError{
+			statusCode: http.StatusNotFound,
+			err:        err,
+		}
+	default:
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return events.APIGatewayProxyResponse{
+		Body:       "revoked",
+		StatusCode: 200,
+	}, nil
+}
+
 type lambdaHandler func(events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
 
 func errorHandler(h lambdaHandler) lambdaHandler {
@@ -220,8 +430,12 @@ func errorHandler(h lambdaHandler) lambdaHandler {
 		resp, err := h(request)
 
 		if err != nil {
+			statusCode := http.StatusInternalServerError
+			if e, ok := err.(*httpError); ok {
+				statusCode = e.statusCode
+			}
 			return events.APIGatewayProxyResponse{
-				StatusCode: http.StatusInternalServerError,
+				StatusCode: statusCode,
 				Body:       err.Error(),
 			}, nil
 		}
@@ -249,21 +463,31 @@ func corsHandler(h lambdaHandler) lambdaHandler {
 		resp.Headers["Access-Control-Allow-Headers"] = "Accept, Accept-Language, Content-Language, Content-Type"
 		resp.Headers["Access-Control-Allow-Methods"] = "GET, HEAD, POST, OPTIONS, PUT, DELETE, PATCH, CONNECT"
 		resp.Headers["Access-Control-Allow-Origin"] = "*"
+		resp.Headers["Access-Control-Expose-Headers"] = proxy.NextCursorHeader
 		resp.Headers["Vary"] = "Origin, Access-Control-Request-Method, Access-Control-Request-Headers"
 
 		return resp, err
 	}
 }
 
-func serializeUserInfoList(userInfoList []*proxy.UserInfo, err error) (events.APIGatewayProxyResponse, error) {
+// serializeUserInfoPage responds with the list of users, the cursor of the
+// next page is in the proxy.NextCursorHeader header.
+func serializeUserInfoPage(page *proxy.UserInfoPage, err error) (events.APIGatewayProxyResponse, error) {
 	if err != nil {
 		return events.APIGatewayProxyResponse{
 			StatusCode: http.StatusInternalServerError,
 		}, err
 	}
-	bs, _ := json.Marshal(userInfoList)
-	return events.APIGatewayProxyResponse{
+	bs, _ := json.Marshal(page.Users)
+	resp := events.APIGatewayProxyResponse{
 		StatusCode: http.StatusOK,
 		Body:       string(bs),
-	}, nil
+	}
+	if page.NextCursor != "" {
+		resp.Headers = map[string]string{
+			proxy.NextCursorHeader: page.NextCursor,
+		}
+	}
+
+	return resp, nil
 }
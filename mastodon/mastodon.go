@@ -0,0 +1,376 @@
+// Package mastodon logs the users in with their Mastodon instance and reads
+// their statuses. Every instance is a separate OAuth provider, the service
+// registers itself as an application on the instances the first time they
+// are used.
+package mastodon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/safehttp"
+	"golang.org/x/oauth2"
+)
+
+// Mastodon errors
+var (
+	ErrInvalidHandle            = errors.New("mastodon: invalid handle, expected @user@instance")
+	ErrHandleNotFound           = errors.New("mastodon: handle not found")
+	ErrInvalidActor             = errors.New("mastodon: the WebFinger actor is not the account of the handle")
+	ErrUnableToGetMastodonUser  = errors.New("mastodon: unable to get Mastodon User")
+	ErrInvalidStatusURL         = errors.New("mastodon: invalid status URL")
+	ErrStatusNotFound           = errors.New("mastodon: status not found")
+	ErrMissingCode              = errors.New("mastodon: callback is missing the code or the state")
+	errUnexpectedWebFingerReply = errors.New("mastodon: WebFinger response has no ActivityPub actor")
+)
+
+// Scope is the only permission asked to the users, it is enough to read
+// their account.
+const Scope = "read:accounts"
+
+// Client talks to any Mastodon instance.
+type Client struct {
+	// Scheme is https, it can be set to http to use a local fake instance.
+	Scheme      string
+	ClientName  string
+	Website     string
+	RedirectURL string
+	HTTPClient  *http.Client
+}
+
+// maxActorSize is the largest ActivityPub actor which is read.
+const maxActorSize = 1024 * 1024
+
+// NewClient reads MASTODON_CALLBACK_URL, the redirect URL registered on the
+// instances, and MASTODON_SCHEME. The instances are named by the users, so
+// they are only reached on public addresses, see safehttp.NewClient.
+func NewClient() *Client {
+	scheme := os.Getenv("MASTODON_SCHEME")
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	return &Client{
+		Scheme:      scheme,
+		ClientName:  "KeyMesh",
+		Website:     "https://keymesh.io",
+		RedirectURL: os.Getenv("MASTODON_CALLBACK_URL"),
+		HTTPClient:  safehttp.NewClient(10 * time.Second),
+	}
+}
+
+// Handle is a resolved fediverse account, Domain is the one of the handle
+// and Instance the host serving the account, they differ when the domain
+// delegates to another host.
+type Handle struct {
+	Username string
+	Domain   string
+	Instance string
+}
+
+func (h Handle) String() string {
+	return h.Username + "@" + h.Domain
+}
+
+var handlePattern = regexp.MustCompile(`^@?([A-Za-z0-9_]+)@([A-Za-z0-9.-]+(?::[0-9]+)?)$`)
+
+// ParseHandle splits a handle such as @alice@mastodon.social.
+func ParseHandle(handle string) (username, domain string, err error) {
+	matches := handlePattern.FindStringSubmatch(strings.TrimSpace(handle))
+	if matches == nil {
+		return "", "", ErrInvalidHandle
+	}
+
+	return matches[1], strings.ToLower(matches[2]), nil
+}
+
+type webFingerResource struct {
+	Subject string `json:"subject"`
+	Links   []struct {
+		Rel  string `json:"rel"`
+		Type string `json:"type"`
+		Href string `json:"href"`
+	} `json:"links"`
+}
+
+// actor is the ActivityPub representation of an account.
+type actor struct {
+	ID                string `json:"id"`
+	Type              string `json:"type"`
+	PreferredUsername string `json:"preferredUsername"`
+	Inbox             string `json:"inbox"`
+}
+
+// ResolveHandle finds the instance of the account with WebFinger, the
+// instance is only trusted once it serves the actor of the account.
+func (c *Client) ResolveHandle(handle string) (*Handle, error) {
+	username, domain, err := ParseHandle(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("resource", "acct:"+username+"@"+domain)
+	resp, err := c.HTTPClient.Get(c.Scheme + "://" + domain + "/.well-known/webfinger?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return nil, ErrHandleNotFound
+	default:
+		return nil, fmt.Errorf("mastodon: unexpected status %s for the WebFinger of %s", resp.Status, handle)
+	}
+
+	var resource webFingerResource
+	if err = json.NewDecoder(resp.Body).Decode(&resource); err != nil {
+		return nil, err
+	}
+
+	// the subject is the canonical form of the handle
+	if subject := strings.TrimPrefix(resource.Subject, "acct:"); subject != resource.Subject {
+		if username, domain, err = ParseHandle(subject); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, link := range resource.Links {
+		if link.Rel != "self" || link.Type != "application/activity+json" {
+			continue
+		}
+		actorURL, err := url.Parse(link.Href)
+		if err != nil || actorURL.Host == "" || actorURL.Scheme != c.Scheme {
+			break
+		}
+		if err = c.checkActor(link.Href, username); err != nil {
+			return nil, err
+		}
+		return &Handle{
+			Username: username,
+			Domain:   domain,
+			Instance: strings.ToLower(actorURL.Host),
+		}, nil
+	}
+
+	return nil, errUnexpectedWebFingerReply
+}
+
+// checkActor returns ErrInvalidActor unless actorURL serves the ActivityPub
+// actor of the account of username.
+func (c *Client) checkActor(actorURL, username string) error {
+	req, err := http.NewRequest(http.MethodGet, actorURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/activity+json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return ErrHandleNotFound
+	default:
+		return fmt.Errorf("mastodon: unexpected status %s fetching the actor %s", resp.Status, actorURL)
+	}
+
+	var a actor
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxActorSize)).Decode(&a); err != nil {
+		return ErrInvalidActor
+	}
+	if a.ID != actorURL || (a.Type != "Person" && a.Type != "Service") ||
+		!strings.EqualFold(a.PreferredUsername, username) || a.Inbox == "" {
+		return ErrInvalidActor
+	}
+
+	return nil
+}
+
+// RegisterApp registers the service as an application of the instance, the
+// instance must have been resolved from a handle first.
+func (c *Client) RegisterApp(instance string) (clientID, clientSecret string, err error) {
+	form := url.Values{}
+	form.Set("client_name", c.ClientName)
+	form.Set("redirect_uris", c.RedirectURL)
+	form.Set("scopes", Scope)
+	form.Set("website", c.Website)
+
+	resp, err := c.HTTPClient.PostForm(c.instanceURL(instance)+"/api/v1/apps", form)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("mastodon: unexpected status %s registering the app on %s", resp.Status, instance)
+	}
+
+	var app struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&app); err != nil {
+		return "", "", err
+	}
+	if app.ClientID == "" || app.ClientSecret == "" {
+		return "", "", fmt.Errorf("mastodon: %s did not return the app credentials", instance)
+	}
+
+	return app.ClientID, app.ClientSecret, nil
+}
+
+// Config returns the OAuth2 configuration of the app registered on the
+// instance.
+func (c *Client) Config(instance, clientID, clientSecret string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  c.RedirectURL,
+		Scopes:       []string{Scope},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  c.instanceURL(instance) + "/oauth/authorize",
+			TokenURL: c.instanceURL(instance) + "/oauth/token",
+		},
+	}
+}
+
+func (c *Client) instanceURL(instance string) string {
+	return c.Scheme + "://" + instance
+}
+
+// ParseAuthorizationCallback returns the authorization code and the state of
+// the callback request.
+func ParseAuthorizationCallback(req *http.Request) (code, state string, err error) {
+	if err = req.ParseForm(); err != nil {
+		return "", "", err
+	}
+
+	code = req.Form.Get("code")
+	state = req.Form.Get("state")
+	if code == "" || state == "" {
+		return "", "", ErrMissingCode
+	}
+
+	return code, state, nil
+}
+
+// Account is a Mastodon account, ID is local to the instance.
+type Account struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	Acct        string `json:"acct"`
+	DisplayName string `json:"display_name"`
+	URL         string `json:"url"`
+	Avatar      string `json:"avatar"`
+	Note        string `json:"note"`
+}
+
+type Status struct {
+	ID         string   `json:"id"`
+	URL        string   `json:"url"`
+	Visibility string   `json:"visibility"`
+	Content    string   `json:"content"`
+	Account    *Account `json:"account"`
+}
+
+// GetAccount exchanges the authorization code for an access token and
+// returns the account which logged in.
+func (c *Client) GetAccount(instance string, config *oauth2.Config, code string) (*Account, error) {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, c.HTTPClient)
+	token, err := config.Exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := config.Client(ctx, token).Get(c.instanceURL(instance) + "/api/v1/accounts/verify_credentials")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrUnableToGetMastodonUser
+	}
+
+	var account Account
+	if err = json.NewDecoder(resp.Body).Decode(&account); err != nil {
+		return nil, err
+	}
+	if account.ID == "" || account.Username == "" {
+		return nil, ErrUnableToGetMastodonUser
+	}
+
+	return &account, nil
+}
+
+var statusPathPattern = regexp.MustCompile(`^/(?:@[A-Za-z0-9_]+|users/[A-Za-z0-9_]+/statuses|web/statuses)/([0-9]+)/?$`)
+
+// ParseStatusURL returns the instance and the ID of a status URL such as
+// https://mastodon.social/@alice/103270115826048975.
+func ParseStatusURL(statusURL string) (instance, statusID string, err error) {
+	u, err := url.Parse(statusURL)
+	if err != nil || u.Host == "" {
+		return "", "", ErrInvalidStatusURL
+	}
+
+	matches := statusPathPattern.FindStringSubmatch(u.Path)
+	if matches == nil {
+		return "", "", ErrInvalidStatusURL
+	}
+
+	return strings.ToLower(u.Host), matches[1], nil
+}
+
+// FetchStatus reads the status anonymously, so only the public and unlisted
+// statuses can be found.
+func (c *Client) FetchStatus(instance, statusID string) (*Status, error) {
+	resp, err := c.HTTPClient.Get(c.instanceURL(instance) + "/api/v1/statuses/" + url.PathEscape(statusID))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone, http.StatusUnauthorized, http.StatusForbidden:
+		return nil, ErrStatusNotFound
+	default:
+		return nil, fmt.Errorf("mastodon: unexpected status %s fetching status %s on %s", resp.Status, statusID, instance)
+	}
+
+	var status Status
+	if err = json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+var (
+	lineBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</p>`)
+	tagPattern       = regexp.MustCompile(`<[^>]*>`)
+)
+
+// Text returns the content of the status without its HTML markup.
+func (s *Status) Text() string {
+	text := lineBreakPattern.ReplaceAllString(s.Content, " ")
+	text = tagPattern.ReplaceAllString(text, "")
+	return html.UnescapeString(text)
+}
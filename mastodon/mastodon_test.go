@@ -0,0 +1,248 @@
+package mastodon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeInstance serves the WebFinger of alice, her actor, the app
+// registration, the login of alice and her statuses.
+func fakeInstance(t *testing.T) (*Client, string, *int) {
+	t.Helper()
+
+	var (
+		instance      string
+		registrations int
+	)
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		resource := r.URL.Query().Get("resource")
+		username := strings.TrimSuffix(strings.TrimPrefix(resource, "acct:"), "@"+instance)
+		switch strings.ToLower(username) {
+		case "alice", "impostor", "nobody":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"subject": "acct:" + strings.ToLower(username) + "@" + instance,
+			"links": []map[string]string{
+				{"rel": "http://webfinger.net/rel/profile-page", "type": "text/html", "href": "http://" + instance + "/@" + username},
+				{"rel": "self", "type": "application/activity+json", "href": "http://" + instance + "/users/" + strings.ToLower(username)},
+			},
+		})
+	})
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/activity+json" {
+			t.Errorf("got Accept %q", r.Header.Get("Accept"))
+		}
+		username := strings.TrimPrefix(r.URL.Path, "/users/")
+		switch username {
+		case "alice":
+			writeJSON(w, actor{ID: "http://" + instance + r.URL.Path, Type: "Person", PreferredUsername: "alice", Inbox: "http://" + instance + r.URL.Path + "/inbox"})
+		case "impostor":
+			// the actor of another account
+			writeJSON(w, actor{ID: "http://" + instance + "/users/alice", Type: "Person", PreferredUsername: "alice", Inbox: "http://" + instance + "/users/alice/inbox"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc("/api/v1/apps", func(w http.ResponseWriter, r *http.Request) {
+		registrations++
+		if r.PostFormValue("scopes") != Scope || r.PostFormValue("redirect_uris") != "http://keymesh.test/callback" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		writeJSON(w, map[string]string{"client_id": "client", "client_secret": "secret"})
+	})
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "code" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		writeJSON(w, map[string]string{"access_token": "token", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/api/v1/accounts/verify_credentials", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, Account{ID: "1", Username: "alice", Acct: "alice"})
+	})
+	mux.HandleFunc("/api/v1/statuses/", func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/api/v1/statuses/") {
+		case "10":
+			writeJSON(w, Status{ID: "10", Visibility: "public", Content: "<p>hello &amp; welcome<br>world</p>", Account: &Account{ID: "1"}})
+		case "11":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	instance = strings.TrimPrefix(server.URL, "http://")
+
+	return &Client{
+		Scheme:      "http",
+		ClientName:  "KeyMesh",
+		RedirectURL: "http://keymesh.test/callback",
+		HTTPClient:  server.Client(),
+	}, instance, &registrations
+}
+
+func TestParseHandle(t *testing.T) {
+	tests := []struct {
+		handle   string
+		username string
+		domain   string
+	}{
+		{"@alice@mastodon.social", "alice", "mastodon.social"},
+		{" alice@Mastodon.Social ", "alice", "mastodon.social"},
+		{"@alice@localhost:3000", "alice", "localhost:3000"},
+		{"@alice", "", ""},
+		{"alice@mastodon.social/path", "", ""},
+		{"@al ice@mastodon.social", "", ""},
+	}
+
+	for _, test := range tests {
+		username, domain, err := ParseHandle(test.handle)
+		if test.username == "" {
+			if err != ErrInvalidHandle {
+				t.Errorf("%q: got %v, want ErrInvalidHandle", test.handle, err)
+			}
+			continue
+		}
+		if err != nil || username != test.username || domain != test.domain {
+			t.Errorf("%q: got %q, %q, %v", test.handle, username, domain, err)
+		}
+	}
+}
+
+func TestResolveHandle(t *testing.T) {
+	client, instance, _ := fakeInstance(t)
+
+	handle, err := client.ResolveHandle("@Alice@" + instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handle.Username != "alice" || handle.Domain != instance || handle.Instance != instance {
+		t.Errorf("got %+v", handle)
+	}
+	if handle.String() != "alice@"+instance {
+		t.Errorf("got handle %s", handle)
+	}
+
+	tests := map[string]error{
+		"@bob@" + instance:      ErrHandleNotFound,
+		"@impostor@" + instance: ErrInvalidActor,
+		"@nobody@" + instance:   ErrHandleNotFound,
+		"bob":                   ErrInvalidHandle,
+	}
+	for h, want := range tests {
+		if _, err = client.ResolveHandle(h); err != want {
+			t.Errorf("%s: got %v, want %v", h, err, want)
+		}
+	}
+}
+
+func TestResolveHandleRefusesPrivateAddresses(t *testing.T) {
+	client, instance, registrations := fakeInstance(t)
+	client.HTTPClient = NewClient().HTTPClient
+
+	if _, err := client.ResolveHandle("@alice@" + instance); err == nil {
+		t.Error("got no error for an instance on the loopback address")
+	}
+	if *registrations != 0 {
+		t.Errorf("got %d app registrations", *registrations)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	client, instance, registrations := fakeInstance(t)
+
+	clientID, clientSecret, err := client.RegisterApp(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clientID != "client" || clientSecret != "secret" || *registrations != 1 {
+		t.Errorf("got %q, %q after %d registrations", clientID, clientSecret, *registrations)
+	}
+
+	config := client.Config(instance, clientID, clientSecret)
+	if want := fmt.Sprintf("http://%s/oauth/authorize", instance); !strings.HasPrefix(config.AuthCodeURL("state"), want) {
+		t.Errorf("got %s, want %s", config.AuthCodeURL("state"), want)
+	}
+
+	account, err := client.GetAccount(instance, config, "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.ID != "1" || account.Username != "alice" {
+		t.Errorf("got %+v", account)
+	}
+
+	if _, err = client.GetAccount(instance, config, "wrong"); err == nil {
+		t.Error("got no error for an invalid code")
+	}
+}
+
+func TestParseStatusURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		instance string
+		statusID string
+	}{
+		{"https://mastodon.social/@alice/103270115826048975", "mastodon.social", "103270115826048975"},
+		{"https://Mastodon.Social/users/alice/statuses/1/", "mastodon.social", "1"},
+		{"https://mastodon.social/web/statuses/1", "mastodon.social", "1"},
+		{"https://mastodon.social/@alice", "", ""},
+		{"/@alice/1", "", ""},
+	}
+
+	for _, test := range tests {
+		instance, statusID, err := ParseStatusURL(test.url)
+		if test.statusID == "" {
+			if err != ErrInvalidStatusURL {
+				t.Errorf("%s: got %v, want ErrInvalidStatusURL", test.url, err)
+			}
+			continue
+		}
+		if err != nil || instance != test.instance || statusID != test.statusID {
+			t.Errorf("%s: got %q, %q, %v", test.url, instance, statusID, err)
+		}
+	}
+}
+
+func TestFetchStatus(t *testing.T) {
+	client, instance, _ := fakeInstance(t)
+
+	status, err := client.FetchStatus(instance, "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Account == nil || status.Account.ID != "1" || status.Visibility != "public" {
+		t.Errorf("got %+v", status)
+	}
+	if text := status.Text(); text != "hello & welcome world " {
+		t.Errorf("got text %q", text)
+	}
+
+	// the private statuses can not be read anonymously
+	for _, statusID := range []string{"11", "12"} {
+		if _, err = client.FetchStatus(instance, statusID); err != ErrStatusNotFound {
+			t.Errorf("status %s: got %v, want ErrStatusNotFound", statusID, err)
+		}
+	}
+}
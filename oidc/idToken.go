@@ -0,0 +1,348 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	// registers SHA-384 and SHA-512 for crypto.Hash
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// ID token errors
+var (
+	ErrMalformedIDToken = errors.New("oidc: malformed ID token")
+	ErrUnsupportedAlg   = errors.New("oidc: unsupported ID token signing algorithm")
+	ErrUnknownKey       = errors.New("oidc: ID token is signed by an unknown key")
+	ErrInvalidSignature = errors.New("oidc: invalid ID token signature")
+)
+
+// clockSkew is the difference tolerated between the clocks of the provider
+// and of the service.
+const clockSkew = time.Minute
+
+// keysRefreshInterval limits how often the keys are fetched again when a
+// token is signed by an unknown key.
+const keysRefreshInterval = time.Minute
+
+// Claims are the claims of an ID token.
+type Claims map[string]interface{}
+
+// String returns the claim if it is a string.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Bool returns the claim if it is a boolean, some providers send the
+// booleans as strings.
+func (c Claims) Bool(name string) bool {
+	switch v := c[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// Time returns the claim if it is a NumericDate.
+func (c Claims) Time(name string) (time.Time, bool) {
+	v, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(v), 0), true
+}
+
+// Audience returns the aud claim, which is either a string or an array.
+func (c Claims) Audience() []string {
+	switch v := c["aud"].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		audience := make([]string, 0, len(v))
+		for _, aud := range v {
+			if s, ok := aud.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+		return audience
+	}
+	return nil
+}
+
+type idTokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// VerifyIDToken checks the signature of the ID token against the keys of the
+// provider, that it was issued by the provider for the client and that it
+// carries the nonce of the login.
+func (p *Provider) VerifyIDToken(rawIDToken, nonce string) (Claims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedIDToken
+	}
+
+	var header idTokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrMalformedIDToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedIDToken
+	}
+
+	key, err := p.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformedIDToken
+	}
+	if err = p.checkClaims(claims, nonce); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (p *Provider) checkClaims(claims Claims, nonce string) error {
+	discovery, err := p.Discover()
+	if err != nil {
+		return err
+	}
+
+	if claims.String("iss") != discovery.Issuer {
+		return fmt.Errorf("oidc: ID token issued by %s", claims.String("iss"))
+	}
+	if claims.String("sub") == "" {
+		return fmt.Errorf("oidc: ID token has no subject")
+	}
+
+	audience := claims.Audience()
+	found := false
+	for _, aud := range audience {
+		found = found || aud == p.Config.ClientID
+	}
+	if !found {
+		return fmt.Errorf("oidc: ID token is not for client %s", p.Config.ClientID)
+	}
+	if len(audience) > 1 && claims.String("azp") != p.Config.ClientID {
+		return fmt.Errorf("oidc: ID token is authorized for %s", claims.String("azp"))
+	}
+
+	now := time.Now()
+	expiresAt, ok := claims.Time("exp")
+	if !ok || now.After(expiresAt.Add(clockSkew)) {
+		return fmt.Errorf("oidc: ID token has expired")
+	}
+	if issuedAt, ok := claims.Time("iat"); ok && issuedAt.After(now.Add(clockSkew)) {
+		return fmt.Errorf("oidc: ID token is issued in the future")
+	}
+
+	if claims.String("nonce") != nonce {
+		return fmt.Errorf("oidc: ID token nonce does not match the login")
+	}
+
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	bs, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, v)
+}
+
+// ecdsaAlgs maps the sizes of the curves to the algorithm using them.
+var ecdsaAlgs = map[int]string{
+	256: "ES256",
+	384: "ES384",
+	521: "ES512",
+}
+
+// verifySignature only accepts the asymmetric algorithms, the key type must
+// match the algorithm.
+func verifySignature(alg string, key interface{}, signed, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return ErrUnsupportedAlg
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' {
+			return ErrUnsupportedAlg
+		}
+		if rsa.VerifyPKCS1v15(key, hash, digest, signature) != nil {
+			return ErrInvalidSignature
+		}
+	case *ecdsa.PublicKey:
+		bitSize := key.Curve.Params().BitSize
+		if alg != ecdsaAlgs[bitSize] {
+			return ErrUnsupportedAlg
+		}
+		size := (bitSize + 7) / 8
+		if len(signature) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnsupportedAlg
+	}
+
+	return nil
+}
+
+// key returns the key of the provider with the ID, the keys are fetched
+// again when the ID is unknown since the providers rotate their keys.
+func (p *Provider) key(kid string) (interface{}, error) {
+	p.mutex.Lock()
+	key, ok := p.keys[kid]
+	stale := time.Since(p.keysFetchedAt) > keysRefreshInterval
+	p.mutex.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, ErrUnknownKey
+	}
+
+	if err := p.fetchKeys(); err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	key, ok = p.keys[kid]
+	p.mutex.Unlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (p *Provider) fetchKeys() error {
+	discovery, err := p.Discover()
+	if err != nil {
+		return err
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err = p.getJSON(discovery.JWKSURI, &jwks); err != nil {
+		return err
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// the keys of unsupported types are skipped
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	p.mutex.Lock()
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	p.mutex.Unlock()
+
+	return nil
+}
+
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("oidc: RSA key %s has an invalid exponent", jwk.Kid)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("oidc: unsupported curve %s", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("oidc: EC key %s is not on its curve", jwk.Kid)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("oidc: unsupported key type %s", jwk.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bs), nil
+}
@@ -0,0 +1,326 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIssuer is an OpenID Connect provider serving its discovery document,
+// its keys and the logins with the code "code".
+type fakeIssuer struct {
+	*httptest.Server
+
+	mutex       sync.Mutex
+	keys        []jsonWebKey
+	jwksFetches int
+	// idToken is returned by the token endpoint.
+	idToken string
+	// userinfo is returned by the userinfo endpoint.
+	userinfo Claims
+	verifier string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+
+	issuer := &fakeIssuer{}
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, Discovery{
+			Issuer:                issuer.URL,
+			AuthorizationEndpoint: issuer.URL + "/authorize",
+			TokenEndpoint:         issuer.URL + "/token",
+			UserinfoEndpoint:      issuer.URL + "/userinfo",
+			JWKSURI:               issuer.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mutex.Lock()
+		defer issuer.mutex.Unlock()
+		issuer.jwksFetches++
+		writeJSON(w, map[string]interface{}{"keys": issuer.keys})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mutex.Lock()
+		defer issuer.mutex.Unlock()
+		if r.PostFormValue("code") != "code" || r.PostFormValue("code_verifier") != issuer.verifier {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		writeJSON(w, map[string]string{"access_token": "token", "token_type": "Bearer", "id_token": issuer.idToken})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mutex.Lock()
+		defer issuer.mutex.Unlock()
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, issuer.userinfo)
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+
+	return issuer
+}
+
+// provider returns the provider of the issuer for the client "client".
+func (i *fakeIssuer) provider() *Provider {
+	p := NewProvider(ProviderConfig{
+		PlatformName:  "fake",
+		Issuer:        i.URL,
+		ClientID:      "client",
+		UsernameClaim: "email",
+	})
+	p.HTTPClient = i.Client()
+	return p
+}
+
+// publish adds the public key to the keys of the issuer.
+func (i *fakeIssuer) publish(kid string, key interface{}) {
+	jwk := jsonWebKey{Kid: kid, Use: "sig"}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.Kty = "EC"
+		jwk.Crv = key.Curve.Params().Name
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk.X = base64.RawURLEncoding.EncodeToString(padTo(key.X.Bytes(), size))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(padTo(key.Y.Bytes(), size))
+	}
+
+	i.mutex.Lock()
+	i.keys = append(i.keys, jwk)
+	i.mutex.Unlock()
+}
+
+func (i *fakeIssuer) fetches() int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.jwksFetches
+}
+
+func padTo(bs []byte, size int) []byte {
+	padded := make([]byte, size)
+	copy(padded[size-len(bs):], bs)
+	return padded
+}
+
+// signIDToken returns the ID token of the claims signed by key with alg, the
+// key is either a private key or the secret of a HMAC.
+func signIDToken(t *testing.T, alg, kid string, key interface{}, claims Claims) string {
+	t.Helper()
+
+	header, _ := json.Marshal(idTokenHeader{Alg: alg, Kid: kid})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest[:])
+		signature = append(padTo(r.Bytes(), 32), padTo(s.Bytes(), 32)...)
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// validClaims are the claims of a login of alice by the client.
+func validClaims(issuer string) Claims {
+	now := time.Now()
+	return Claims{
+		"iss":            issuer,
+		"sub":            "248289761001",
+		"aud":            "client",
+		"exp":            float64(now.Add(time.Hour).Unix()),
+		"iat":            float64(now.Unix()),
+		"nonce":          "nonce",
+		"email":          "alice@example.com",
+		"email_verified": true,
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.publish("rsa", &rsaKey.PublicKey)
+	issuer.publish("ec", &ecKey.PublicKey)
+	p := issuer.provider()
+	claims := validClaims(issuer.URL)
+
+	for _, token := range []string{
+		signIDToken(t, "RS256", "rsa", rsaKey, claims),
+		signIDToken(t, "ES256", "ec", ecKey, claims),
+	} {
+		verified, err := p.VerifyIDToken(token, "nonce")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if verified.String("sub") != "248289761001" || verified.String("email") != "alice@example.com" {
+			t.Errorf("got claims %v", verified)
+		}
+	}
+
+	valid := signIDToken(t, "RS256", "rsa", rsaKey, claims)
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"other key", signIDToken(t, "RS256", "rsa", otherKey, claims), ErrInvalidSignature},
+		{"tampered signature", valid[:len(valid)-4] + "AAAA", ErrInvalidSignature},
+		{"alg none", signIDToken(t, "none", "rsa", nil, claims), ErrUnsupportedAlg},
+		{"HS256 with the public key", signIDToken(t, "HS256", "rsa", rsaKey.PublicKey.N.Bytes(), claims), ErrUnsupportedAlg},
+		{"ES256 with an RSA key", signIDToken(t, "ES256", "rsa", ecKey, claims), ErrUnsupportedAlg},
+		{"RS256 with an EC key", signIDToken(t, "RS256", "ec", rsaKey, claims), ErrUnsupportedAlg},
+		{"ES384 with a P-256 key", signIDToken(t, "ES384", "ec", ecKey, claims), ErrUnsupportedAlg},
+		{"unknown kid", signIDToken(t, "RS256", "unknown", rsaKey, claims), ErrUnknownKey},
+		{"two segments", "a.b", ErrMalformedIDToken},
+		{"not base64", "!.!.!", ErrMalformedIDToken},
+	}
+	for _, test := range tests {
+		if _, err := p.VerifyIDToken(test.token, "nonce"); err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestVerifyIDTokenClaims(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.publish("rsa", &key.PublicKey)
+	p := issuer.provider()
+
+	now := time.Now()
+	tests := []struct {
+		name   string
+		change func(Claims)
+		nonce  string
+		valid  bool
+	}{
+		{"valid", func(c Claims) {}, "nonce", true},
+		{"audiences with azp", func(c Claims) { c["aud"] = []interface{}{"client", "other"}; c["azp"] = "client" }, "nonce", true},
+		{"expired within the skew", func(c Claims) { c["exp"] = float64(now.Add(-clockSkew / 2).Unix()) }, "nonce", true},
+		{"wrong iss", func(c Claims) { c["iss"] = "https://attacker.example" }, "nonce", false},
+		{"no sub", func(c Claims) { delete(c, "sub") }, "nonce", false},
+		{"wrong aud", func(c Claims) { c["aud"] = "other" }, "nonce", false},
+		{"audiences without azp", func(c Claims) { c["aud"] = []interface{}{"client", "other"} }, "nonce", false},
+		{"audiences with another azp", func(c Claims) { c["aud"] = []interface{}{"client", "other"}; c["azp"] = "other" }, "nonce", false},
+		{"expired", func(c Claims) { c["exp"] = float64(now.Add(-time.Hour).Unix()) }, "nonce", false},
+		{"no exp", func(c Claims) { delete(c, "exp") }, "nonce", false},
+		{"issued in the future", func(c Claims) { c["iat"] = float64(now.Add(time.Hour).Unix()) }, "nonce", false},
+		{"nonce mismatch", func(c Claims) {}, "other", false},
+		{"no nonce", func(c Claims) { delete(c, "nonce") }, "nonce", false},
+	}
+	for _, test := range tests {
+		claims := validClaims(issuer.URL)
+		test.change(claims)
+		_, err := p.VerifyIDToken(signIDToken(t, "RS256", "rsa", key, claims), test.nonce)
+		if test.valid && err != nil {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: got no error", test.name)
+		}
+	}
+}
+
+func TestKeysRefreshIsThrottled(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.publish("old", &key.PublicKey)
+	p := issuer.provider()
+	claims := validClaims(issuer.URL)
+
+	if _, err = p.VerifyIDToken(signIDToken(t, "RS256", "old", key, claims), "nonce"); err != nil {
+		t.Fatal(err)
+	}
+	if fetches := issuer.fetches(); fetches != 1 {
+		t.Fatalf("got %d fetches of the keys", fetches)
+	}
+
+	// the provider rotates its key
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.publish("new", &rotated.PublicKey)
+	token := signIDToken(t, "RS256", "new", rotated, claims)
+
+	// the unknown keys do not fetch the keys again right away
+	for i := 0; i < 3; i++ {
+		if _, err = p.VerifyIDToken(token, "nonce"); err != ErrUnknownKey {
+			t.Errorf("got %v, want ErrUnknownKey", err)
+		}
+	}
+	if fetches := issuer.fetches(); fetches != 1 {
+		t.Errorf("got %d fetches of the keys within the refresh interval", fetches)
+	}
+
+	// they do once the interval has passed
+	p.mutex.Lock()
+	p.keysFetchedAt = time.Now().Add(-keysRefreshInterval - time.Second)
+	p.mutex.Unlock()
+	if _, err = p.VerifyIDToken(token, "nonce"); err != nil {
+		t.Errorf("got %v after the refresh", err)
+	}
+	if _, err = p.VerifyIDToken(signIDToken(t, "RS256", "unknown", rotated, claims), "nonce"); err != ErrUnknownKey {
+		t.Errorf("got %v, want ErrUnknownKey", err)
+	}
+	if fetches := issuer.fetches(); fetches != 2 {
+		t.Errorf("got %d fetches of the keys", fetches)
+	}
+}
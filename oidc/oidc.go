@@ -0,0 +1,356 @@
+// Package oidc logs the users in with any OpenID Connect provider. The
+// endpoints of the providers are read from their discovery document, the
+// logins use the authorization code flow with PKCE and the ID tokens are
+// checked against the keys the providers publish.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/pkce"
+	"golang.org/x/oauth2"
+)
+
+// OIDC errors
+var (
+	ErrMissingCode       = errors.New("oidc: callback is missing the code or the state")
+	ErrMissingIDToken    = errors.New("oidc: token response has no ID token")
+	ErrMissingUsername   = errors.New("oidc: the ID token has no username claim")
+	ErrUnverifiedEmail   = errors.New("oidc: the email address is not verified")
+	ErrDocumentNotFound  = errors.New("oidc: document not found")
+	errInvalidDiscovery  = errors.New("oidc: discovery document is missing endpoints")
+	errUnexpectedSubject = errors.New("oidc: userinfo subject does not match the ID token")
+)
+
+// maxDocumentSize is the largest proof document which is read.
+const maxDocumentSize = 64 * 1024
+
+// ProviderConfig enables an OpenID Connect provider as a platform.
+type ProviderConfig struct {
+	PlatformName string `json:"platformName"`
+	// Issuer is the URL the discovery document is read from, it must match
+	// the iss claim of the ID tokens.
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"clientID"`
+	ClientSecret string `json:"clientSecret"`
+	// ClientSecretEnv names the environment variable holding the client
+	// secret, to keep it out of the file.
+	ClientSecretEnv string   `json:"clientSecretEnv"`
+	RedirectURL     string   `json:"redirectURL"`
+	Scopes          []string `json:"scopes"`
+	// UsernameClaim is the claim the proofs are made for, email by default.
+	// Only verified email addresses are accepted.
+	UsernameClaim string `json:"usernameClaim"`
+	// ProofURLPrefix is where the users can publish their proofs, {username}
+	// is replaced by their username. The platforms without it have no proofs.
+	ProofURLPrefix string `json:"proofURLPrefix"`
+}
+
+// LoadConfigs reads the JSON array of ProviderConfig at OIDC_PROVIDERS, no
+// provider is enabled if it is not set.
+func LoadConfigs() ([]ProviderConfig, error) {
+	configPath := os.Getenv("OIDC_PROVIDERS")
+	if configPath == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(configPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var configs []ProviderConfig
+	if err = json.NewDecoder(f).Decode(&configs); err != nil {
+		return nil, fmt.Errorf("%s: %s", configPath, err)
+	}
+
+	for i, config := range configs {
+		if config.PlatformName == "" || config.Issuer == "" || config.ClientID == "" {
+			return nil, fmt.Errorf("%s: provider %d needs a platformName, an issuer and a clientID", configPath, i)
+		}
+		if config.ClientSecretEnv != "" {
+			configs[i].ClientSecret = os.Getenv(config.ClientSecretEnv)
+		}
+		if config.UsernameClaim == "" {
+			configs[i].UsernameClaim = "email"
+		}
+		if len(config.Scopes) == 0 {
+			configs[i].Scopes = []string{"openid", "email", "profile"}
+		}
+	}
+
+	return configs, nil
+}
+
+// Discovery is the part of the discovery document which is used.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect provider, its discovery document and keys
+// are fetched on first use.
+type Provider struct {
+	Config     ProviderConfig
+	HTTPClient *http.Client
+
+	mutex         sync.Mutex
+	discovery     *Discovery
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+func NewProvider(config ProviderConfig) *Provider {
+	return &Provider{
+		Config:     config,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Discover returns the discovery document of the issuer.
+func (p *Provider) Discover() (*Discovery, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery Discovery
+	wellKnown := strings.TrimSuffix(p.Config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(wellKnown, &discovery); err != nil {
+		return nil, err
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errInvalidDiscovery
+	}
+	if discovery.Issuer != p.Config.Issuer {
+		return nil, fmt.Errorf("oidc: discovery document of %s is for issuer %s", p.Config.Issuer, discovery.Issuer)
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+func (p *Provider) oauth2Config() (*oauth2.Config, error) {
+	discovery, err := p.Discover()
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.Config.ClientID,
+		ClientSecret: p.Config.ClientSecret,
+		RedirectURL:  p.Config.RedirectURL,
+		Scopes:       p.Config.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+	}, nil
+}
+
+// AuthCodeURL returns the URL the user logs in at, the verifier and the nonce
+// must be kept until the callback.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) (string, error) {
+	config, err := p.oauth2Config()
+	if err != nil {
+		return "", err
+	}
+
+	options := append(pkce.ChallengeOptions(verifier), oauth2.SetAuthURLParam("nonce", nonce))
+	return config.AuthCodeURL(state, options...), nil
+}
+
+// ParseAuthorizationCallback returns the authorization code and the state of
+// the callback request.
+func ParseAuthorizationCallback(req *http.Request) (code, state string, err error) {
+	if err = req.ParseForm(); err != nil {
+		return "", "", err
+	}
+
+	code = req.Form.Get("code")
+	state = req.Form.Get("state")
+	if code == "" || state == "" {
+		return "", "", ErrMissingCode
+	}
+
+	return code, state, nil
+}
+
+// Identity is the user as described by the ID token, and by the userinfo
+// endpoint when the ID token lacks the username claim.
+type Identity struct {
+	Issuer        string `json:"issuer"`
+	Subject       string `json:"sub"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+}
+
+// Exchange exchanges the authorization code for an ID token and returns the
+// identity it asserts.
+func (p *Provider) Exchange(code, verifier, nonce string) (*Identity, error) {
+	discovery, err := p.Discover()
+	if err != nil {
+		return nil, err
+	}
+	config, err := p.oauth2Config()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, p.HTTPClient)
+	token, err := config.Exchange(ctx, code, pkce.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, ErrMissingIDToken
+	}
+
+	claims, err := p.VerifyIDToken(rawIDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := claims[p.Config.UsernameClaim]; !ok && discovery.UserinfoEndpoint != "" {
+		if err = p.mergeUserinfo(ctx, config, discovery.UserinfoEndpoint, token, claims); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.identity(claims)
+}
+
+// mergeUserinfo adds the claims of the userinfo endpoint which are missing
+// from the ID token.
+func (p *Provider) mergeUserinfo(ctx context.Context, config *oauth2.Config, userinfoURL string, token *oauth2.Token, claims Claims) error {
+	resp, err := config.Client(ctx, token).Get(userinfoURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: unexpected status %s for the userinfo of %s", resp.Status, p.Config.Issuer)
+	}
+
+	var userinfo Claims
+	if err = json.NewDecoder(resp.Body).Decode(&userinfo); err != nil {
+		return err
+	}
+	if userinfo.String("sub") != claims.String("sub") {
+		return errUnexpectedSubject
+	}
+
+	for k, v := range userinfo {
+		if _, ok := claims[k]; !ok {
+			claims[k] = v
+		}
+	}
+
+	return nil
+}
+
+func (p *Provider) identity(claims Claims) (*Identity, error) {
+	identity := &Identity{
+		Issuer:        claims.String("iss"),
+		Subject:       claims.String("sub"),
+		Username:      claims.String(p.Config.UsernameClaim),
+		Email:         claims.String("email"),
+		EmailVerified: claims.Bool("email_verified"),
+		Name:          claims.String("name"),
+		Picture:       claims.String("picture"),
+	}
+	if identity.Username == "" {
+		return nil, ErrMissingUsername
+	}
+	// anyone can claim an address they do not own
+	if p.Config.UsernameClaim == "email" && !identity.EmailVerified {
+		return nil, ErrUnverifiedEmail
+	}
+
+	return identity, nil
+}
+
+// ProofURLAllowed reports whether the proof URL is the proof prefix of the
+// user or a path under it.
+func (p *Provider) ProofURLAllowed(username, proofURL string) bool {
+	if p.Config.ProofURLPrefix == "" {
+		return false
+	}
+
+	// the dot segments would leave the prefix once resolved
+	u, err := url.Parse(proofURL)
+	if err != nil || u.User != nil {
+		return false
+	}
+	cleaned := path.Clean(u.Path)
+	if cleaned != "/" && strings.HasSuffix(u.Path, "/") {
+		cleaned += "/"
+	}
+	if cleaned != u.Path {
+		return false
+	}
+
+	// the prefix ends at a path boundary so that alice can not publish under
+	// the prefix of alicebob
+	prefix := strings.Replace(p.Config.ProofURLPrefix, "{username}", url.PathEscape(username), -1)
+	prefix = strings.TrimSuffix(prefix, "/")
+	return proofURL == prefix || strings.HasPrefix(proofURL, prefix+"/")
+}
+
+// FetchDocument returns the content of the proof document.
+func (p *Provider) FetchDocument(documentURL string) (string, error) {
+	resp, err := p.HTTPClient.Get(documentURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone, http.StatusUnauthorized, http.StatusForbidden:
+		return "", ErrDocumentNotFound
+	default:
+		return "", fmt.Errorf("oidc: unexpected status %s for %s", resp.Status, documentURL)
+	}
+
+	bs, err := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: maxDocumentSize})
+	return string(bs), err
+}
+
+func (p *Provider) getJSON(url string, v interface{}) error {
+	resp, err := p.HTTPClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: unexpected status %s for %s", resp.Status, url)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
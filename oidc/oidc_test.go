@@ -0,0 +1,138 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/url"
+	"testing"
+
+	"github.com/dcb9/keymeshOAuth/pkce"
+)
+
+func TestAuthCodeURL(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	p := issuer.provider()
+
+	authURL, err := p.AuthCodeURL("state", "nonce", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if u.Path != "/authorize" || query.Get("state") != "state" || query.Get("nonce") != "nonce" {
+		t.Errorf("got %s", authURL)
+	}
+	if query.Get("code_challenge") != pkce.Challenge("verifier") || query.Get("code_challenge_method") != "S256" {
+		t.Errorf("got challenge %q", query.Get("code_challenge"))
+	}
+}
+
+func TestDiscoverChecksIssuer(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	p := issuer.provider()
+	// the document of the issuer is served for another issuer
+	p.Config.Issuer = issuer.URL + "/"
+
+	if _, err := p.Discover(); err == nil {
+		t.Error("got no error for a document of another issuer")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.publish("rsa", &key.PublicKey)
+	issuer.verifier = "verifier"
+	p := issuer.provider()
+
+	issuer.idToken = signIDToken(t, "RS256", "rsa", key, validClaims(issuer.URL))
+	identity, err := p.Exchange("code", "verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "248289761001" || identity.Username != "alice@example.com" || identity.Issuer != issuer.URL {
+		t.Errorf("got %+v", identity)
+	}
+
+	if _, err = p.Exchange("code", "other", "nonce"); err == nil {
+		t.Error("got no error for another verifier")
+	}
+	if _, err = p.Exchange("code", "verifier", "other"); err == nil {
+		t.Error("got no error for another nonce")
+	}
+
+	claims := validClaims(issuer.URL)
+	claims["email_verified"] = false
+	issuer.idToken = signIDToken(t, "RS256", "rsa", key, claims)
+	if _, err = p.Exchange("code", "verifier", "nonce"); err != ErrUnverifiedEmail {
+		t.Errorf("got %v, want ErrUnverifiedEmail", err)
+	}
+
+	issuer.idToken = ""
+	if _, err = p.Exchange("code", "verifier", "nonce"); err != ErrMissingIDToken {
+		t.Errorf("got %v, want ErrMissingIDToken", err)
+	}
+}
+
+func TestExchangeMergesUserinfo(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.publish("rsa", &key.PublicKey)
+	p := issuer.provider()
+
+	// the ID token has no email, it is read from the userinfo
+	claims := validClaims(issuer.URL)
+	delete(claims, "email")
+	delete(claims, "email_verified")
+	issuer.idToken = signIDToken(t, "RS256", "rsa", key, claims)
+	issuer.userinfo = Claims{"sub": "248289761001", "email": "alice@example.com", "email_verified": true}
+
+	identity, err := p.Exchange("code", "", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Username != "alice@example.com" || !identity.EmailVerified {
+		t.Errorf("got %+v", identity)
+	}
+
+	// the userinfo of another user is not merged
+	issuer.userinfo = Claims{"sub": "1", "email": "mallory@example.com", "email_verified": true}
+	if _, err = p.Exchange("code", "", "nonce"); err != errUnexpectedSubject {
+		t.Errorf("got %v, want errUnexpectedSubject", err)
+	}
+}
+
+func TestProofURLAllowed(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		proofURL string
+		allowed  bool
+	}{
+		{"https://gitlab.com/{username}/", "https://gitlab.com/alice/keymesh/-/raw/main/proof.md", true},
+		{"https://gitlab.com/{username}", "https://gitlab.com/alice/keymesh", true},
+		{"https://gitlab.com/{username}", "https://gitlab.com/alice", true},
+		{"https://gitlab.com/{username}", "https://gitlab.com/alicebob/keymesh", false},
+		{"https://gitlab.com/{username}/", "https://gitlab.com/alicebob/keymesh", false},
+		{"https://gitlab.com/{username}/", "https://gitlab.com/alice/../bob/keymesh", false},
+		{"https://gitlab.com/{username}/", "https://gitlab.com/alice/./keymesh", false},
+		{"https://gitlab.com/{username}/", "https://evil@gitlab.com/alice/keymesh", false},
+		{"https://gitlab.com/{username}/", "https://gitlab.com.evil.example/alice/keymesh", false},
+		{"", "https://gitlab.com/alice/keymesh", false},
+	}
+
+	for _, test := range tests {
+		p := NewProvider(ProviderConfig{ProofURLPrefix: test.prefix})
+		if allowed := p.ProofURLAllowed("alice", test.proofURL); allowed != test.allowed {
+			t.Errorf("%s under %s: got %v", test.proofURL, test.prefix, allowed)
+		}
+	}
+}
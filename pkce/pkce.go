@@ -0,0 +1,41 @@
+// Package pkce implements the Proof Key for Code Exchange of the OAuth2
+// logins (RFC 7636), the code verifier is kept by the service until the
+// callback and only its S256 challenge is sent to the authorization server.
+package pkce
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"golang.org/x/oauth2"
+)
+
+// NewVerifier returns a random code verifier.
+func NewVerifier() (string, error) {
+	bs := make([]byte, 32)
+	if _, err := rand.Read(bs); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bs), nil
+}
+
+// Challenge returns the S256 challenge of the verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ChallengeOptions add the challenge of the verifier to the authorize URL.
+func ChallengeOptions(verifier string) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", Challenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+}
+
+// VerifierOption adds the verifier to the token exchange.
+func VerifierOption(verifier string) oauth2.AuthCodeOption {
+	return oauth2.SetAuthURLParam("code_verifier", verifier)
+}
@@ -0,0 +1,57 @@
+package pkce
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestChallenge(t *testing.T) {
+	// RFC 7636, appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	if challenge := Challenge(verifier); challenge != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("got challenge %s", challenge)
+	}
+}
+
+func TestNewVerifier(t *testing.T) {
+	// 43 to 128 characters of the unreserved set
+	pattern := regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		verifier, err := NewVerifier()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pattern.MatchString(verifier) {
+			t.Errorf("got verifier %q", verifier)
+		}
+		if seen[verifier] {
+			t.Errorf("got verifier %q twice", verifier)
+		}
+		seen[verifier] = true
+	}
+}
+
+func TestChallengeOptions(t *testing.T) {
+	config := &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{AuthURL: "https://example.com/authorize"},
+	}
+
+	u, err := url.Parse(config.AuthCodeURL("state", ChallengeOptions("verifier")...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge") != Challenge("verifier") || query.Get("code_challenge_method") != "S256" {
+		t.Errorf("got %s", u)
+	}
+	// the verifier itself is never sent to the authorize URL
+	if query.Get("code_verifier") != "" {
+		t.Errorf("got the verifier in %s", u)
+	}
+}
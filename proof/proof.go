@@ -0,0 +1,169 @@
+// Package proof checks the public posts which bind a social account to an
+// Ethereum address.
+//
+// A proof is a post made by the account which contains the claim text and a
+// signature of it by the address:
+//
+//	I am alice on twitter and my KeyMesh address is 0x... 0x<signature>
+//
+// The signature is either the personal_sign signature of the text or the
+// eth_signTypedData_v4 signature of the claim, see Claim.TypedData.
+package proof
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dcb9/keymeshOAuth/crypto"
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/eth"
+)
+
+// Error is a failed proof verification, Reason is a stable code which is
+// stored with the authorization.
+type Error struct {
+	Reason  string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Verification errors
+var (
+	ErrProofNotFound     = &Error{"proof_not_found", "proof: the proof could not be found"}
+	ErrProofNotPublic    = &Error{"proof_not_public", "proof: the proof is not public"}
+	ErrAuthorMismatch    = &Error{"author_mismatch", "proof: the proof was not posted by the account"}
+	ErrProofNotHosted    = &Error{"proof_not_hosted", "proof: the proof is not hosted under the account"}
+	ErrAccountNotLinked  = &Error{"account_not_linked", "proof: the address has not logged in with the account"}
+	ErrClaimNotFound     = &Error{"claim_not_found", "proof: the proof does not contain the claim"}
+	ErrSignatureNotFound = &Error{"signature_not_found", "proof: the proof does not contain a signature"}
+	ErrInvalidSignature  = &Error{"invalid_signature", "proof: the signature does not match the address"}
+)
+
+// Claim is the statement signed by the address.
+type Claim struct {
+	PlatformName db.PlatformName
+	Username     string
+	UserAddress  string
+	// NetworkID is the network the proof is for, the domain of the typed
+	// data signatures is bound to its chain.
+	NetworkID int
+}
+
+// claimFields are the members of the Claim type of the typed data.
+var claimFields = []crypto.TypedDataField{
+	{Name: "platform", Type: "string"},
+	{Name: "username", Type: "string"},
+	{Name: "userAddress", Type: "address"},
+}
+
+// TypedData returns the claim as signed by eth_signTypedData_v4.
+func (c Claim) TypedData() (crypto.TypedData, error) {
+	network, err := eth.LookupNetwork(c.NetworkID)
+	if err != nil {
+		return crypto.TypedData{}, err
+	}
+
+	return crypto.NewTypedData(int64(network.ChainID), "Claim", claimFields, map[string]interface{}{
+		"platform":    string(c.PlatformName),
+		"username":    db.NormalizeUsername(c.Username),
+		"userAddress": c.UserAddress,
+	}), nil
+}
+
+// verifySig checks both the signature formats, the contract wallets are
+// asked through the client of the network if it has one. It returns a
+// *crypto.SignatureError if the signature is rejected.
+func (c Claim) verifySig(sigHex string) error {
+	typedData, err := c.TypedData()
+	if err != nil {
+		return err
+	}
+	caller, err := eth.ContractCaller(c.NetworkID)
+	if err != nil {
+		return err
+	}
+
+	_, err = crypto.VerifyMessage(caller, c.UserAddress, sigHex, []byte(c.Text()))
+	if _, ok := err.(*crypto.SignatureError); !ok {
+		return err
+	}
+
+	_, err = crypto.VerifyTypedData(caller, c.UserAddress, sigHex, typedData)
+	return err
+}
+
+// Text returns the canonical text of the claim.
+func (c Claim) Text() string {
+	return fmt.Sprintf(
+		"I am %s on %s and my KeyMesh address is %s",
+		db.NormalizeUsername(c.Username),
+		c.PlatformName,
+		strings.ToLower(c.UserAddress),
+	)
+}
+
+// signaturePattern matches the hex blobs of 64 bytes or more. The signatures
+// recovered are 65 bytes long or the 64 bytes compact ones of EIP-2098, those
+// of the contract wallets can be longer, a multisig signs with 65 bytes per
+// owner. The shorter blobs are left out so that the address of the claim and
+// the hashes are not taken for a signature.
+var signaturePattern = regexp.MustCompile(`0x(?:[0-9a-fA-F]{2}){64,}`)
+
+// Verify checks that content contains the claim text and a signature of it
+// by the claim address. The whitespaces of content are collapsed first since
+// the platforms tend to reformat the posts. The payload is the claim with the
+// signature found, it is returned as soon as the claim is found. The errors
+// other than *Error are returned when a contract wallet could not be asked.
+func Verify(claim Claim, content string) (payload string, err error) {
+	content = strings.Join(strings.Fields(content), " ")
+	if !strings.Contains(strings.ToLower(content), strings.ToLower(claim.Text())) {
+		return "", ErrClaimNotFound
+	}
+
+	sigHex := signaturePattern.FindString(content)
+	if sigHex == "" {
+		return claim.Text(), ErrSignatureNotFound
+	}
+	payload = claim.Text() + " " + sigHex
+
+	if err = claim.verifySig(sigHex); err != nil {
+		if _, ok := err.(*crypto.SignatureError); ok {
+			return payload, ErrInvalidSignature
+		}
+		return payload, err
+	}
+
+	return payload, nil
+}
+
+// VerifyAny checks the contents in turn until one of them holds a valid
+// proof. The error of the last content which contains the claim is returned
+// otherwise, since the contents which do not mention the claim are not worth
+// reporting.
+func VerifyAny(claim Claim, contents []string) (payload string, err error) {
+	var result error = ErrClaimNotFound
+	for _, content := range contents {
+		found, err := Verify(claim, content)
+		if err == nil {
+			return found, nil
+		}
+		if err != ErrClaimNotFound {
+			result, payload = err, found
+		}
+	}
+
+	return payload, result
+}
+
+// Reason returns the code stored with the authorization when err made a
+// verification fail.
+func Reason(err error) string {
+	if e, ok := err.(*Error); ok {
+		return e.Reason
+	}
+	return "error"
+}
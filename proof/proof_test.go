@@ -0,0 +1,107 @@
+package proof
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/eth"
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// stubWallet is a node serving a contract wallet which accepts every
+// signature, or fails with err.
+type stubWallet struct {
+	err error
+}
+
+func (w *stubWallet) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return []byte{1}, nil
+}
+
+func (w *stubWallet) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	return common.RightPadBytes([]byte{0x16, 0x26, 0xba, 0x7e}, 32), nil
+}
+
+// useContractWallet enables the contract wallets on the network 1 and serves
+// them from wallet until the test ends.
+func useContractWallet(t *testing.T, wallet *stubWallet) {
+	t.Helper()
+
+	saved := eth.Networks()
+	networks := eth.Networks()
+	for i := range networks {
+		if networks[i].ID == 1 {
+			networks[i].ContractWallets = true
+		}
+	}
+	if err := eth.SetNetworks(networks); err != nil {
+		t.Fatal(err)
+	}
+	eth.SetContractCaller(1, wallet)
+	t.Cleanup(func() {
+		eth.SetNetworks(saved)
+	})
+}
+
+func TestVerifyContractWalletSignature(t *testing.T) {
+	claim := Claim{
+		PlatformName: db.TwitterPlatformName,
+		Username:     "alice",
+		UserAddress:  "0x00000000000000000000000000000000000000aa",
+		NetworkID:    1,
+	}
+	// a multisig signature of two owners, after the hash of a transaction
+	sigHex := hexutil.Encode(bytes.Repeat([]byte{1}, 130))
+	txHash := hexutil.Encode(bytes.Repeat([]byte{2}, 32))
+	content := claim.Text() + " tx " + txHash + " " + sigHex
+
+	// the signature is too long to be recovered
+	if _, err := Verify(claim, content); err != ErrInvalidSignature {
+		t.Errorf("got %v without contract wallets, want ErrInvalidSignature", err)
+	}
+
+	wallet := &stubWallet{}
+	useContractWallet(t, wallet)
+
+	payload, err := Verify(claim, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload != claim.Text()+" "+sigHex {
+		t.Errorf("got payload %q", payload)
+	}
+
+	// a wallet which could not be asked does not reject the proof
+	wallet.err = errors.New("dial tcp: connection refused")
+	if _, err = Verify(claim, content); err != wallet.err {
+		t.Errorf("got %v, want the transport error", err)
+	}
+}
+
+func TestSignaturePattern(t *testing.T) {
+	tests := map[string]int{
+		"0x" + strings.Repeat("ab", 65):        130,
+		"0x" + strings.Repeat("ab", 64):        128,
+		"0x" + strings.Repeat("ab", 195):       390,
+		"0x" + strings.Repeat("ab", 65) + "c":  130,
+		"0x" + strings.Repeat("ab", 32):        0,
+		"0x" + strings.Repeat("ab", 20) + " x": 0,
+	}
+
+	for content, length := range tests {
+		found := signaturePattern.FindString(content)
+		if (length == 0 && found != "") || (length != 0 && len(found) != length+2) {
+			t.Errorf("%s: got %q", content, found)
+		}
+	}
+}
@@ -8,23 +8,80 @@ import (
 
 	"github.com/dcb9/keymeshOAuth/crypto"
 	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/eth"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 )
 
 var ErrEmptyEmail = errors.New("email could not be empty")
 
+// accountInfoFields are the members of the AccountInfo type of the typed
+// data.
+var accountInfoFields = []crypto.TypedDataField{
+	{Name: "userAddress", Type: "address"},
+	{Name: "email", Type: "string"},
+	{Name: "name", Type: "string"},
+	{Name: "msg", Type: "string"},
+}
+
+// accountInfoRequest is the body of HandlePutAccountInfo, ChainID is the
+// chain of the domain of the typed data signatures.
+type accountInfoRequest struct {
+	db.AccountInfo
+	ChainID int64 `json:"chainID,omitempty"`
+}
+
+// verifyAccountInfoSig accepts the personal_sign signature of msg and the
+// eth_signTypedData_v4 signature of the account info. The contract wallets
+// are only asked when the chain of the request is registered. It returns a
+// *crypto.SignatureError if the signature is rejected.
+func verifyAccountInfoSig(request *accountInfoRequest) error {
+	info := request.AccountInfo
+	if request.ChainID == 0 {
+		_, err := crypto.VerifyMessage(nil, info.UserAddress, info.Sig, []byte(info.Msg))
+		return err
+	}
+
+	var caller bind.ContractCaller
+	if network, err := eth.LookupChain(int(request.ChainID)); err == nil {
+		if caller, err = eth.ContractCaller(network.ID); err != nil {
+			return err
+		}
+	}
+	_, err := crypto.VerifyMessage(caller, info.UserAddress, info.Sig, []byte(info.Msg))
+	if _, ok := err.(*crypto.SignatureError); !ok {
+		return err
+	}
+
+	typedData := crypto.NewTypedData(request.ChainID, "AccountInfo", accountInfoFields, map[string]interface{}{
+		"userAddress": info.UserAddress,
+		"email":       info.Email,
+		"name":        info.Name,
+		"msg":         info.Msg,
+	})
+	_, err = crypto.VerifyTypedData(caller, info.UserAddress, info.Sig, typedData)
+	return err
+}
+
 func HandlePutAccountInfo(requestBody string) (err error) {
-	var info *db.AccountInfo
-	err = json.Unmarshal([]byte(requestBody), &info)
+	var request accountInfoRequest
+	err = json.Unmarshal([]byte(requestBody), &request)
 	if err != nil {
 		return
 	}
+	info := &request.AccountInfo
 
 	if info.Email == "" {
 		return ErrEmptyEmail
 	}
 
 	if info.Sig != "" {
-		info.ValidSig = crypto.VerifySig(info.UserAddress, info.Sig, []byte(info.Msg))
+		// the account info is stored with an invalid signature if the
+		// contract wallet could not be asked
+		sigErr := verifyAccountInfoSig(&request)
+		info.ValidSig = sigErr == nil
+		if sigErr != nil {
+			fmt.Println("verifyAccountInfoSig:", sigErr)
+		}
 	}
 	if info.UserAddress == "" {
 		info.UserAddress = "-"
@@ -32,7 +89,7 @@ func HandlePutAccountInfo(requestBody string) (err error) {
 
 	info.CreatedAt = time.Now()
 	fmt.Printf("%#v\n", info)
-	_, err = db.PutAccountInfo(*info)
+	err = db.PutAccountInfo(*info)
 
 	return
 }
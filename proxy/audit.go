@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+)
+
+// HistoryEvent is the public part of an authorization event, the operators
+// of the admin overrides are not public.
+type HistoryEvent struct {
+	PlatformName db.PlatformName           `json:"platformName"`
+	Type         db.AuthorizationEventType `json:"type"`
+	Actor        string                    `json:"actor"`
+	Reason       string                    `json:"reason,omitempty"`
+	Status       db.AuthorizationStatus    `json:"status"`
+	Username     string                    `json:"username"`
+	ProofURL     string                    `json:"proofURL,omitempty"`
+	ProofPayload string                    `json:"proofPayload,omitempty"`
+	CreatedAt    time.Time                 `json:"createdAt"`
+}
+
+// HistoryPage is one page of the history of an address, oldest first. As in
+// UserInfoPage, the events are the body of the responses and NextCursor,
+// empty on the last page, is sent in the NextCursorHeader.
+type HistoryPage struct {
+	Events     []*HistoryEvent
+	NextCursor string
+}
+
+// HandleGetUserHistory returns the changes of the authorizations of the
+// address.
+func HandleGetUserHistory(userAddress string, networkID int, limit int, encodedCursor string) (*HistoryPage, error) {
+	limit = pageLimit(limit)
+	query := "history:" + userAddress
+	after, err := decodeCursor(encodedCursor, query, networkID)
+	if err != nil {
+		return nil, err
+	}
+
+	events, next, err := db.GetAuthorizationEventTable(networkID).GetAuthorizationEvents(userAddress, limit, after)
+	if err != nil {
+		return nil, err
+	}
+
+	nextCursor, err := encodeCursor(query, networkID, next)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &HistoryPage{
+		Events:     make([]*HistoryEvent, len(events)),
+		NextCursor: nextCursor,
+	}
+	for i, event := range events {
+		page.Events[i] = &HistoryEvent{
+			PlatformName: event.PlatformName,
+			Type:         event.Type,
+			Actor:        event.Actor,
+			Reason:       event.Reason,
+			Status:       event.Status,
+			Username:     event.Username,
+			ProofURL:     event.ProofURL,
+			ProofPayload: event.ProofPayload,
+			CreatedAt:    event.CreatedAt,
+		}
+	}
+
+	return page, nil
+}
+
+var (
+	ErrInvalidOverrideStatus = errors.New("the status can only be overridden to verified, failed or revoked")
+	ErrEmptyOverrideReason   = errors.New("the reason and the operator of an override must be set")
+)
+
+// OverrideAuthorization sets the status of the authorization of the address
+// whatever its proof, for the support and the abuse reports. The reason and
+// the operator are recorded in the history.
+func OverrideAuthorization(networkID int, userAddress string, platformName db.PlatformName, status db.AuthorizationStatus, reason string, operator string) error {
+	if reason == "" || operator == "" {
+		return ErrEmptyOverrideReason
+	}
+
+	item, err := db.GetAuthorizationTable(networkID).GetAuthorizationItem(userAddress, platformName)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	switch status {
+	case db.StatusVerified:
+		item.MarkVerified(now, item.ProofPayload)
+	case db.StatusFailed:
+		item.MarkFailed(now, reason, item.ProofPayload)
+	case db.StatusRevoked:
+		item.MarkRevoked(now, reason, item.ProofPayload)
+	default:
+		return ErrInvalidOverrideStatus
+	}
+
+	return db.ChangeAuthorization(networkID, *item, db.AuthorizationChange{
+		Type:     db.EventAdminOverride,
+		Actor:    db.ActorAdmin,
+		Operator: operator,
+		Reason:   reason,
+	})
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+)
+
+func TestHistory(t *testing.T) {
+	signer := newTestSigner(t)
+	socialProof := &SocialProof{Username: "alice", ProofURL: "https://example.com/alice/proof"}
+	history := func() []*HistoryEvent {
+		page, err := HandleGetUserHistory(signer.address, 1, 0, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return page.Events
+	}
+
+	mutations := []struct {
+		eventType db.AuthorizationEventType
+		status    db.AuthorizationStatus
+		mutate    func() error
+	}{
+		{db.EventLink, db.StatusPending, func() error {
+			return linkAccount(&loginState{UserAddress: signer.address, NetworkID: 1}, testPlatformName, testProfile{"alice", "1"})
+		}},
+		{db.EventVerify, db.StatusVerified, func() error {
+			return HandleVerify(testPlatformName, signer.address, 1, socialProof)
+		}},
+		{db.EventReverify, db.StatusVerified, func() error {
+			return HandleVerify(testPlatformName, signer.address, 1, socialProof)
+		}},
+		{db.EventRevoke, db.StatusRevoked, func() error {
+			issuedAt := time.Now().Unix()
+			signature := signer.signMessage(t, RevokeMessage(testPlatformName, signer.address, 1, issuedAt))
+			return HandleRevoke(testPlatformName, signer.address, 1, issuedAt, signature)
+		}},
+		{db.EventAdminOverride, db.StatusVerified, func() error {
+			return OverrideAuthorization(1, signer.address, testPlatformName, db.StatusVerified, "appeal", "support")
+		}},
+	}
+
+	for i, mutation := range mutations {
+		if err := mutation.mutate(); err != nil {
+			t.Fatalf("%s: %v", mutation.eventType, err)
+		}
+		events := history()
+		if len(events) != i+1 {
+			t.Fatalf("%s: got %d events, want %d", mutation.eventType, len(events), i+1)
+		}
+		event := events[i]
+		if event.Type != mutation.eventType || event.Status != mutation.status || event.PlatformName != testPlatformName {
+			t.Errorf("%s: got %+v", mutation.eventType, event)
+		}
+	}
+
+	// the pages of 2 events hold the whole history, oldest first
+	var paged []*HistoryEvent
+	cursor := ""
+	for pages := 1; ; pages++ {
+		page, err := HandleGetUserHistory(signer.address, 1, 2, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Events) > 2 {
+			t.Errorf("got %d events in a page of 2", len(page.Events))
+		}
+		paged = append(paged, page.Events...)
+		if page.NextCursor == "" {
+			if pages != 3 {
+				t.Errorf("got %d pages, want 3", pages)
+			}
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(paged) != len(mutations) {
+		t.Fatalf("got %d events, want %d", len(paged), len(mutations))
+	}
+	for i, event := range paged {
+		if event.Type != mutations[i].eventType {
+			t.Errorf("got %s at %d, want %s", event.Type, i, mutations[i].eventType)
+		}
+	}
+
+	// a cursor is only valid for the address it was made for
+	page, err := HandleGetUserHistory(signer.address, 1, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = HandleGetUserHistory("0x0000000000000000000000000000000000000001", 1, 2, page.NextCursor); err != ErrInvalidCursor {
+		t.Errorf("got %v, want ErrInvalidCursor", err)
+	}
+}
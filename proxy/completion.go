@@ -0,0 +1,312 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/proof"
+)
+
+var (
+	ErrInvalidCompletion  = errors.New(`the query param "completion" must be "redirect" or "popup"`)
+	ErrOriginNotAllowed   = errors.New("the return URL is not on an allowed origin")
+	ErrInvalidLoginResult = errors.New("invalid or expired login result")
+
+	loginResultSigner = newTokenSigner("LOGIN_RESULT_SECRET")
+	allowedOrigins    = parseAllowedOrigins(os.Getenv("OAUTH_ALLOWED_ORIGINS"))
+)
+
+// completionMode is how the browser is sent back to the frontend once the
+// platform redirected it to the callback.
+type completionMode string
+
+const (
+	// completionBody responds with the profile as JSON.
+	completionBody completionMode = ""
+	// completionRedirect redirects to the frontend with a result token.
+	completionRedirect completionMode = "redirect"
+	// completionPopup posts the result token to the window which opened the
+	// login popup.
+	completionPopup completionMode = "popup"
+)
+
+// loginResultTTL is how long the frontend has to use the result token.
+const loginResultTTL = 5 * time.Minute
+
+// popupMessageType tells the messages of the login popups apart from the
+// other messages the opener receives.
+const popupMessageType = "keymesh:oauth"
+
+// CallbackResponse is the HTTP response to the callback request.
+type CallbackResponse struct {
+	StatusCode int
+	Headers    map[string]string
+	Body       string
+}
+
+// LoginResult is the outcome of a login as handed to the frontend, it is
+// signed with LOGIN_RESULT_SECRET.
+type LoginResult struct {
+	PlatformName db.PlatformName `json:"platformName"`
+	Username     string          `json:"username"`
+	UserID       string          `json:"userID,omitempty"`
+	UserAddress  string          `json:"userAddress,omitempty"`
+	NetworkID    int             `json:"networkID,omitempty"`
+	ExpiresAt    int64           `json:"expiresAt"`
+}
+
+// LoginResultInfo is a verified login result with the public profile of the
+// user.
+type LoginResultInfo struct {
+	LoginResult
+	Profile interface{} `json:"profile"`
+}
+
+// parseAllowedOrigins reads the comma separated origins the frontends are
+// served from.
+func parseAllowedOrigins(list string) map[string]bool {
+	origins := make(map[string]bool)
+	for _, v := range strings.Split(list, ",") {
+		if origin, ok := originOf(strings.TrimSpace(v)); ok {
+			origins[origin] = true
+		}
+	}
+
+	return origins
+}
+
+// originOf returns the scheme://host[:port] of an http or https URL.
+func originOf(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User != nil || u.Host == "" {
+		return "", false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return "", false
+	}
+
+	return scheme + "://" + strings.ToLower(u.Host), true
+}
+
+func originAllowed(rawURL string) bool {
+	origin, ok := originOf(rawURL)
+	return ok && allowedOrigins[origin]
+}
+
+// parseCompletion reads the "completion" query param of the authorize
+// request. "redirect" needs "returnTo", a URL on an allowed origin, and
+// "popup" needs "origin", the allowed origin of the opener.
+func parseCompletion(req *http.Request) (completionMode, string, error) {
+	switch mode := completionMode(req.Form.Get("completion")); mode {
+	case completionBody:
+		return mode, "", nil
+	case completionRedirect:
+		returnTo := req.Form.Get("returnTo")
+		if !originAllowed(returnTo) {
+			return "", "", ErrOriginNotAllowed
+		}
+		return mode, returnTo, nil
+	case completionPopup:
+		origin, ok := originOf(req.Form.Get("origin"))
+		if !ok || !allowedOrigins[origin] {
+			return "", "", ErrOriginNotAllowed
+		}
+		return mode, origin, nil
+	}
+
+	return "", "", ErrInvalidCompletion
+}
+
+// completeLogin responds to the callback as the login asked. loginErr is
+// the reason the login failed, it is only reported to the frontend as a code.
+func completeLogin(state *loginState, platformName db.PlatformName, profile Profile, loginErr error) (*CallbackResponse, error) {
+	if state.Completion == completionBody {
+		if loginErr != nil {
+			return nil, loginErr
+		}
+		body, err := json.Marshal(profile)
+		if err != nil {
+			return nil, err
+		}
+		return &CallbackResponse{
+			StatusCode: http.StatusOK,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+			Body:       string(body),
+		}, nil
+	}
+
+	// the allowed origins may have changed since the login started
+	if !originAllowed(state.ReturnTo) {
+		return nil, &LoginError{ErrOriginNotAllowed}
+	}
+
+	var (
+		message = popupMessage{
+			Type:         popupMessageType,
+			PlatformName: platformName,
+		}
+		err error
+	)
+	if loginErr != nil {
+		fmt.Println(loginErr)
+		message.Error = loginErrorCode(loginErr)
+	} else {
+		message.Result, err = signLoginResult(state, platformName, profile)
+		if err != nil {
+			return nil, err
+		}
+		message.Profile = profile.Public()
+	}
+
+	if state.Completion == completionRedirect {
+		return redirectResponse(state.ReturnTo, message)
+	}
+	return popupResponse(state.ReturnTo, message)
+}
+
+func loginErrorCode(err error) string {
+	if err == ErrUnknownRequestToken {
+		return "unknown_request_token"
+	}
+	if err == ErrLinkNotAuthorized {
+		return "signature_required"
+	}
+	if _, ok := err.(*LoginError); ok {
+		return "invalid_request"
+	}
+	return "login_failed"
+}
+
+func signLoginResult(state *loginState, platformName db.PlatformName, profile Profile) (string, error) {
+	result := LoginResult{
+		PlatformName: platformName,
+		Username:     profile.Username(),
+		UserAddress:  state.UserAddress,
+		NetworkID:    state.NetworkID,
+		ExpiresAt:    time.Now().Add(loginResultTTL).Unix(),
+	}
+	if account, ok := profile.(accountProfile); ok {
+		result.UserID = account.UserID()
+	}
+
+	return loginResultSigner.sign(result)
+}
+
+// popupMessage is what the popup posts to its opener, the redirections
+// carry Result or Error in the query.
+type popupMessage struct {
+	Type         string          `json:"type"`
+	PlatformName db.PlatformName `json:"platformName"`
+	Result       string          `json:"result,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	Profile      interface{}     `json:"profile,omitempty"`
+}
+
+func redirectResponse(returnTo string, message popupMessage) (*CallbackResponse, error) {
+	u, err := url.Parse(returnTo)
+	if err != nil {
+		return nil, err
+	}
+
+	query := u.Query()
+	if message.Error != "" {
+		query.Set("error", message.Error)
+	} else {
+		query.Set("result", message.Result)
+	}
+	u.RawQuery = query.Encode()
+
+	return &CallbackResponse{
+		StatusCode: http.StatusFound,
+		Headers: map[string]string{
+			"Location":        u.String(),
+			"Cache-Control":   "no-store",
+			"Referrer-Policy": "no-referrer",
+		},
+	}, nil
+}
+
+// popupTemplate posts the message to the opener only if it is still on the
+// origin the login was started from.
+var popupTemplate = template.Must(template.New("popup").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>KeyMesh</title></head>
+<body>
+<script nonce="{{.Nonce}}">
+if (window.opener) {
+  window.opener.postMessage({{.Message}}, {{.Origin}});
+}
+window.close();
+</script>
+</body>
+</html>
+`))
+
+func popupResponse(origin string, message popupMessage) (*CallbackResponse, error) {
+	nonce, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	err = popupTemplate.Execute(&body, struct {
+		Nonce   string
+		Message popupMessage
+		Origin  string
+	}{nonce, message, origin})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CallbackResponse{
+		StatusCode: http.StatusOK,
+		Headers: map[string]string{
+			"Content-Type":            "text/html; charset=utf-8",
+			"Content-Security-Policy": "default-src 'none'; script-src 'nonce-" + nonce + "'",
+			"Cache-Control":           "no-store",
+			"Referrer-Policy":         "no-referrer",
+		},
+		Body: body.String(),
+	}, nil
+}
+
+// HandleLoginResult checks the result token handed to the frontend and
+// returns it with the public profile of the user.
+func HandleLoginResult(platformName db.PlatformName, token string) ([]byte, error) {
+	provider, err := LookupProvider(platformName)
+	if err != nil {
+		return nil, err
+	}
+
+	var result LoginResult
+	if err = loginResultSigner.verify(token, &result); err != nil {
+		return nil, ErrInvalidLoginResult
+	}
+	if result.PlatformName != platformName || time.Now().Unix() > result.ExpiresAt {
+		return nil, ErrInvalidLoginResult
+	}
+
+	// the username may belong to another account since the login
+	profile, err := getAccountProfile(provider, result.Username, result.UserID)
+	if err == proof.ErrAccountNotLinked {
+		return nil, ErrInvalidLoginResult
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(LoginResultInfo{
+		LoginResult: result,
+		Profile:     profile.Public(),
+	})
+}
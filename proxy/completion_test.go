@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	goTwitter "github.com/dghubble/go-twitter/twitter"
+)
+
+// signResult returns the token of a login result which expires in a minute.
+func signResult(t *testing.T, result LoginResult) string {
+	t.Helper()
+
+	result.ExpiresAt = time.Now().Add(time.Minute).Unix()
+	token, err := loginResultSigner.sign(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestHandleLoginResultFollowsTheAccount(t *testing.T) {
+	now := time.Now()
+	// biz logs in, then renames to biz_ and another account takes biz
+	for _, user := range []goTwitter.User{
+		{ID: 20, IDStr: "20", ScreenName: "biz"},
+		{ID: 20, IDStr: "20", ScreenName: "biz_"},
+		{ID: 21, IDStr: "21", ScreenName: "biz"},
+	} {
+		if _, err := db.PutTwitterProfile(user, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token := signResult(t, LoginResult{PlatformName: db.TwitterPlatformName, Username: "biz", UserID: "20"})
+	resultBytes, err := HandleLoginResult(db.TwitterPlatformName, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info struct {
+		Profile struct {
+			ScreenName string `json:"screen_name"`
+		} `json:"profile"`
+	}
+	if err = json.Unmarshal(resultBytes, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Profile.ScreenName != "biz_" {
+		t.Errorf("got the profile of %s, want the renamed account", resultBytes)
+	}
+}
+
+func TestHandleLoginResultRejectsAnotherAccount(t *testing.T) {
+	// mona logged in with the GitHub account 2, the account 3 is now mona
+	data, _ := json.Marshal(map[string]interface{}{"id": 3, "login": "mona"})
+	err := db.PutProfile(db.Profile{
+		PlatformName: db.GitHubPlatformName,
+		Username:     "mona",
+		UserID:       "3",
+		Data:         data,
+		UpdatedAt:    time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := signResult(t, LoginResult{PlatformName: db.GitHubPlatformName, Username: "mona", UserID: "2"})
+	if _, err = HandleLoginResult(db.GitHubPlatformName, token); err != ErrInvalidLoginResult {
+		t.Errorf("got %v, want ErrInvalidLoginResult", err)
+	}
+
+	token = signResult(t, LoginResult{PlatformName: db.GitHubPlatformName, Username: "mona", UserID: "3"})
+	if _, err = HandleLoginResult(db.GitHubPlatformName, token); err != nil {
+		t.Errorf("got %v for the account which logged in", err)
+	}
+}
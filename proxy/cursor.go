@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"errors"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	cursorSigner     = newTokenSigner("CURSOR_SECRET")
+)
+
+// NextCursorHeader is the header of the user lookups which holds the cursor
+// of the next page.
+const NextCursorHeader = "X-Next-Cursor"
+
+// cursor is the state of a paginated lookup which is handed to the clients.
+// It is bound to the lookup it was created for so that it can not be replayed
+// against another query.
+type cursor struct {
+	Query     string `json:"q"`
+	NetworkID int    `json:"n"`
+	Position  string `json:"p"`
+}
+
+func encodeCursor(query string, networkID int, position string) (string, error) {
+	if position == "" {
+		return "", nil
+	}
+
+	return cursorSigner.sign(cursor{
+		Query:     query,
+		NetworkID: networkID,
+		Position:  position,
+	})
+}
+
+// decodeCursor returns the store position encoded in the cursor.
+func decodeCursor(encoded string, query string, networkID int) (string, error) {
+	if encoded == "" {
+		return "", nil
+	}
+
+	var c cursor
+	if err := cursorSigner.verify(encoded, &c); err != nil {
+		return "", ErrInvalidCursor
+	}
+	if c.Query != query || c.NetworkID != networkID {
+		return "", ErrInvalidCursor
+	}
+
+	return c.Position, nil
+}
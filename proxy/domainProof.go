@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/domain"
+	"github.com/dcb9/keymeshOAuth/proof"
+)
+
+var (
+	domainChecker = domain.NewChecker()
+
+	ErrNoLogin = errors.New("the platform has no login, the proof is published on the domain")
+)
+
+func init() {
+	RegisterProvider(db.DNSPlatformName, domainProvider{
+		platformName: db.DNSPlatformName,
+		fetch: func(name string) ([]string, error) {
+			return domainChecker.TXTRecords(name)
+		},
+	})
+	RegisterProvider(db.WebPlatformName, domainProvider{
+		platformName: db.WebPlatformName,
+		fetch: func(name string) ([]string, error) {
+			content, err := domainChecker.WellKnownFile(name)
+			if err != nil {
+				return nil, err
+			}
+			return []string{content}, nil
+		},
+		proofURL: func(name string) string {
+			return domainChecker.WellKnownURL(name)
+		},
+	})
+}
+
+// domainProvider proves the ownership of a domain, the username is the
+// domain and the proof is published on it rather than posted by an account,
+// so there is no login.
+type domainProvider struct {
+	platformName db.PlatformName
+	// fetch returns the contents which may hold the proof.
+	fetch func(name string) ([]string, error)
+	// proofURL is where the proof is read from, if it has a URL.
+	proofURL func(name string) string
+}
+
+// domainProfile is the domain itself.
+type domainProfile struct {
+	Domain string `json:"domain"`
+}
+
+func (p domainProfile) Username() string {
+	return p.Domain
+}
+
+func (p domainProfile) Public() interface{} {
+	return &DomainInfo{
+		Domain: p.Domain,
+	}
+}
+
+func (domainProvider) LoginURL(_ *http.Request) (string, error) {
+	return "", &LoginError{ErrNoLogin}
+}
+
+func (domainProvider) Callback(_ *http.Request) (Profile, error) {
+	return nil, &LoginError{ErrNoLogin}
+}
+
+func (domainProvider) GetProfile(username string) (Profile, error) {
+	return domainProfile{db.NormalizeUsername(username)}, nil
+}
+
+func (domainProvider) BatchGetProfiles(usernames []string) (map[string]Profile, error) {
+	profiles := make(map[string]Profile)
+	for _, username := range usernames {
+		normalized := db.NormalizeUsername(username)
+		profiles[normalized] = domainProfile{normalized}
+	}
+
+	return profiles, nil
+}
+
+// ProofURL implements proofLocator.
+func (p domainProvider) ProofURL(username string) string {
+	if p.proofURL == nil {
+		return ""
+	}
+
+	name, err := domain.NormalizeDomain(username)
+	if err != nil {
+		return ""
+	}
+
+	return p.proofURL(name)
+}
+
+// VerifyProof ignores proofURL, the proof is always read from the domain.
+func (p domainProvider) VerifyProof(profile Profile, userAddress string, networkID int, _ string) (string, error) {
+	name, err := domain.NormalizeDomain(profile.Username())
+	if err != nil {
+		return "", proof.ErrProofNotFound
+	}
+
+	contents, err := p.fetch(name)
+	if err == domain.ErrProofNotFound {
+		return "", proof.ErrProofNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	claim := proof.Claim{
+		PlatformName: p.platformName,
+		Username:     name,
+		UserAddress:  userAddress,
+		NetworkID:    networkID,
+	}
+
+	return proof.VerifyAny(claim, contents)
+}
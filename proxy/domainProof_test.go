@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/domain"
+	"github.com/dcb9/keymeshOAuth/proof"
+)
+
+// txtRecords is a local stand-in of the DNS.
+type txtRecords map[string][]string
+
+func (r txtRecords) LookupTXT(_ context.Context, name string) ([]string, error) {
+	records, ok := r[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+func TestVerifyDNSProof(t *testing.T) {
+	signer := newTestSigner(t)
+	other := newTestSigner(t)
+	claim := proof.Claim{
+		PlatformName: db.DNSPlatformName,
+		Username:     "example.com",
+		UserAddress:  signer.address,
+		NetworkID:    1,
+	}
+
+	saved := domainChecker
+	domainChecker = &domain.Checker{
+		Resolver: txtRecords{
+			"example.com":          {"v=spf1 -all"},
+			"_keymesh.example.com": {claim.Text() + " " + signer.signMessage(t, claim.Text())},
+		},
+		Timeout: time.Second,
+	}
+	defer func() {
+		domainChecker = saved
+	}()
+
+	provider, err := LookupProvider(db.DNSPlatformName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile, _ := provider.GetProfile("Example.com")
+	if _, err = provider.VerifyProof(profile, signer.address, 1, ""); err != nil {
+		t.Errorf("got %v", err)
+	}
+	if _, err = provider.VerifyProof(profile, other.address, 1, ""); err != proof.ErrClaimNotFound {
+		t.Errorf("got %v for another address, want ErrClaimNotFound", err)
+	}
+
+	profile, _ = provider.GetProfile("unknown.example")
+	if _, err = provider.VerifyProof(profile, signer.address, 1, ""); err != proof.ErrProofNotFound {
+		t.Errorf("got %v for a domain without records, want ErrProofNotFound", err)
+	}
+}
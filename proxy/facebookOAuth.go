@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/facebook"
+	"github.com/dcb9/keymeshOAuth/proof"
+)
+
+var (
+	facebookOAuth2Config = facebook.NewConfig()
+	facebookClient       = facebook.NewClient()
+	accessTokenSealer    = newTokenSigner("ACCESS_TOKEN_SECRET")
+)
+
+func init() {
+	RegisterProvider(db.FacebookPlatformName, facebookProvider{})
+}
+
+type facebookProvider struct{}
+
+// facebookProfile is the Facebook user as returned by /me, its username is
+// the app scoped user ID since Facebook does not expose the usernames.
+type facebookProfile struct {
+	*facebook.User
+	// accessToken is needed to read the posts of the user, it is stored
+	// sealed and never returned.
+	accessToken string
+}
+
+// facebookProfileData is how a facebookProfile is stored, the access token
+// is sealed with ACCESS_TOKEN_SECRET.
+type facebookProfileData struct {
+	User              *facebook.User `json:"user"`
+	SealedAccessToken string         `json:"sealedAccessToken"`
+}
+
+func (p facebookProfile) Username() string {
+	return p.ID
+}
+
+func (p facebookProfile) UserID() string {
+	return p.ID
+}
+
+func (p facebookProfile) Public() interface{} {
+	return NewFacebookOAuthInfo(*p.User)
+}
+
+func (p facebookProfile) EmailAddress() string {
+	return p.Email
+}
+
+func NewFacebookOAuthInfo(user facebook.User) *FacebookOAuthInfo {
+	return &FacebookOAuthInfo{
+		User: &user,
+	}
+}
+
+// LoginURL keeps the login state as a request token so that the callback can
+// only be used once.
+func (facebookProvider) LoginURL(req *http.Request) (string, error) {
+	state, err := newLoginState(db.FacebookPlatformName, req)
+	if err != nil {
+		return "", err
+	}
+
+	err = db.PutRequestToken(db.RequestToken{
+		Token:        state,
+		PlatformName: db.FacebookPlatformName,
+		ExpiresAt:    time.Now().Add(requestTokenTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return facebook.GenerateFacebookLoginURL(facebookOAuth2Config, state), nil
+}
+
+func (facebookProvider) Callback(req *http.Request) (Profile, error) {
+	code, state, err := facebook.ParseAuthorizationCallback(req)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := db.TakeRequestToken(state)
+	if err == db.ErrNotFound || (err == nil && stored.PlatformName != db.FacebookPlatformName) {
+		return nil, ErrUnknownRequestToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, accessToken, err := facebookClient.GetFacebookUser(facebookOAuth2Config, code)
+	if err != nil {
+		fmt.Println(err)
+		return nil, GetUserInfoErr
+	}
+
+	sealedAccessToken, err := accessTokenSealer.seal(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(facebookProfileData{
+		User:              user,
+		SealedAccessToken: sealedAccessToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.PutProfile(db.Profile{
+		PlatformName: db.FacebookPlatformName,
+		Username:     user.ID,
+		UserID:       user.ID,
+		Data:         data,
+		UpdatedAt:    time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return facebookProfile{user, accessToken}, nil
+}
+
+func (facebookProvider) GetProfile(username string) (Profile, error) {
+	profile, err := db.GetProfile(db.FacebookPlatformName, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFacebookProfile(*profile)
+}
+
+func (facebookProvider) BatchGetProfiles(usernames []string) (map[string]Profile, error) {
+	stored, err := db.BatchGetProfiles(db.FacebookPlatformName, usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make(map[string]Profile)
+	for normalized, v := range stored {
+		if profiles[normalized], err = newFacebookProfile(v); err != nil {
+			return nil, err
+		}
+	}
+
+	return profiles, nil
+}
+
+// newFacebookProfile reads a stored profile, the access token is left empty
+// if it can not be opened, such as after ACCESS_TOKEN_SECRET was changed,
+// until the user logs in again.
+func newFacebookProfile(profile db.Profile) (facebookProfile, error) {
+	var data facebookProfileData
+	if err := json.Unmarshal(profile.Data, &data); err != nil {
+		return facebookProfile{}, err
+	}
+	if data.User == nil {
+		return facebookProfile{}, fmt.Errorf("facebook profile %s has no user", profile.Username)
+	}
+
+	accessToken, _ := accessTokenSealer.open(data.SealedAccessToken)
+
+	return facebookProfile{data.User, accessToken}, nil
+}
+
+func (facebookProvider) VerifyProof(profile Profile, userAddress string, networkID int, proofURL string) (string, error) {
+	return verifyFacebookPost(profile.(facebookProfile), userAddress, networkID, proofURL)
+}
+
+// verifyFacebookPost checks that the proof post was published by the user,
+// can be read by anyone and contains the claim signed by the address.
+func verifyFacebookPost(profile facebookProfile, userAddress string, networkID int, proofURL string) (string, error) {
+	if profile.accessToken == "" {
+		return "", proof.ErrAccountNotLinked
+	}
+
+	post, err := facebookClient.FindPost(profile.accessToken, proofURL)
+	if err == facebook.ErrInvalidPostURL || err == facebook.ErrPostNotFound {
+		return "", proof.ErrProofNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if post.From == nil || post.From.ID != profile.ID {
+		return "", proof.ErrAuthorMismatch
+	}
+	if !post.Public() {
+		return "", proof.ErrProofNotPublic
+	}
+
+	claim := proof.Claim{
+		PlatformName: db.FacebookPlatformName,
+		Username:     profile.ID,
+		UserAddress:  userAddress,
+		NetworkID:    networkID,
+	}
+
+	return proof.Verify(claim, post.Message)
+}
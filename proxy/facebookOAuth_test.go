@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/facebook"
+	"github.com/dcb9/keymeshOAuth/proof"
+)
+
+// stubFacebookPosts points facebookClient to a fake Graph API serving the
+// posts to the holder of accessToken until the test ends.
+func stubFacebookPosts(t *testing.T, accessToken string, posts []facebook.Post) {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3.2/me/posts" || r.URL.Query().Get("access_token") != accessToken {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": posts})
+	}))
+
+	saved := facebookClient
+	facebookClient = &facebook.Client{BaseURL: server.URL, AppSecret: "secret", HTTPClient: server.Client()}
+	t.Cleanup(func() {
+		facebookClient = saved
+		server.Close()
+	})
+}
+
+func TestFacebookProfileSealsAccessToken(t *testing.T) {
+	sealed, err := accessTokenSealer.seal("long-lived")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(facebookProfileData{
+		User:              &facebook.User{ID: "4"},
+		SealedAccessToken: sealed,
+	})
+	if strings.Contains(string(data), "long-lived") {
+		t.Fatalf("the access token is stored in clear: %s", data)
+	}
+
+	profile, err := newFacebookProfile(db.Profile{Username: "4", Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.accessToken != "long-lived" {
+		t.Errorf("got access token %q", profile.accessToken)
+	}
+
+	// the profiles stay readable when the token can not be opened
+	data, _ = json.Marshal(facebookProfileData{
+		User:              &facebook.User{ID: "4"},
+		SealedAccessToken: "tampered",
+	})
+	if profile, err = newFacebookProfile(db.Profile{Username: "4", Data: data}); err != nil || profile.accessToken != "" {
+		t.Errorf("got %q, %v", profile.accessToken, err)
+	}
+}
+
+func TestVerifyFacebookPost(t *testing.T) {
+	signer := newTestSigner(t)
+	claim := proof.Claim{
+		PlatformName: db.FacebookPlatformName,
+		Username:     "4",
+		UserAddress:  signer.address,
+		NetworkID:    1,
+	}
+	message := claim.Text() + " " + signer.signMessage(t, claim.Text())
+
+	stubFacebookPosts(t, "long-lived", []facebook.Post{
+		{ID: "4_1", Message: message, From: &facebook.User{ID: "4"}, Privacy: facebook.Privacy{Value: "EVERYONE"}},
+		{ID: "4_2", Message: message, From: &facebook.User{ID: "4"}, Privacy: facebook.Privacy{Value: "ALL_FRIENDS"}},
+		{ID: "4_3", Message: message, From: &facebook.User{ID: "5"}, Privacy: facebook.Privacy{Value: "EVERYONE"}},
+	})
+
+	profile := facebookProfile{&facebook.User{ID: "4"}, "long-lived"}
+	tests := []struct {
+		proofURL string
+		err      error
+	}{
+		{"https://www.facebook.com/4/posts/1", nil},
+		{"https://www.facebook.com/4/posts/2", proof.ErrProofNotPublic},
+		{"https://www.facebook.com/4/posts/3", proof.ErrAuthorMismatch},
+		{"https://www.facebook.com/4/posts/4", proof.ErrProofNotFound},
+		{"https://example.com/4/posts/1", proof.ErrProofNotFound},
+	}
+	for _, test := range tests {
+		if _, err := verifyFacebookPost(profile, signer.address, 1, test.proofURL); err != test.err {
+			t.Errorf("%s: got %v, want %v", test.proofURL, err, test.err)
+		}
+	}
+
+	profile.accessToken = ""
+	if _, err := verifyFacebookPost(profile, signer.address, 1, tests[0].proofURL); err != proof.ErrAccountNotLinked {
+		t.Errorf("got %v without an access token, want ErrAccountNotLinked", err)
+	}
+}
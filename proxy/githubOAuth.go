@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/github"
+	"github.com/dcb9/keymeshOAuth/proof"
+)
+
+var (
+	githubOAuth2Config = github.NewConfig()
+	githubClient       = github.NewClient()
+)
+
+func init() {
+	RegisterProvider(db.GitHubPlatformName, githubProvider{})
+}
+
+type githubProvider struct{}
+
+// githubProfile is the GitHub user as returned by /user.
+type githubProfile struct {
+	*github.User
+}
+
+func (p githubProfile) Username() string {
+	return p.Login
+}
+
+func (p githubProfile) UserID() string {
+	return strconv.FormatInt(p.ID, 10)
+}
+
+func (p githubProfile) Public() interface{} {
+	return NewGitHubOAuthInfo(*p.User)
+}
+
+// LoginURL keeps the login state as a request token so that the callback can
+// only be used once.
+func (githubProvider) LoginURL(req *http.Request) (string, error) {
+	state, err := newLoginState(db.GitHubPlatformName, req)
+	if err != nil {
+		return "", err
+	}
+
+	err = db.PutRequestToken(db.RequestToken{
+		Token:        state,
+		PlatformName: db.GitHubPlatformName,
+		ExpiresAt:    time.Now().Add(requestTokenTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return github.GenerateGitHubLoginURL(githubOAuth2Config, state), nil
+}
+
+func (githubProvider) Callback(req *http.Request) (Profile, error) {
+	code, state, err := github.ParseAuthorizationCallback(req)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := db.TakeRequestToken(state)
+	if err == db.ErrNotFound || (err == nil && stored.PlatformName != db.GitHubPlatformName) {
+		return nil, ErrUnknownRequestToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := githubClient.GetGitHubUser(githubOAuth2Config, code)
+	if err != nil {
+		fmt.Println(err)
+		return nil, GetUserInfoErr
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.PutProfile(db.Profile{
+		PlatformName: db.GitHubPlatformName,
+		Username:     user.Login,
+		UserID:       strconv.FormatInt(user.ID, 10),
+		Data:         data,
+		UpdatedAt:    time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return githubProfile{user}, nil
+}
+
+func (githubProvider) GetProfile(username string) (Profile, error) {
+	profile, err := db.GetProfile(db.GitHubPlatformName, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return newGitHubProfile(*profile)
+}
+
+func (githubProvider) BatchGetProfiles(usernames []string) (map[string]Profile, error) {
+	stored, err := db.BatchGetProfiles(db.GitHubPlatformName, usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make(map[string]Profile)
+	for normalized, v := range stored {
+		if profiles[normalized], err = newGitHubProfile(v); err != nil {
+			return nil, err
+		}
+	}
+
+	return profiles, nil
+}
+
+func newGitHubProfile(profile db.Profile) (githubProfile, error) {
+	var user github.User
+	if err := json.Unmarshal(profile.Data, &user); err != nil {
+		return githubProfile{}, err
+	}
+
+	return githubProfile{&user}, nil
+}
+
+func (githubProvider) VerifyProof(profile Profile, userAddress string, networkID int, proofURL string) (string, error) {
+	return verifyGist(profile.(githubProfile).User, userAddress, networkID, proofURL)
+}
+
+// verifyGist checks that the proof gist is owned by the user and that one of
+// its files contains the claim signed by the address.
+func verifyGist(user *github.User, userAddress string, networkID int, proofURL string) (string, error) {
+	gistID, err := github.ParseGistURL(proofURL)
+	if err != nil {
+		return "", proof.ErrProofNotFound
+	}
+
+	gist, err := githubClient.FetchGist(gistID)
+	if err == github.ErrGistNotFound {
+		return "", proof.ErrProofNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if gist.Owner == nil || gist.Owner.ID != user.ID {
+		return "", proof.ErrAuthorMismatch
+	}
+
+	claim := proof.Claim{
+		PlatformName: db.GitHubPlatformName,
+		Username:     user.Login,
+		UserAddress:  userAddress,
+		NetworkID:    networkID,
+	}
+
+	filenames := make([]string, 0, len(gist.Files))
+	for filename := range gist.Files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	contents := make([]string, len(filenames))
+	for i, filename := range filenames {
+		contents[i] = gist.Files[filename].Content
+	}
+
+	return proof.VerifyAny(claim, contents)
+}
+
+func NewGitHubOAuthInfo(user github.User) *GitHubOAuthInfo {
+	return &GitHubOAuthInfo{
+		User: &user,
+	}
+}
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/github"
+	"github.com/dcb9/keymeshOAuth/proof"
+	"golang.org/x/oauth2"
+)
+
+// stubGitHub points githubClient and githubOAuth2Config to a fake GitHub
+// where the code "code" logs octocat in and the gists are served by ID, until
+// the test ends.
+func stubGitHub(t *testing.T, gists map[string]github.Gist) {
+	t.Helper()
+
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "code" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "bad_verification_code"})
+			return
+		}
+		writeJSON(w, map[string]string{"access_token": "token", "token_type": "bearer"})
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, github.User{ID: 583231, Login: "octocat"})
+	})
+	mux.HandleFunc("/gists/", func(w http.ResponseWriter, r *http.Request) {
+		gist, ok := gists[strings.TrimPrefix(r.URL.Path, "/gists/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, gist)
+	})
+	server := httptest.NewServer(mux)
+
+	savedClient, savedConfig := githubClient, githubOAuth2Config
+	githubClient = &github.Client{BaseURL: server.URL, HTTPClient: server.Client()}
+	githubOAuth2Config = &oauth2.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Endpoint:     oauth2.Endpoint{TokenURL: server.URL + "/login/oauth/access_token"},
+	}
+	t.Cleanup(func() {
+		githubClient, githubOAuth2Config = savedClient, savedConfig
+		server.Close()
+	})
+}
+
+func TestGitHubCallback(t *testing.T) {
+	stubGitHub(t, nil)
+
+	err := db.PutRequestToken(db.RequestToken{
+		Token:        "github-state",
+		PlatformName: db.GitHubPlatformName,
+		ExpiresAt:    time.Now().Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/oauth/github/callback?code=code&state=github-state", nil)
+	profile, err := githubProvider{}.Callback(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Username() != "octocat" {
+		t.Errorf("got username %s", profile.Username())
+	}
+
+	stored, err := db.GetProfile(db.GitHubPlatformName, "octocat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.UserID != "583231" {
+		t.Errorf("got stored user ID %q", stored.UserID)
+	}
+
+	// the state can only be used once
+	req = httptest.NewRequest(http.MethodGet, "/oauth/github/callback?code=code&state=github-state", nil)
+	if _, err = (githubProvider{}).Callback(req); err != ErrUnknownRequestToken {
+		t.Errorf("got %v, want ErrUnknownRequestToken", err)
+	}
+}
+
+func TestVerifyGist(t *testing.T) {
+	signer := newTestSigner(t)
+	user := &github.User{ID: 583231, Login: "octocat"}
+	claim := proof.Claim{
+		PlatformName: db.GitHubPlatformName,
+		Username:     user.Login,
+		UserAddress:  signer.address,
+		NetworkID:    1,
+	}
+	content := claim.Text() + "\n\n" + signer.signMessage(t, claim.Text())
+	// the claim of another account signed by the address, pasted in place
+	// of the signature
+	other := claim
+	other.Username = "mallory"
+	edited := claim.Text() + "\n\n" + signer.signMessage(t, other.Text())
+
+	gist := func(id string, ownerID int64, content string) github.Gist {
+		return github.Gist{
+			ID:    id,
+			Owner: &github.User{ID: ownerID},
+			Files: map[string]*github.GistFile{
+				"README.md":  {Filename: "README.md", Content: "notes"},
+				"keymesh.md": {Filename: "keymesh.md", Content: content},
+			},
+		}
+	}
+	stubGitHub(t, map[string]github.Gist{
+		"a1": gist("a1", 583231, content),
+		"a2": gist("a2", 1, content),
+		"a3": gist("a3", 583231, edited),
+		"a4": gist("a4", 583231, "a gist without the claim"),
+	})
+
+	tests := []struct {
+		proofURL string
+		err      error
+	}{
+		{"https://gist.github.com/octocat/a1", nil},
+		{"https://gist.github.com/mallory/a2", proof.ErrAuthorMismatch},
+		{"https://gist.github.com/octocat/a3", proof.ErrInvalidSignature},
+		{"https://gist.github.com/octocat/a4", proof.ErrClaimNotFound},
+		{"https://gist.github.com/octocat/a5", proof.ErrProofNotFound},
+		{"https://github.com/octocat/a1", proof.ErrProofNotFound},
+	}
+	for _, test := range tests {
+		if _, err := verifyGist(user, signer.address, 1, test.proofURL); err != test.err {
+			t.Errorf("%s: got %v, want %v", test.proofURL, err, test.err)
+		}
+	}
+}
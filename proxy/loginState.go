@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/crypto"
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/eth"
+)
+
+var (
+	ErrInvalidUserAddress = errors.New(`the query param "userAddress" must be an Ethereum address`)
+	ErrInvalidNetworkID   = errors.New(`the query param "networkID" must be a registered network`)
+	ErrInvalidLoginState  = errors.New("invalid or expired login state")
+	ErrLoginStartExpired  = errors.New(`the query param "issuedAt" must be within 10 minutes of now`)
+	ErrInvalidLoginSig    = errors.New(`the query param "signature" must be a signature of the login start by userAddress`)
+	ErrLinkNotAuthorized  = errors.New("an account was linked to the address before, the login must be signed by the address to replace it")
+
+	loginStateSigner = newTokenSigner("LOGIN_STATE_SECRET")
+)
+
+var addressPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+
+// loginStartMaxAge is how far from now the login starts can be signed.
+const loginStartMaxAge = 10 * time.Minute
+
+// loginStartFields are the members of the LoginStart type of the typed data.
+var loginStartFields = []crypto.TypedDataField{
+	{Name: "platform", Type: "string"},
+	{Name: "userAddress", Type: "address"},
+	{Name: "issuedAt", Type: "uint256"},
+}
+
+// loginState is the state of a login, it is signed so that the address which
+// started the login can not be changed on the way back. Nonce makes every
+// state unique, the OAuth2 providers use the state as their request token.
+type loginState struct {
+	Nonce       string `json:"n"`
+	UserAddress string `json:"a,omitempty"`
+	NetworkID   int    `json:"i,omitempty"`
+	// Signed is set if the address signed the start of the login, the
+	// account it logs in with then replaces the one linked before.
+	Signed    bool  `json:"s,omitempty"`
+	ExpiresAt int64 `json:"e"`
+	// Completion is how the browser is sent back to the frontend, ReturnTo
+	// is the URL it is redirected to or the origin of the popup opener.
+	Completion completionMode `json:"c,omitempty"`
+	ReturnTo   string         `json:"r,omitempty"`
+}
+
+// newLoginState reads the optional "userAddress" and "networkID" query params
+// of the authorize request, the account the user logs in with is linked to
+// that address by the callback. The optional "issuedAt" and "signature"
+// params are the signature of the login start by the address, see
+// LoginStartTypedData. The completion params are described by
+// parseCompletion.
+func newLoginState(platformName db.PlatformName, req *http.Request) (string, error) {
+	if err := req.ParseForm(); err != nil {
+		return "", &LoginError{err}
+	}
+
+	nonce, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	state := loginState{
+		Nonce:     nonce,
+		ExpiresAt: time.Now().Add(requestTokenTTL).Unix(),
+	}
+
+	if userAddress := req.Form.Get("userAddress"); userAddress != "" {
+		if !addressPattern.MatchString(userAddress) {
+			return "", &LoginError{ErrInvalidUserAddress}
+		}
+		networkID, err := strconv.Atoi(req.Form.Get("networkID"))
+		if err != nil {
+			return "", &LoginError{ErrInvalidNetworkID}
+		}
+		if _, err = eth.LookupNetwork(networkID); err != nil {
+			return "", &LoginError{ErrInvalidNetworkID}
+		}
+		state.UserAddress = userAddress
+		state.NetworkID = networkID
+
+		if signature := req.Form.Get("signature"); signature != "" {
+			err = verifyLoginStart(platformName, userAddress, networkID, req.Form.Get("issuedAt"), signature)
+			if err != nil {
+				return "", err
+			}
+			state.Signed = true
+		}
+	}
+
+	if state.Completion, state.ReturnTo, err = parseCompletion(req); err != nil {
+		return "", &LoginError{err}
+	}
+
+	return loginStateSigner.sign(state)
+}
+
+// LoginStartTypedData returns the LoginStart the address signs with
+// eth_signTypedData_v4 to link the account it logs in with on the platform,
+// issuedAt is a Unix time.
+func LoginStartTypedData(platformName db.PlatformName, userAddress string, networkID int, issuedAt int64) (crypto.TypedData, error) {
+	network, err := eth.LookupNetwork(networkID)
+	if err != nil {
+		return crypto.TypedData{}, err
+	}
+
+	return crypto.NewTypedData(int64(network.ChainID), "LoginStart", loginStartFields, map[string]interface{}{
+		"platform":    string(platformName),
+		"userAddress": userAddress,
+		"issuedAt":    big.NewInt(issuedAt),
+	}), nil
+}
+
+// verifyLoginStart returns a *LoginError unless signature is the signature
+// of the login start by the address, issued within loginStartMaxAge of now.
+func verifyLoginStart(platformName db.PlatformName, userAddress string, networkID int, issuedAtParam, signature string) error {
+	issuedAt, err := strconv.ParseInt(issuedAtParam, 10, 64)
+	if err != nil {
+		return &LoginError{ErrLoginStartExpired}
+	}
+	now := time.Now()
+	signedAt := time.Unix(issuedAt, 0)
+	if signedAt.Before(now.Add(-loginStartMaxAge)) || signedAt.After(now.Add(loginStartMaxAge)) {
+		return &LoginError{ErrLoginStartExpired}
+	}
+
+	typedData, err := LoginStartTypedData(platformName, userAddress, networkID, issuedAt)
+	if err != nil {
+		return err
+	}
+	caller, err := eth.ContractCaller(networkID)
+	if err != nil {
+		return err
+	}
+	_, err = crypto.VerifyTypedData(caller, userAddress, signature, typedData)
+	if _, ok := err.(*crypto.SignatureError); ok {
+		return &LoginError{ErrInvalidLoginSig}
+	}
+
+	return err
+}
+
+// parseLoginState returns the state of the callback request.
+func parseLoginState(req *http.Request) (*loginState, error) {
+	if err := req.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	var state loginState
+	if err := loginStateSigner.verify(req.Form.Get("state"), &state); err != nil {
+		return nil, ErrInvalidLoginState
+	}
+	if time.Now().Unix() > state.ExpiresAt {
+		return nil, ErrInvalidLoginState
+	}
+
+	return &state, nil
+}
+
+// withLoginState adds the state to the callback URL, for the platforms which
+// do not carry a state themselves.
+func withLoginState(callbackURL string, state string) (string, error) {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("state", state)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// accountProfile is implemented by the profiles of the platforms the users
+// log in with, the proofs of those platforms are only accepted for the
+// account linked to the address.
+type accountProfile interface {
+	// UserID is the stable ID of the account, the usernames can change.
+	UserID() string
+}
+
+// linkAccount records a pending authorization of the address for the
+// account, until its proof is verified. Anyone can start a login for any
+// address, so unless the address signed the start of the login, a verified
+// authorization is left as is and ErrLinkNotAuthorized is returned if
+// another authorization was linked to an account before.
+func linkAccount(state *loginState, platformName db.PlatformName, profile Profile) error {
+	account, ok := profile.(accountProfile)
+	if !ok || state.UserAddress == "" {
+		return nil
+	}
+
+	table := db.GetAuthorizationTable(state.NetworkID)
+	existing, err := table.GetAuthorizationItem(state.UserAddress, platformName)
+	if err != nil && err != db.ErrNotFound {
+		return err
+	}
+	now := time.Now()
+	if existing != nil && !state.Signed {
+		if existing.StatusAt(now) == db.StatusVerified {
+			return nil
+		}
+		if existing.UserID != "" {
+			return ErrLinkNotAuthorized
+		}
+	}
+
+	item := db.AuthorizationItem{
+		UserAddress:  state.UserAddress,
+		PlatformName: platformName,
+		Username:     profile.Username(),
+		Status:       db.StatusPending,
+		UserID:       account.UserID(),
+		LinkedAt:     now,
+	}
+	return db.ChangeAuthorization(state.NetworkID, item, db.AuthorizationChange{
+		Type:  db.EventLink,
+		Actor: db.ActorUser,
+	})
+}
@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+)
+
+// startLogin returns the state of a login started with the query params.
+func startLogin(t *testing.T, params url.Values) (*loginState, error) {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/oauth/github/authorize_url?"+params.Encode(), nil)
+	signed, err := newLoginState(db.GitHubPlatformName, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLoginState(httptest.NewRequest("GET", "/oauth/github/callback?state="+url.QueryEscape(signed), nil))
+}
+
+func TestNewLoginStateSignature(t *testing.T) {
+	signer := newTestSigner(t)
+	other := newTestSigner(t)
+	issuedAt := time.Now().Unix()
+	typedData, err := LoginStartTypedData(db.GitHubPlatformName, signer.address, 1, issuedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := url.Values{}
+	params.Set("userAddress", signer.address)
+	params.Set("networkID", "1")
+
+	state, err := startLogin(t, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.UserAddress != signer.address || state.Signed {
+		t.Errorf("got %+v without a signature", state)
+	}
+
+	params.Set("issuedAt", strconv.FormatInt(issuedAt, 10))
+	params.Set("signature", signer.signTypedData(t, typedData))
+	if state, err = startLogin(t, params); err != nil {
+		t.Fatal(err)
+	}
+	if !state.Signed {
+		t.Errorf("got %+v, want a signed login", state)
+	}
+
+	tests := []struct {
+		issuedAt  int64
+		signature string
+		err       error
+	}{
+		{issuedAt, other.signTypedData(t, typedData), ErrInvalidLoginSig},
+		{issuedAt, "0x1234", ErrInvalidLoginSig},
+		{issuedAt + 1, signer.signTypedData(t, typedData), ErrInvalidLoginSig},
+		{issuedAt - 3600, signer.signTypedData(t, typedData), ErrLoginStartExpired},
+	}
+	for i, test := range tests {
+		params.Set("issuedAt", strconv.FormatInt(test.issuedAt, 10))
+		params.Set("signature", test.signature)
+		_, err = startLogin(t, params)
+		if loginErr, ok := err.(*LoginError); !ok || loginErr.Err != test.err {
+			t.Errorf("%d: got %v, want %v", i, err, test.err)
+		}
+	}
+}
+
+func TestLinkAccount(t *testing.T) {
+	signer := newTestSigner(t)
+	table := db.GetAuthorizationTable(1)
+	get := func() *db.AuthorizationItem {
+		item, err := table.GetAuthorizationItem(signer.address, db.GitHubPlatformName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return item
+	}
+
+	unsigned := &loginState{UserAddress: signer.address, NetworkID: 1}
+	signed := &loginState{UserAddress: signer.address, NetworkID: 1, Signed: true}
+
+	// the first login links the account
+	if err := linkAccount(unsigned, db.GitHubPlatformName, testProfile{"alice", "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if item := get(); item.UserID != "1" || item.Status != db.StatusPending {
+		t.Errorf("got %+v", item)
+	}
+
+	// someone else can not replace it
+	if err := linkAccount(unsigned, db.GitHubPlatformName, testProfile{"mallory", "2"}); err != ErrLinkNotAuthorized {
+		t.Errorf("got %v, want ErrLinkNotAuthorized", err)
+	}
+	if item := get(); item.UserID != "1" {
+		t.Errorf("the account was replaced by %s", item.UserID)
+	}
+
+	// the address can
+	if err := linkAccount(signed, db.GitHubPlatformName, testProfile{"alice2", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if item := get(); item.UserID != "3" || item.Username != "alice2" {
+		t.Errorf("got %+v", item)
+	}
+
+	// the verified authorizations are left as they are
+	item := get()
+	item.MarkVerified(time.Now(), "payload")
+	if err := table.PutAuthorizationItem(*item); err != nil {
+		t.Fatal(err)
+	}
+	if err := linkAccount(unsigned, db.GitHubPlatformName, testProfile{"mallory", "2"}); err != nil {
+		t.Errorf("got %v", err)
+	}
+	if item = get(); item.UserID != "3" || item.Status != db.StatusVerified {
+		t.Errorf("got %+v", item)
+	}
+}
@@ -0,0 +1,291 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/mastodon"
+	"github.com/dcb9/keymeshOAuth/proof"
+	"golang.org/x/oauth2"
+)
+
+var (
+	mastodonClient = mastodon.NewClient()
+
+	ErrMissingHandle = errors.New(`the query param "handle" must be set`)
+)
+
+func init() {
+	RegisterProvider(db.MastodonPlatformName, mastodonProvider{})
+}
+
+type mastodonProvider struct{}
+
+// mastodonProfile is the account as returned by verify_credentials, its
+// username is the handle without the leading @.
+type mastodonProfile struct {
+	Handle   string            `json:"handle"`
+	Instance string            `json:"instance"`
+	Account  *mastodon.Account `json:"account"`
+}
+
+func (p mastodonProfile) Username() string {
+	return p.Handle
+}
+
+// UserID qualifies the ID of the account with its instance since the IDs are
+// local to the instances.
+func (p mastodonProfile) UserID() string {
+	return p.Account.ID + "@" + p.Instance
+}
+
+func (p mastodonProfile) Public() interface{} {
+	return &MastodonOAuthInfo{
+		Handle:  p.Handle,
+		Account: p.Account,
+	}
+}
+
+// mastodonLogin is kept as the secret of the request token while the user
+// logs in with the instance.
+type mastodonLogin struct {
+	Domain   string `json:"domain"`
+	Instance string `json:"instance"`
+}
+
+// LoginURL resolves the handle given in the "handle" query param and
+// registers the service on its instance if needed.
+func (mastodonProvider) LoginURL(req *http.Request) (string, error) {
+	if err := req.ParseForm(); err != nil {
+		return "", &LoginError{err}
+	}
+	handle := req.Form.Get("handle")
+	if handle == "" {
+		return "", &LoginError{ErrMissingHandle}
+	}
+
+	resolved, err := mastodonClient.ResolveHandle(handle)
+	switch err {
+	case mastodon.ErrInvalidHandle, mastodon.ErrHandleNotFound, mastodon.ErrInvalidActor:
+		return "", &LoginError{err}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	config, err := getMastodonConfig(resolved.Instance)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := newLoginState(db.MastodonPlatformName, req)
+	if err != nil {
+		return "", err
+	}
+	login, err := json.Marshal(mastodonLogin{
+		Domain:   resolved.Domain,
+		Instance: resolved.Instance,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = db.PutRequestToken(db.RequestToken{
+		Token:        state,
+		Secret:       string(login),
+		PlatformName: db.MastodonPlatformName,
+		ExpiresAt:    time.Now().Add(requestTokenTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return config.AuthCodeURL(state), nil
+}
+
+// getMastodonConfig returns the OAuth2 configuration of the app registered on
+// the instance, the app is registered the first time the instance is used.
+// The instance is the one of a resolved handle, so no app is registered on a
+// host which does not serve the actor of an account.
+func getMastodonConfig(instance string) (*oauth2.Config, error) {
+	app, err := db.GetOAuthApp(db.MastodonPlatformName, instance)
+	if err == db.ErrNotFound {
+		clientID, clientSecret, err := mastodonClient.RegisterApp(instance)
+		if err != nil {
+			return nil, err
+		}
+		// another login may have registered an app in the meantime, the one
+		// which was stored first is used by both
+		app, err = db.CreateOAuthApp(db.OAuthApp{
+			PlatformName: db.MastodonPlatformName,
+			Instance:     instance,
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			CreatedAt:    time.Now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return mastodonClient.Config(instance, app.ClientID, app.ClientSecret), nil
+}
+
+func (mastodonProvider) Callback(req *http.Request) (Profile, error) {
+	code, state, err := mastodon.ParseAuthorizationCallback(req)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := db.TakeRequestToken(state)
+	if err == db.ErrNotFound || (err == nil && stored.PlatformName != db.MastodonPlatformName) {
+		return nil, ErrUnknownRequestToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var login mastodonLogin
+	if err = json.Unmarshal([]byte(stored.Secret), &login); err != nil {
+		return nil, err
+	}
+
+	config, err := getMastodonConfig(login.Instance)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := mastodonClient.GetAccount(login.Instance, config, code)
+	if err != nil {
+		fmt.Println(err)
+		return nil, GetUserInfoErr
+	}
+
+	profile := mastodonProfile{
+		Handle:   mastodonHandle(account, login),
+		Instance: login.Instance,
+		Account:  account,
+	}
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.PutProfile(db.Profile{
+		PlatformName: db.MastodonPlatformName,
+		Username:     profile.Handle,
+		UserID:       profile.UserID(),
+		Data:         data,
+		UpdatedAt:    time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// mastodonHandle returns the handle of the account on the domain the user
+// logged in with, as long as the domain still delegates it to the instance.
+// The handle on the instance domain is used otherwise.
+func mastodonHandle(account *mastodon.Account, login mastodonLogin) string {
+	handle := mastodon.Handle{
+		Username: account.Username,
+		Domain:   login.Instance,
+		Instance: login.Instance,
+	}
+	if login.Domain == login.Instance {
+		return handle.String()
+	}
+
+	resolved, err := mastodonClient.ResolveHandle(account.Username + "@" + login.Domain)
+	if err == nil && resolved.Instance == login.Instance {
+		return resolved.String()
+	}
+
+	return handle.String()
+}
+
+func (mastodonProvider) GetProfile(username string) (Profile, error) {
+	profile, err := db.GetProfile(db.MastodonPlatformName, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMastodonProfile(*profile)
+}
+
+func (mastodonProvider) BatchGetProfiles(usernames []string) (map[string]Profile, error) {
+	stored, err := db.BatchGetProfiles(db.MastodonPlatformName, usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make(map[string]Profile)
+	for normalized, v := range stored {
+		if profiles[normalized], err = newMastodonProfile(v); err != nil {
+			return nil, err
+		}
+	}
+
+	return profiles, nil
+}
+
+func newMastodonProfile(stored db.Profile) (mastodonProfile, error) {
+	var profile mastodonProfile
+	if err := json.Unmarshal(stored.Data, &profile); err != nil {
+		return mastodonProfile{}, err
+	}
+	if profile.Account == nil {
+		return mastodonProfile{}, fmt.Errorf("mastodon profile %s has no account", stored.Username)
+	}
+
+	return profile, nil
+}
+
+func (mastodonProvider) VerifyProof(profile Profile, userAddress string, networkID int, proofURL string) (string, error) {
+	return verifyMastodonStatus(profile.(mastodonProfile), userAddress, networkID, proofURL)
+}
+
+// verifyMastodonStatus checks that the proof is a public status posted by the
+// account on its instance and contains the claim signed by the address.
+func verifyMastodonStatus(profile mastodonProfile, userAddress string, networkID int, proofURL string) (string, error) {
+	instance, statusID, err := mastodon.ParseStatusURL(proofURL)
+	if err != nil {
+		return "", proof.ErrProofNotFound
+	}
+	// the IDs of the accounts are only meaningful on their instance
+	if instance != profile.Instance {
+		return "", proof.ErrAuthorMismatch
+	}
+
+	status, err := mastodonClient.FetchStatus(instance, statusID)
+	if err == mastodon.ErrStatusNotFound {
+		return "", proof.ErrProofNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if status.Account == nil || status.Account.ID != profile.Account.ID {
+		return "", proof.ErrAuthorMismatch
+	}
+	if status.Visibility != "public" {
+		return "", proof.ErrProofNotPublic
+	}
+
+	claim := proof.Claim{
+		PlatformName: db.MastodonPlatformName,
+		Username:     profile.Handle,
+		UserAddress:  userAddress,
+		NetworkID:    networkID,
+	}
+
+	return proof.Verify(claim, status.Text())
+}
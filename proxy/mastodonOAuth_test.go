@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/mastodon"
+	"github.com/dcb9/keymeshOAuth/proof"
+)
+
+// stubMastodonInstance points mastodonClient to a fake instance where alice
+// has the ID 1 and posted the statuses, until the test ends.
+func stubMastodonInstance(t *testing.T, statuses map[string]mastodon.Status) string {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/apps", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"client_id": "client", "client_secret": "secret"})
+	})
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "token", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/api/v1/accounts/verify_credentials", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(mastodon.Account{ID: "1", Username: "alice"})
+	})
+	mux.HandleFunc("/api/v1/statuses/", func(w http.ResponseWriter, r *http.Request) {
+		status, ok := statuses[strings.TrimPrefix(r.URL.Path, "/api/v1/statuses/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+	server := httptest.NewServer(mux)
+
+	saved := mastodonClient
+	mastodonClient = &mastodon.Client{Scheme: "http", HTTPClient: server.Client()}
+	t.Cleanup(func() {
+		mastodonClient = saved
+		server.Close()
+	})
+
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestMastodonCallbackStoresQualifiedUserID(t *testing.T) {
+	instance := stubMastodonInstance(t, nil)
+
+	login, _ := json.Marshal(mastodonLogin{Domain: instance, Instance: instance})
+	err := db.PutRequestToken(db.RequestToken{
+		Token:        "state",
+		Secret:       string(login),
+		PlatformName: db.MastodonPlatformName,
+		ExpiresAt:    time.Now().Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/oauth/mastodon/callback?code=code&state=state", nil)
+	loggedIn, err := mastodonProvider{}.Callback(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := loggedIn.(mastodonProfile)
+	if profile.UserID() != "1@"+instance {
+		t.Errorf("got user ID %s", profile.UserID())
+	}
+
+	stored, err := db.GetProfile(db.MastodonPlatformName, "alice@"+instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.UserID != profile.UserID() {
+		t.Errorf("got stored user ID %q, want %q", stored.UserID, profile.UserID())
+	}
+}
+
+func TestVerifyMastodonStatus(t *testing.T) {
+	signer := newTestSigner(t)
+	// the handle holds the address of the fake instance, the statuses are
+	// added once it is known
+	statuses := make(map[string]mastodon.Status)
+	instance := stubMastodonInstance(t, statuses)
+	profile := mastodonProfile{
+		Handle:   "alice@" + instance,
+		Instance: instance,
+		Account:  &mastodon.Account{ID: "1", Username: "alice"},
+	}
+	claim := proof.Claim{
+		PlatformName: db.MastodonPlatformName,
+		Username:     profile.Handle,
+		UserAddress:  signer.address,
+		NetworkID:    1,
+	}
+	content := "<p>" + claim.Text() + "<br>" + signer.signMessage(t, claim.Text()) + "</p>"
+	statuses["1"] = mastodon.Status{ID: "1", Visibility: "public", Content: content, Account: &mastodon.Account{ID: "1"}}
+	statuses["2"] = mastodon.Status{ID: "2", Visibility: "unlisted", Content: content, Account: &mastodon.Account{ID: "1"}}
+	statuses["3"] = mastodon.Status{ID: "3", Visibility: "public", Content: content, Account: &mastodon.Account{ID: "2"}}
+
+	tests := []struct {
+		statusID string
+		err      error
+	}{
+		{"1", nil},
+		{"2", proof.ErrProofNotPublic},
+		{"3", proof.ErrAuthorMismatch},
+		{"4", proof.ErrProofNotFound},
+	}
+	for _, test := range tests {
+		proofURL := "http://" + instance + "/@alice/" + test.statusID
+		if _, err := verifyMastodonStatus(profile, signer.address, 1, proofURL); err != test.err {
+			t.Errorf("status %s: got %v, want %v", test.statusID, err, test.err)
+		}
+	}
+
+	if _, err := verifyMastodonStatus(profile, signer.address, 1, "https://other.example/@alice/1"); err != proof.ErrAuthorMismatch {
+		t.Errorf("got %v for a status of another instance, want ErrAuthorMismatch", err)
+	}
+}
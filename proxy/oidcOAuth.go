@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/oidc"
+	"github.com/dcb9/keymeshOAuth/pkce"
+	"github.com/dcb9/keymeshOAuth/proof"
+)
+
+// The OpenID Connect providers listed in OIDC_PROVIDERS are registered under
+// their platform name.
+func init() {
+	configs, err := oidc.LoadConfigs()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, config := range configs {
+		RegisterProvider(db.PlatformName(config.PlatformName), &oidcProvider{
+			platformName: db.PlatformName(config.PlatformName),
+			client:       oidc.NewProvider(config),
+		})
+	}
+}
+
+type oidcProvider struct {
+	platformName db.PlatformName
+	client       *oidc.Provider
+}
+
+// oidcProfile is the identity asserted by the ID token, its username is the
+// claim set by usernameClaim.
+type oidcProfile struct {
+	*oidc.Identity
+}
+
+func (p oidcProfile) Username() string {
+	return p.Identity.Username
+}
+
+func (p oidcProfile) UserID() string {
+	return p.Subject
+}
+
+func (p oidcProfile) Public() interface{} {
+	return &OIDCInfo{
+		Identity: p.Identity,
+	}
+}
+
+func (p oidcProfile) EmailAddress() string {
+	if !p.EmailVerified {
+		return ""
+	}
+	return p.Email
+}
+
+// oidcLogin is kept as the secret of the request token while the user logs
+// in with the provider.
+type oidcLogin struct {
+	CodeVerifier string `json:"codeVerifier"`
+	Nonce        string `json:"nonce"`
+}
+
+func (p *oidcProvider) LoginURL(req *http.Request) (string, error) {
+	state, err := newLoginState(p.platformName, req)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := pkce.NewVerifier()
+	if err != nil {
+		return "", err
+	}
+
+	loginURL, err := p.client.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		return "", err
+	}
+
+	login, err := json.Marshal(oidcLogin{
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = db.PutRequestToken(db.RequestToken{
+		Token:        state,
+		Secret:       string(login),
+		PlatformName: p.platformName,
+		ExpiresAt:    time.Now().Add(requestTokenTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return loginURL, nil
+}
+
+func (p *oidcProvider) Callback(req *http.Request) (Profile, error) {
+	code, state, err := oidc.ParseAuthorizationCallback(req)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := db.TakeRequestToken(state)
+	if err == db.ErrNotFound || (err == nil && stored.PlatformName != p.platformName) {
+		return nil, ErrUnknownRequestToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var login oidcLogin
+	if err = json.Unmarshal([]byte(stored.Secret), &login); err != nil {
+		return nil, err
+	}
+
+	identity, err := p.client.Exchange(code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		fmt.Println(err)
+		return nil, GetUserInfoErr
+	}
+
+	data, err := json.Marshal(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.PutProfile(db.Profile{
+		PlatformName: p.platformName,
+		Username:     identity.Username,
+		UserID:       identity.Subject,
+		Data:         data,
+		UpdatedAt:    time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return oidcProfile{identity}, nil
+}
+
+func (p *oidcProvider) GetProfile(username string) (Profile, error) {
+	profile, err := db.GetProfile(p.platformName, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return newOIDCProfile(*profile)
+}
+
+func (p *oidcProvider) BatchGetProfiles(usernames []string) (map[string]Profile, error) {
+	stored, err := db.BatchGetProfiles(p.platformName, usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make(map[string]Profile)
+	for normalized, v := range stored {
+		if profiles[normalized], err = newOIDCProfile(v); err != nil {
+			return nil, err
+		}
+	}
+
+	return profiles, nil
+}
+
+func newOIDCProfile(stored db.Profile) (oidcProfile, error) {
+	var identity oidc.Identity
+	if err := json.Unmarshal(stored.Data, &identity); err != nil {
+		return oidcProfile{}, err
+	}
+
+	return oidcProfile{&identity}, nil
+}
+
+// VerifyProof reads the proof from the URL, which must be under the proof
+// prefix of the user since the providers have no public posts of their own.
+func (p *oidcProvider) VerifyProof(profile Profile, userAddress string, networkID int, proofURL string) (string, error) {
+	username := profile.Username()
+	if !p.client.ProofURLAllowed(username, proofURL) {
+		return "", proof.ErrProofNotHosted
+	}
+
+	content, err := p.client.FetchDocument(proofURL)
+	if err == oidc.ErrDocumentNotFound {
+		return "", proof.ErrProofNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	claim := proof.Claim{
+		PlatformName: p.platformName,
+		Username:     username,
+		UserAddress:  userAddress,
+		NetworkID:    networkID,
+	}
+
+	return proof.Verify(claim, content)
+}
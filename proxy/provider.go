@@ -0,0 +1,358 @@
+package proxy
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/proof"
+)
+
+var ErrUnknownPlatform = errors.New("unknown platform")
+
+// LoginError is returned when a login can not be started because of the
+// request.
+type LoginError struct {
+	Err error
+}
+
+func (e *LoginError) Error() string {
+	return e.Err.Error()
+}
+
+// Provider is a platform the users can log in with and prove their account
+// on.
+type Provider interface {
+	// LoginURL starts a login and returns the URL of the platform the user is
+	// sent to, a *LoginError is returned if the request is invalid.
+	LoginURL(req *http.Request) (string, error)
+	// Callback completes the login and stores the profile of the user,
+	// ErrUnknownRequestToken is returned if the login was not started by
+	// LoginURL or has expired.
+	Callback(req *http.Request) (Profile, error)
+	// GetProfile returns db.ErrNotFound if the user has not logged in.
+	GetProfile(username string) (Profile, error)
+	// BatchGetProfiles maps the profiles found by normalized username.
+	BatchGetProfiles(usernames []string) (map[string]Profile, error)
+	// VerifyProof returns a *proof.Error if the proof is rejected, and the
+	// payload of the proof, the claim and the signature found, if any. The
+	// typed data signatures are bound to the chain of the network.
+	VerifyProof(profile Profile, userAddress string, networkID int, proofURL string) (string, error)
+}
+
+// Profile is the account of a user on a platform, it is serialized as is in
+// the response of the callback.
+type Profile interface {
+	// Username is the name the proofs are made for.
+	Username() string
+	// Public is the part of the profile which is shown in UserInfo.
+	Public() interface{}
+}
+
+// proofLocator is implemented by the providers which read the proofs from a
+// fixed location rather than from the URL published by the user, an empty
+// URL keeps the published one.
+type proofLocator interface {
+	ProofURL(username string) string
+}
+
+// userIDResolver is implemented by the providers which can look their
+// profiles up by account, BatchGetProfilesByUserID maps the profiles found by
+// user ID. The authorizations linked to an account are resolved by ID so that
+// they follow the renames of the account.
+type userIDResolver interface {
+	BatchGetProfilesByUserID(userIDs []string) (map[string]Profile, error)
+}
+
+// emailProfile is implemented by the profiles which have an email address,
+// it is only used to derive the gravatar hash.
+type emailProfile interface {
+	EmailAddress() string
+}
+
+var (
+	providers      = make(map[db.PlatformName]Provider)
+	providersMutex = &sync.RWMutex{}
+)
+
+// RegisterProvider makes the provider available under /oauth/{platform}/.
+func RegisterProvider(platformName db.PlatformName, provider Provider) {
+	providersMutex.Lock()
+	defer providersMutex.Unlock()
+
+	if _, ok := providers[platformName]; ok {
+		panic(fmt.Sprintf("provider %s is registered twice", platformName))
+	}
+	providers[platformName] = provider
+}
+
+// LookupProvider returns ErrUnknownPlatform if no provider is registered for
+// the platform.
+func LookupProvider(platformName db.PlatformName) (Provider, error) {
+	providersMutex.RLock()
+	provider, ok := providers[platformName]
+	providersMutex.RUnlock()
+	if !ok {
+		return nil, ErrUnknownPlatform
+	}
+
+	return provider, nil
+}
+
+// Platforms returns the names of the registered providers in order.
+func Platforms() []db.PlatformName {
+	providersMutex.RLock()
+	names := make([]db.PlatformName, 0, len(providers))
+	for platformName := range providers {
+		names = append(names, platformName)
+	}
+	providersMutex.RUnlock()
+
+	sort.Slice(names, func(i, j int) bool {
+		return names[i] < names[j]
+	})
+
+	return names
+}
+
+// ParseOAuthPath splits the paths of the form /oauth/{platform}/{action}.
+func ParseOAuthPath(path string) (platformName db.PlatformName, action string, ok bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "oauth" {
+		return "", "", false
+	}
+
+	return db.PlatformName(parts[1]), parts[2], true
+}
+
+func HandleLoginURL(platformName db.PlatformName, req *http.Request) (string, error) {
+	provider, err := LookupProvider(platformName)
+	if err != nil {
+		return "", err
+	}
+
+	return provider.LoginURL(req)
+}
+
+// HandleCallback completes the login and responds as the login state asks,
+// see completeLogin.
+func HandleCallback(platformName db.PlatformName, req *http.Request) (*CallbackResponse, error) {
+	provider, err := LookupProvider(platformName)
+	if err != nil {
+		return nil, err
+	}
+
+	// the state has been taken as a request token by the OAuth2 providers
+	// and carried by the callback URL of the others
+	state, err := parseLoginState(req)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := provider.Callback(req)
+	if err == nil {
+		err = linkAccount(state, platformName, profile)
+	}
+
+	return completeLogin(state, platformName, profile, err)
+}
+
+// HandleVerify checks the last proof of the user, socialProof is only given
+// on the private networks where the proofs are not watched.
+func HandleVerify(platformName db.PlatformName, userAddress string, networkID int, socialProof *SocialProof) (err error) {
+	provider, err := LookupProvider(platformName)
+	if err != nil {
+		return
+	}
+
+	if socialProof == nil {
+		socialProof, err = getSocialProof(userAddress, platformName)
+		if err != nil {
+			return
+		}
+	}
+
+	profile, err := provider.GetProfile(socialProof.Username)
+	if err != nil {
+		return
+	}
+
+	existing, err := db.GetAuthorizationTable(networkID).GetAuthorizationItem(userAddress, platformName)
+	if err != nil && err != db.ErrNotFound {
+		return
+	}
+	// the proof of an account the address unlinked may still be public, it is
+	// not verified again until the account is linked again
+	if existing != nil && existing.RevokedByUser() {
+		return ErrRevokedByUser
+	}
+
+	// the state of the authorization and the account linked to it are kept
+	item := db.AuthorizationItem{
+		UserAddress:  userAddress,
+		PlatformName: platformName,
+	}
+	if existing != nil {
+		item = *existing
+	}
+	item.Username = socialProof.Username
+	item.ProofURL = socialProof.ProofURL
+	if locator, ok := provider.(proofLocator); ok {
+		if proofURL := locator.ProofURL(socialProof.Username); proofURL != "" {
+			item.ProofURL = proofURL
+		}
+	}
+
+	// the proofs of the platforms with a login are only accepted for the
+	// account the address logged in with
+	if account, ok := profile.(accountProfile); ok && account.UserID() != item.UserID {
+		return recordProofResult(networkID, item, "", proof.ErrAccountNotLinked)
+	}
+
+	payload, err := provider.VerifyProof(profile, userAddress, networkID, socialProof.ProofURL)
+	return recordProofResult(networkID, item, payload, err)
+}
+
+// getAccountProfile returns the profile of the account with the user ID, or
+// of the username if there is no user ID. The profiles are looked up by ID
+// when the provider can since the username may belong to another account
+// after a rename, proof.ErrAccountNotLinked is returned if the profile found
+// is of another account.
+func getAccountProfile(provider Provider, username, userID string) (Profile, error) {
+	if userID == "" {
+		return provider.GetProfile(username)
+	}
+
+	var profile Profile
+	if resolver, ok := provider.(userIDResolver); ok {
+		profiles, err := resolver.BatchGetProfilesByUserID([]string{userID})
+		if err != nil {
+			return nil, err
+		}
+		if profile, ok = profiles[userID]; !ok {
+			return nil, db.ErrNotFound
+		}
+	} else {
+		var err error
+		if profile, err = provider.GetProfile(username); err != nil {
+			return nil, err
+		}
+	}
+
+	if account, ok := profile.(accountProfile); ok && account.UserID() != userID {
+		return nil, proof.ErrAccountNotLinked
+	}
+
+	return profile, nil
+}
+
+// fillPlatformProfiles sets the public profiles of the users of one platform.
+func fillPlatformProfiles(provider Provider, userInfoList []*UserInfo) error {
+	byUsername := userInfoList
+	if resolver, ok := provider.(userIDResolver); ok {
+		var err error
+		if byUsername, err = fillProfilesByUserID(resolver, userInfoList); err != nil {
+			return err
+		}
+	}
+	if len(byUsername) < 1 {
+		return nil
+	}
+
+	usernames := make([]string, len(byUsername))
+	for i, v := range byUsername {
+		usernames[i] = v.Username
+	}
+
+	profiles, err := provider.BatchGetProfiles(usernames)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range byUsername {
+		if profile, ok := profiles[db.NormalizeUsername(v.Username)]; ok {
+			setProfile(v, profile)
+		}
+	}
+
+	return nil
+}
+
+// fillProfilesByUserID sets the profiles of the users linked to an account
+// and their current username, it returns the users which are not linked.
+func fillProfilesByUserID(resolver userIDResolver, userInfoList []*UserInfo) ([]*UserInfo, error) {
+	unlinked := make([]*UserInfo, 0)
+	userIDs := make([]string, 0, len(userInfoList))
+	for _, v := range userInfoList {
+		if v.userID == "" {
+			unlinked = append(unlinked, v)
+			continue
+		}
+		userIDs = append(userIDs, v.userID)
+	}
+	if len(userIDs) < 1 {
+		return unlinked, nil
+	}
+
+	profiles, err := resolver.BatchGetProfilesByUserID(userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range userInfoList {
+		if profile, ok := profiles[v.userID]; ok && v.userID != "" {
+			v.Username = profile.Username()
+			setProfile(v, profile)
+		}
+	}
+
+	return unlinked, nil
+}
+
+func setProfile(v *UserInfo, profile Profile) {
+	v.Profile = profile.Public()
+	if p, ok := profile.(emailProfile); ok {
+		v.GravatarHash = fmt.Sprintf("%x", md5.Sum([]byte(p.EmailAddress())))
+	}
+}
+
+// fillOAuthInfo looks up the profiles of every platform concurrently, the
+// users of the platforms which are not registered anymore are left as is.
+func fillOAuthInfo(userInfoList []*UserInfo) error {
+	byPlatform := make(map[db.PlatformName][]*UserInfo)
+	for _, v := range userInfoList {
+		byPlatform[v.PlatformName] = append(byPlatform[v.PlatformName], v)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mutex    sync.Mutex
+		firstErr error
+	)
+	for platformName, list := range byPlatform {
+		provider, err := LookupProvider(platformName)
+		if err != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(provider Provider, list []*UserInfo) {
+			defer wg.Done()
+			if err := fillPlatformProfiles(provider, list); err != nil {
+				mutex.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mutex.Unlock()
+			}
+		}(provider, list)
+	}
+	wg.Wait()
+
+	return firstErr
+}
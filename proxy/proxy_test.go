@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/dcb9/keymeshOAuth/crypto"
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestMain(m *testing.M) {
+	db.SetStore(db.NewMemoryStore())
+	if err := UseRandomSecrets(); err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// testSigner is an externally owned account which signs as personal_sign.
+type testSigner struct {
+	key     *ecdsa.PrivateKey
+	address string
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+
+	key, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testSigner{key: key, address: ethCrypto.PubkeyToAddress(key.PublicKey).Hex()}
+}
+
+func (s *testSigner) signMessage(t *testing.T, msg string) string {
+	t.Helper()
+
+	hash := ethCrypto.Keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(msg), msg)))
+	sig, err := ethCrypto.Sign(hash, s.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hexutil.Encode(sig)
+}
+
+func (s *testSigner) signTypedData(t *testing.T, td crypto.TypedData) string {
+	t.Helper()
+
+	hash, err := td.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := ethCrypto.Sign(hash, s.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hexutil.Encode(sig)
+}
+
+// testProfile is the profile of an account of a platform with a login.
+type testProfile struct {
+	username string
+	userID   string
+}
+
+func (p testProfile) Username() string {
+	return p.username
+}
+
+func (p testProfile) UserID() string {
+	return p.userID
+}
+
+func (p testProfile) Public() interface{} {
+	return p.username
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/crypto"
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/eth"
+)
+
+var (
+	ErrInvalidRevokeSignature = errors.New("the signature is not a signature of the revoke message by userAddress")
+	ErrRevokeExpired          = errors.New(`"issuedAt" must be within 10 minutes of now`)
+	ErrRevokeOutdated         = errors.New("the revoke message was signed before the authorization was last updated")
+	ErrRevokedByUser          = errors.New("the authorization was revoked by userAddress, the account must be linked again through a login")
+)
+
+// revokeMaxAge is how far from now the revoke messages can be issued, the
+// messages can be replayed within that time.
+const revokeMaxAge = 10 * time.Minute
+
+// RevokeMessage is the text the address signs with personal_sign to revoke
+// its authorization on the platform, issuedAt is a Unix time.
+func RevokeMessage(platformName db.PlatformName, userAddress string, networkID int, issuedAt int64) string {
+	return fmt.Sprintf(
+		"Revoke the KeyMesh authorization of %s on %s for network %d at %d",
+		strings.ToLower(userAddress),
+		platformName,
+		networkID,
+		issuedAt,
+	)
+}
+
+// HandleRevoke marks the authorization of the address as revoked if the
+// signature of its revoke message is valid. The authorization is kept so that
+// its history is not lost, db.ErrNotFound is returned if there is none.
+func HandleRevoke(platformName db.PlatformName, userAddress string, networkID int, issuedAt int64, signature string) error {
+	if _, err := LookupProvider(platformName); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	signedAt := time.Unix(issuedAt, 0)
+	if signedAt.Before(now.Add(-revokeMaxAge)) || signedAt.After(now.Add(revokeMaxAge)) {
+		return ErrRevokeExpired
+	}
+
+	caller, err := eth.ContractCaller(networkID)
+	if err != nil {
+		return err
+	}
+	message := RevokeMessage(platformName, userAddress, networkID, issuedAt)
+	_, err = crypto.VerifyMessage(caller, userAddress, signature, []byte(message))
+	if _, ok := err.(*crypto.SignatureError); ok {
+		return ErrInvalidRevokeSignature
+	}
+	if err != nil {
+		return err
+	}
+
+	item, err := db.GetAuthorizationTable(networkID).GetAuthorizationItem(userAddress, platformName)
+	if err != nil {
+		return err
+	}
+	// a message signed before the account was linked or verified again can
+	// not revoke it
+	if signedAt.Before(item.LinkedAt.Truncate(time.Second)) || signedAt.Before(item.VerifiedAt.Truncate(time.Second)) {
+		return ErrRevokeOutdated
+	}
+
+	item.MarkRevokedByUser(now)
+	return db.ChangeAuthorization(networkID, *item, db.AuthorizationChange{
+		Type:  db.EventRevoke,
+		Actor: db.ActorUser,
+	})
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+)
+
+// testPlatformName is a platform with a login whose proofs are all valid.
+const testPlatformName db.PlatformName = "test"
+
+func init() {
+	RegisterProvider(testPlatformName, acceptingProvider{})
+}
+
+type acceptingProvider struct{}
+
+func (acceptingProvider) LoginURL(req *http.Request) (string, error) {
+	return "", nil
+}
+
+func (acceptingProvider) Callback(req *http.Request) (Profile, error) {
+	return nil, ErrUnknownRequestToken
+}
+
+func (acceptingProvider) GetProfile(username string) (Profile, error) {
+	return testProfile{username, "1"}, nil
+}
+
+func (acceptingProvider) BatchGetProfiles(usernames []string) (map[string]Profile, error) {
+	return nil, nil
+}
+
+func (acceptingProvider) VerifyProof(profile Profile, userAddress string, networkID int, proofURL string) (string, error) {
+	return "payload", nil
+}
+
+func TestVerifyAfterRevoke(t *testing.T) {
+	signer := newTestSigner(t)
+	table := db.GetAuthorizationTable(1)
+	get := func() *db.AuthorizationItem {
+		item, err := table.GetAuthorizationItem(signer.address, testPlatformName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return item
+	}
+	socialProof := &SocialProof{Username: "alice", ProofURL: "https://example.com/alice/proof"}
+
+	if err := linkAccount(&loginState{UserAddress: signer.address, NetworkID: 1}, testPlatformName, testProfile{"alice", "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := HandleVerify(testPlatformName, signer.address, 1, socialProof); err != nil {
+		t.Fatal(err)
+	}
+	if item := get(); item.Status != db.StatusVerified {
+		t.Fatalf("got %+v", item)
+	}
+
+	issuedAt := time.Now().Unix()
+	signature := signer.signMessage(t, RevokeMessage(testPlatformName, signer.address, 1, issuedAt))
+	if err := HandleRevoke(testPlatformName, signer.address, 1, issuedAt, signature); err != nil {
+		t.Fatal(err)
+	}
+
+	// the proof is still public but does not verify the authorization again
+	if err := HandleVerify(testPlatformName, signer.address, 1, socialProof); err != ErrRevokedByUser {
+		t.Errorf("got %v, want ErrRevokedByUser", err)
+	}
+	if item := get(); item.Status != db.StatusRevoked || !item.RevokedByUser() {
+		t.Errorf("got %+v", item)
+	}
+
+	// nor does a login the address did not sign
+	if err := linkAccount(&loginState{UserAddress: signer.address, NetworkID: 1}, testPlatformName, testProfile{"alice", "1"}); err != ErrLinkNotAuthorized {
+		t.Errorf("got %v, want ErrLinkNotAuthorized", err)
+	}
+	if item := get(); !item.RevokedByUser() {
+		t.Errorf("got %+v", item)
+	}
+
+	// the account linked again by the address is verified again
+	if err := linkAccount(&loginState{UserAddress: signer.address, NetworkID: 1, Signed: true}, testPlatformName, testProfile{"alice", "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := HandleVerify(testPlatformName, signer.address, 1, socialProof); err != nil {
+		t.Fatal(err)
+	}
+	if item := get(); item.Status != db.StatusVerified || item.RevokedByUser() {
+		t.Errorf("got %+v", item)
+	}
+}
@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	errInvalidSignedToken = errors.New("invalid signed token")
+	errNoTokenSecret      = errors.New("the secret of the signed tokens is not set")
+	errInvalidSealedToken = errors.New("invalid sealed token")
+)
+
+// tokenSigner serializes values into URL safe tokens which are authenticated
+// with HMAC-SHA256, the tokens are not encrypted. The secrets which must not
+// be readable are sealed with AES-GCM instead, see seal.
+type tokenSigner struct {
+	envName string
+	key     []byte
+}
+
+// tokenSigners are all the signers, see VerifySecrets.
+var tokenSigners []*tokenSigner
+
+// newTokenSigner reads the key from the environment variable, the tokens can
+// not be signed nor verified if it is not set.
+func newTokenSigner(envName string) *tokenSigner {
+	s := &tokenSigner{
+		envName: envName,
+		key:     []byte(os.Getenv(envName)),
+	}
+	tokenSigners = append(tokenSigners, s)
+
+	return s
+}
+
+// VerifySecrets checks that the secrets of the signed tokens are set. The
+// tokens are checked by other instances than the one which signed them, so
+// the secrets must be the same everywhere rather than generated.
+func VerifySecrets() error {
+	missing := make([]string, 0)
+	for _, s := range tokenSigners {
+		if len(s.key) == 0 {
+			missing = append(missing, s.envName)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s must be set", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// UseRandomSecrets generates the secrets which are not set, the tokens are
+// then only valid for this process. It is meant for the dev server.
+func UseRandomSecrets() error {
+	for _, s := range tokenSigners {
+		if len(s.key) > 0 {
+			continue
+		}
+		fmt.Printf("%s is not set, using a random key\n", s.envName)
+		s.key = make([]byte, 32)
+		if _, err := rand.Read(s.key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *tokenSigner) sign(v interface{}) (string, error) {
+	if len(s.key) == 0 {
+		return "", errNoTokenSecret
+	}
+
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	encoding := base64.RawURLEncoding
+	return encoding.EncodeToString(payload) + "." + encoding.EncodeToString(s.mac(payload)), nil
+}
+
+func (s *tokenSigner) verify(token string, v interface{}) error {
+	if len(s.key) == 0 {
+		return errNoTokenSecret
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return errInvalidSignedToken
+	}
+
+	encoding := base64.RawURLEncoding
+	payload, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return errInvalidSignedToken
+	}
+	mac, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return errInvalidSignedToken
+	}
+	if !hmac.Equal(mac, s.mac(payload)) {
+		return errInvalidSignedToken
+	}
+
+	if err = json.Unmarshal(payload, v); err != nil {
+		return errInvalidSignedToken
+	}
+
+	return nil
+}
+
+func (s *tokenSigner) mac(payload []byte) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// seal encrypts and authenticates plaintext with AES-256-GCM, the key is
+// derived from the secret of the signer.
+func (s *tokenSigner) seal(plaintext string) (string, error) {
+	aead, err := s.aead()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+}
+
+// open returns the plaintext of a token sealed with the same secret.
+func (s *tokenSigner) open(sealed string) (string, error) {
+	aead, err := s.aead()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", errInvalidSealedToken
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errInvalidSealedToken
+	}
+
+	return string(plaintext), nil
+}
+
+func (s *tokenSigner) aead() (cipher.AEAD, error) {
+	if len(s.key) == 0 {
+		return nil, errNoTokenSecret
+	}
+
+	key := sha256.Sum256(s.key)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// randomToken returns a random hex token which can not be guessed.
+func randomToken() (string, error) {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(bs), nil
+}
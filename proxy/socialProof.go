@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/proof"
+)
+
+var (
+	GetUserInfoErr = errors.New("get user info error")
+	lambdaService  = lambda.New(session.New())
+)
+
+type GetUserLastProofEventPlayload struct {
+	UserAddress string          `json:"userAddress"`
+	Platform    db.PlatformName `json:"platform"`
+}
+
+type SocialProof struct {
+	ProofURL string `json:"proofURL"`
+	Username string `json:"username"`
+}
+
+// requestTokenTTL is how long the users have to complete a login.
+const requestTokenTTL = 15 * time.Minute
+
+var ErrUnknownRequestToken = errors.New("unknown, expired or already used request token")
+
+// recordProofResult stores the authorization as verified if the proof was
+// accepted, proof errors are recorded and the other errors returned as is.
+func recordProofResult(networkID int, item db.AuthorizationItem, payload string, verifyErr error) error {
+	now := time.Now()
+	if verifyErr != nil {
+		if _, ok := verifyErr.(*proof.Error); !ok {
+			return verifyErr
+		}
+		return recordProofFailure(networkID, item, now, payload, verifyErr)
+	}
+
+	change := db.AuthorizationChange{
+		Type:  db.EventVerify,
+		Actor: db.ActorUser,
+	}
+	if item.StatusAt(now) == db.StatusVerified {
+		change.Type = db.EventReverify
+	}
+	item.MarkVerified(now, payload)
+	return db.ChangeAuthorization(networkID, item, change)
+}
+
+// recordProofFailure stores why the proof was rejected and returns cause. An
+// authorization which has already been verified is left untouched so that a
+// bad proof submitted by someone else does not revoke it.
+func recordProofFailure(networkID int, item db.AuthorizationItem, at time.Time, payload string, cause error) error {
+	if item.StatusAt(at) != db.StatusVerified {
+		item.MarkFailed(at, proof.Reason(cause), payload)
+		err := db.ChangeAuthorization(networkID, item, db.AuthorizationChange{
+			Type:  db.EventFail,
+			Actor: db.ActorUser,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return cause
+}
+
+func getSocialProof(userAddress string, platformName db.PlatformName) (*SocialProof, error) {
+	payload := GetUserLastProofEventPlayload{
+		UserAddress: userAddress,
+		Platform:    platformName,
+	}
+	payloadBytes, _ := json.Marshal(payload)
+
+	input := &lambda.InvokeInput{
+		FunctionName:   aws.String("getUserLastProofEventLambda"),
+		Payload:        payloadBytes,
+		InvocationType: aws.String("RequestResponse"),
+	}
+
+	result, err := invokeLambda(input)
+	if err != nil {
+		return nil, err
+	}
+	if result.FunctionError != nil {
+		return nil, fmt.Errorf("getUserLastProofEventLambda failed: %s", *result.FunctionError)
+	}
+
+	var socialProof *SocialProof
+	if err = json.Unmarshal(result.Payload, &socialProof); err != nil {
+		return nil, err
+	}
+	// the address has not published any proof on the platform
+	if socialProof == nil {
+		return nil, proof.ErrProofNotFound
+	}
+
+	return socialProof, nil
+}
+
+func invokeLambda(input *lambda.InvokeInput) (result *lambda.InvokeOutput, err error) {
+	result, err = lambdaService.Invoke(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case lambda.ErrCodeServiceException:
+				fmt.Println(lambda.ErrCodeServiceException, aerr.Error())
+			case lambda.ErrCodeResourceNotFoundException:
+				fmt.Println(lambda.ErrCodeResourceNotFoundException, aerr.Error())
+			case lambda.ErrCodeInvalidRequestContentException:
+				fmt.Println(lambda.ErrCodeInvalidRequestContentException, aerr.Error())
+			case lambda.ErrCodeInvalidRuntimeException:
+				fmt.Println(lambda.ErrCodeInvalidRuntimeException, aerr.Error())
+			default:
+				fmt.Println(aerr.Error())
+			}
+		} else {
+			// Print the error, cast err to awserr.Error to get the Code and
+			// Message from an error.
+			fmt.Println(err.Error())
+		}
+	}
+
+	return
+}
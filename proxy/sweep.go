@@ -0,0 +1,210 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/eth"
+	"github.com/dcb9/keymeshOAuth/proof"
+	"github.com/dcb9/keymeshOAuth/twitter"
+)
+
+// DefaultSweepInterval is the minimum time between two checks on a platform
+// which has no interval of its own.
+const DefaultSweepInterval = 200 * time.Millisecond
+
+// DefaultSweepIntervals keep the sweep under the rate limits of the platform
+// APIs, statuses/show allows 900 requests per 15 minutes to an app.
+var DefaultSweepIntervals = map[db.PlatformName]time.Duration{
+	db.TwitterPlatformName: time.Second,
+}
+
+// sweepPageSize is the number of authorizations read at once.
+const sweepPageSize = 100
+
+// SweepOptions configures SweepProofs.
+type SweepOptions struct {
+	// NetworkIDs are the networks swept, all the registered networks if
+	// empty.
+	NetworkIDs []int
+	// MinAge skips the proofs checked less than MinAge ago, so that the
+	// sweeps which stop at their deadline make progress.
+	MinAge time.Duration
+	// Deadline stops the sweep, there is none if it is zero.
+	Deadline time.Time
+	// Intervals override DefaultSweepIntervals.
+	Intervals map[db.PlatformName]time.Duration
+	// DryRun checks the proofs without recording the results.
+	DryRun bool
+}
+
+// SweepReport counts what SweepProofs did.
+type SweepReport struct {
+	Checked int `json:"checked"`
+	Revoked int `json:"revoked"`
+	// Errors are the proofs which could not be checked, they are left as is.
+	Errors int `json:"errors"`
+	// Incomplete is set if the sweep stopped at its deadline.
+	Incomplete bool `json:"incomplete"`
+}
+
+// sweeper spaces the checks of every platform.
+type sweeper struct {
+	options   SweepOptions
+	report    SweepReport
+	lastCheck map[db.PlatformName]time.Time
+}
+
+// errSweepDeadline stops the sweep once its deadline is reached.
+var errSweepDeadline = errors.New("sweep deadline reached")
+
+// SweepProofs checks again the verified proofs and revokes the ones which
+// are not valid anymore, because the post was deleted, the account suspended
+// or renamed... The proofs which can not be checked because of the platform
+// are left as is.
+func SweepProofs(options SweepOptions) (*SweepReport, error) {
+	if len(options.NetworkIDs) < 1 {
+		options.NetworkIDs = eth.NetworkIDs()
+	}
+	s := &sweeper{
+		options:   options,
+		lastCheck: make(map[db.PlatformName]time.Time),
+	}
+
+	for _, networkID := range options.NetworkIDs {
+		for _, platformName := range Platforms() {
+			err := s.sweepPlatform(networkID, platformName)
+			if err == errSweepDeadline {
+				s.report.Incomplete = true
+				return &s.report, nil
+			}
+			if err != nil {
+				return &s.report, fmt.Errorf("network %d, %s: %s", networkID, platformName, err)
+			}
+		}
+	}
+
+	return &s.report, nil
+}
+
+func (s *sweeper) sweepPlatform(networkID int, platformName db.PlatformName) error {
+	provider, err := LookupProvider(platformName)
+	if err != nil {
+		return err
+	}
+
+	table := db.GetAuthorizationTable(networkID)
+	after := ""
+	for {
+		items, next, err := table.ScanAuthorizationItems(platformName, sweepPageSize, after)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			if item.StatusAt(time.Now()) != db.StatusVerified || item.RevokedByUser() || time.Since(item.CheckedAt) < s.options.MinAge {
+				continue
+			}
+			if err = s.sweepItem(networkID, provider, item); err != nil {
+				return err
+			}
+		}
+
+		if next == "" {
+			return nil
+		}
+		after = next
+	}
+}
+
+// sweepItem checks the proof once the platform can be called, it only
+// returns the errors which stop the sweep.
+func (s *sweeper) sweepItem(networkID int, provider Provider, item db.AuthorizationItem) error {
+	payload, verifyErr, err := s.check(networkID, provider, item)
+	if err != nil {
+		return err
+	}
+
+	if verifyErr != nil {
+		if _, ok := verifyErr.(*proof.Error); !ok {
+			log.Printf("network %d, %s of %s: %s", networkID, item.PlatformName, item.UserAddress, verifyErr)
+			s.report.Errors++
+			return nil
+		}
+	}
+
+	s.report.Checked++
+	change := db.AuthorizationChange{
+		Type:  db.EventReverify,
+		Actor: db.ActorSweep,
+	}
+	if verifyErr != nil {
+		log.Printf("network %d, %s of %s: revoked, %s", networkID, item.PlatformName, item.UserAddress, verifyErr)
+		s.report.Revoked++
+		item.MarkRevoked(time.Now(), proof.Reason(verifyErr), payload)
+		change.Type = db.EventRevoke
+	} else {
+		item.MarkChecked(time.Now(), payload)
+	}
+	if s.options.DryRun {
+		return nil
+	}
+
+	return db.ChangeAuthorization(networkID, item, change)
+}
+
+// check waits for the interval of the platform and verifies the proof. The
+// sweep waits for the reset of the Twitter rate limit and tries again.
+func (s *sweeper) check(networkID int, provider Provider, item db.AuthorizationItem) (payload string, verifyErr error, err error) {
+	for {
+		if err = s.wait(item.PlatformName); err != nil {
+			return "", nil, err
+		}
+
+		payload, verifyErr = verifyStoredProof(networkID, provider, item)
+		limitErr, ok := verifyErr.(*twitter.RateLimitError)
+		if !ok {
+			return payload, verifyErr, nil
+		}
+		if !s.options.Deadline.IsZero() && limitErr.Reset.After(s.options.Deadline) {
+			return "", nil, errSweepDeadline
+		}
+		log.Printf("network %d, %s of %s: %s", networkID, item.PlatformName, item.UserAddress, limitErr)
+		time.Sleep(time.Until(limitErr.Reset))
+	}
+}
+
+func (s *sweeper) wait(platformName db.PlatformName) error {
+	interval, ok := s.options.Intervals[platformName]
+	if !ok {
+		if interval, ok = DefaultSweepIntervals[platformName]; !ok {
+			interval = DefaultSweepInterval
+		}
+	}
+
+	next := s.lastCheck[platformName].Add(interval)
+	if !s.options.Deadline.IsZero() && next.After(s.options.Deadline) {
+		return errSweepDeadline
+	}
+	time.Sleep(time.Until(next))
+	s.lastCheck[platformName] = time.Now()
+
+	return nil
+}
+
+// verifyStoredProof checks the proof of the authorization as HandleVerify
+// did. The account linked to the authorization is looked up by ID when the
+// platform allows it, so that the renames do not revoke the proofs.
+func verifyStoredProof(networkID int, provider Provider, item db.AuthorizationItem) (string, error) {
+	// the authorizations stored before the accounts were linked have no
+	// user ID, they are only checked against the proof
+	profile, err := getAccountProfile(provider, item.Username, item.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	return provider.VerifyProof(profile, item.UserAddress, networkID, item.ProofURL)
+}
@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/proof"
+	"github.com/dcb9/keymeshOAuth/twitter"
+)
+
+// sweepPlatformName is a platform whose proofs are checked by sweepVerify.
+const sweepPlatformName db.PlatformName = "sweep"
+
+// sweepVerify is the check of the proof of the username, swapped by the
+// tests.
+var sweepVerify = func(username string) (string, error) {
+	return "payload", nil
+}
+
+func init() {
+	RegisterProvider(sweepPlatformName, sweepProvider{})
+}
+
+type sweepProvider struct{}
+
+func (sweepProvider) LoginURL(req *http.Request) (string, error) {
+	return "", nil
+}
+
+func (sweepProvider) Callback(req *http.Request) (Profile, error) {
+	return nil, ErrUnknownRequestToken
+}
+
+func (sweepProvider) GetProfile(username string) (Profile, error) {
+	return testProfile{username, "1"}, nil
+}
+
+func (sweepProvider) BatchGetProfiles(usernames []string) (map[string]Profile, error) {
+	return nil, nil
+}
+
+func (sweepProvider) VerifyProof(profile Profile, userAddress string, networkID int, proofURL string) (string, error) {
+	return sweepVerify(profile.Username())
+}
+
+func stubSweepVerify(t *testing.T, verify func(username string) (string, error)) {
+	previous := sweepVerify
+	sweepVerify = verify
+	t.Cleanup(func() {
+		sweepVerify = previous
+	})
+}
+
+// putVerified stores the verified proof of the username checked at
+// checkedAt, every test sweeps a network of its own.
+func putVerified(t *testing.T, networkID int, username string, checkedAt time.Time) db.AuthorizationItem {
+	t.Helper()
+
+	item := db.AuthorizationItem{
+		UserAddress:  "0x" + username,
+		PlatformName: sweepPlatformName,
+		Username:     username,
+		UserID:       "1",
+		ProofURL:     "https://example.com/" + username + "/proof",
+	}
+	item.MarkVerified(checkedAt, "payload")
+	if err := db.GetAuthorizationTable(networkID).PutAuthorizationItem(item); err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func getSwept(t *testing.T, networkID int, username string) (*db.AuthorizationItem, []db.AuthorizationEvent) {
+	t.Helper()
+
+	item, err := db.GetAuthorizationTable(networkID).GetAuthorizationItem("0x"+username, sweepPlatformName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, _, err := db.GetAuthorizationEventTable(networkID).GetAuthorizationEvents("0x"+username, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item, events
+}
+
+func sweepOptions(networkID int) SweepOptions {
+	return SweepOptions{
+		NetworkIDs: []int{networkID},
+		Intervals:  map[db.PlatformName]time.Duration{sweepPlatformName: 0},
+	}
+}
+
+func TestSweepProofs(t *testing.T) {
+	const networkID = 101
+	stubSweepVerify(t, func(username string) (string, error) {
+		switch username {
+		case "deleted":
+			return "", proof.ErrProofNotFound
+		case "unreachable":
+			return "", errors.New("connection reset")
+		}
+		return "payload", nil
+	})
+	checkedAt := time.Now().Add(-time.Hour)
+	for _, username := range []string{"valid", "deleted", "unreachable"} {
+		putVerified(t, networkID, username, checkedAt)
+	}
+
+	report, err := SweepProofs(sweepOptions(networkID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *report != (SweepReport{Checked: 2, Revoked: 1, Errors: 1}) {
+		t.Errorf("got %+v", report)
+	}
+
+	item, events := getSwept(t, networkID, "valid")
+	if item.StatusAt(time.Now()) != db.StatusVerified || !item.CheckedAt.After(checkedAt) {
+		t.Errorf("got %+v", item)
+	}
+	if len(events) != 1 || events[0].Type != db.EventReverify || events[0].Actor != db.ActorSweep {
+		t.Errorf("got events %+v", events)
+	}
+
+	item, events = getSwept(t, networkID, "deleted")
+	if item.StatusAt(time.Now()) != db.StatusRevoked || item.FailureReason != proof.Reason(proof.ErrProofNotFound) {
+		t.Errorf("got %+v", item)
+	}
+	if len(events) != 1 || events[0].Type != db.EventRevoke || events[0].Actor != db.ActorSweep {
+		t.Errorf("got events %+v", events)
+	}
+
+	// the proof which could not be checked is left as is
+	item, events = getSwept(t, networkID, "unreachable")
+	if item.StatusAt(time.Now()) != db.StatusVerified || !item.CheckedAt.Equal(checkedAt) {
+		t.Errorf("got %+v", item)
+	}
+	if len(events) != 0 {
+		t.Errorf("got events %+v", events)
+	}
+}
+
+func TestSweepProofsMinAge(t *testing.T) {
+	const networkID = 102
+	stubSweepVerify(t, func(username string) (string, error) {
+		return "", proof.ErrProofNotFound
+	})
+	putVerified(t, networkID, "recent", time.Now().Add(-time.Minute))
+	putVerified(t, networkID, "old", time.Now().Add(-2*time.Hour))
+
+	options := sweepOptions(networkID)
+	options.MinAge = time.Hour
+	report, err := SweepProofs(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *report != (SweepReport{Checked: 1, Revoked: 1}) {
+		t.Errorf("got %+v", report)
+	}
+	if item, _ := getSwept(t, networkID, "recent"); item.StatusAt(time.Now()) != db.StatusVerified {
+		t.Errorf("the recent proof was checked, got %+v", item)
+	}
+	if item, _ := getSwept(t, networkID, "old"); item.StatusAt(time.Now()) != db.StatusRevoked {
+		t.Errorf("the old proof was not checked, got %+v", item)
+	}
+}
+
+func TestSweepProofsDryRun(t *testing.T) {
+	const networkID = 103
+	stubSweepVerify(t, func(username string) (string, error) {
+		return "", proof.ErrProofNotFound
+	})
+	putVerified(t, networkID, "deleted", time.Now().Add(-time.Hour))
+
+	options := sweepOptions(networkID)
+	options.DryRun = true
+	report, err := SweepProofs(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *report != (SweepReport{Checked: 1, Revoked: 1}) {
+		t.Errorf("got %+v", report)
+	}
+
+	item, events := getSwept(t, networkID, "deleted")
+	if item.StatusAt(time.Now()) != db.StatusVerified || len(events) != 0 {
+		t.Errorf("the dry run recorded %+v, %+v", item, events)
+	}
+}
+
+func TestSweepProofsRateLimit(t *testing.T) {
+	const networkID = 104
+	reset := time.Now().Add(100 * time.Millisecond)
+	calls := 0
+	stubSweepVerify(t, func(username string) (string, error) {
+		calls++
+		if calls == 1 {
+			return "", &twitter.RateLimitError{Reset: reset}
+		}
+		return "payload", nil
+	})
+	putVerified(t, networkID, "limited", time.Now().Add(-time.Hour))
+
+	report, err := SweepProofs(sweepOptions(networkID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *report != (SweepReport{Checked: 1}) || calls != 2 {
+		t.Errorf("got %+v after %d calls", report, calls)
+	}
+	if item, _ := getSwept(t, networkID, "limited"); item.CheckedAt.Before(reset) {
+		t.Errorf("the proof was checked again at %s, before the reset at %s", item.CheckedAt, reset)
+	}
+}
+
+func TestSweepProofsRateLimitDeadline(t *testing.T) {
+	const networkID = 105
+	stubSweepVerify(t, func(username string) (string, error) {
+		return "", &twitter.RateLimitError{Reset: time.Now().Add(time.Hour)}
+	})
+	checkedAt := time.Now().Add(-time.Hour)
+	putVerified(t, networkID, "limited", checkedAt)
+
+	// the reset is after the deadline, the sweep stops without waiting
+	options := sweepOptions(networkID)
+	options.Deadline = time.Now().Add(time.Minute)
+	start := time.Now()
+	report, err := SweepProofs(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *report != (SweepReport{Incomplete: true}) {
+		t.Errorf("got %+v", report)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("the sweep waited %s", elapsed)
+	}
+	if item, _ := getSwept(t, networkID, "limited"); !item.CheckedAt.Equal(checkedAt) {
+		t.Errorf("got %+v", item)
+	}
+}
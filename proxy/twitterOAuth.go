@@ -1,192 +1,274 @@
 package proxy
 
 import (
-	"crypto/md5"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
-	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/pkce"
+	"github.com/dcb9/keymeshOAuth/proof"
 	"github.com/dcb9/keymeshOAuth/twitter"
 	goTwitter "github.com/dghubble/go-twitter/twitter"
 )
 
 var (
-	oauth1Config   = twitter.NewConfig()
-	GetUserInfoErr = errors.New("get user info error")
-	lambdaService  = lambda.New(session.New())
+	oauth1Config         = twitter.NewConfig()
+	twitterOAuth2Config  = twitter.NewOAuth2Config()
+	twitterOAuth2Enabled = twitter.UseOAuth2()
+	statusFetcher        = twitter.NewStatusFetcher()
 )
 
-type GetUserLastProofEventPlayload struct {
-	UserAddress string          `json:"userAddress"`
-	Platform    db.PlatformName `json:"platform"`
+func init() {
+	RegisterProvider(db.TwitterPlatformName, twitterProvider{})
 }
 
-type SocialProof struct {
-	ProofURL string `json:"proofURL"`
-	Username string `json:"username"`
+type twitterProvider struct{}
+
+// twitterProfile is the stored profile of the Twitter user, as returned by
+// the last login.
+type twitterProfile struct {
+	*db.TwitterProfile
 }
 
-func HandleTwitterLoginURL() (string, error) {
-	return twitter.GenerateTwitterLoginURL(oauth1Config)
+func (p twitterProfile) Username() string {
+	return p.ScreenName
 }
 
-func HandleTwitterCallback(req *http.Request) ([]byte, error) {
-	user := twitter.GetTwitterUser(oauth1Config, req)
-	if user == nil {
-		return nil, GetUserInfoErr
+func (p twitterProfile) UserID() string {
+	return p.IDStr
+}
+
+func (p twitterProfile) Public() interface{} {
+	return NewTwitterOAuthInfo(*p.TwitterProfile)
+}
+
+func (p twitterProfile) EmailAddress() string {
+	return p.Email
+}
+
+// LoginURL starts an OAuth 2.0 login if TWITTER_OAUTH_VERSION is 2 and an
+// OAuth1 login otherwise.
+func (twitterProvider) LoginURL(req *http.Request) (string, error) {
+	state, err := newLoginState(db.TwitterPlatformName, req)
+	if err != nil {
+		return "", err
+	}
+	if twitterOAuth2Enabled {
+		return twitterOAuth2LoginURL(state)
+	}
+
+	// OAuth1 has no state, it is carried by the callback URL
+	config := *oauth1Config
+	if config.CallbackURL, err = withLoginState(config.CallbackURL, state); err != nil {
+		return "", err
 	}
 
-	_, err := db.PutTwitterOAuthItem(*user)
+	loginURL, requestToken, requestSecret, err := twitter.GenerateTwitterLoginURL(&config)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	return json.Marshal(user)
+	err = db.PutRequestToken(db.RequestToken{
+		Token:        requestToken,
+		Secret:       requestSecret,
+		PlatformName: db.TwitterPlatformName,
+		ExpiresAt:    time.Now().Add(requestTokenTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return loginURL, nil
 }
 
-func HandleTwitterVerify(userAddress string, networkID int, socialProof *SocialProof) (err error) {
-	if socialProof == nil {
-		socialProof, err = getSocialProof(userAddress)
-		if err != nil {
-			return
-		}
+// twitterOAuth2LoginURL keeps the PKCE code verifier as the secret of the
+// state.
+func twitterOAuth2LoginURL(state string) (string, error) {
+	verifier, err := pkce.NewVerifier()
+	if err != nil {
+		return "", err
 	}
 
-	item, err := db.GetTwitterOAuthItem(socialProof.Username)
+	err = db.PutRequestToken(db.RequestToken{
+		Token:        state,
+		Secret:       verifier,
+		PlatformName: db.TwitterPlatformName,
+		ExpiresAt:    time.Now().Add(requestTokenTTL).Unix(),
+	})
 	if err != nil {
-		fmt.Println(err.Error())
-		return
+		return "", err
 	}
-	fmt.Println("getTwitterOAuthItem:", item)
 
-	_, err = db.GetAuthorizationTable(networkID).
-		PutAuthorizationItem(db.AuthorizationItem{
-			UserAddress:  userAddress,
-			PlatformName: db.TwitterPlatformName,
-			Username:     socialProof.Username,
-			ProofURL:     socialProof.ProofURL,
-			Verified:     true,
-			VerifiedAt:   time.Now(),
+	return twitter.GenerateOAuth2LoginURL(twitterOAuth2Config, state, verifier), nil
+}
+
+// Callback completes the logins of both flows whatever the configuration,
+// so that the logins in progress survive a switch.
+func (twitterProvider) Callback(req *http.Request) (Profile, error) {
+	var (
+		token string
+		user  *goTwitter.User
+		err   error
+	)
+	if twitter.IsOAuth2Callback(req) {
+		var code string
+		if code, token, err = twitter.ParseOAuth2Callback(req); err != nil {
+			return nil, err
+		}
+		user, err = completeTwitterLogin(token, func(verifier string) (*goTwitter.User, error) {
+			return twitter.GetTwitterUserOAuth2(twitterOAuth2Config, code, verifier)
 		})
+	} else {
+		var verifier string
+		if token, verifier, err = twitter.ParseAuthorizationCallback(req); err != nil {
+			return nil, err
+		}
+		user, err = completeTwitterLogin(token, func(requestSecret string) (*goTwitter.User, error) {
+			return twitter.GetTwitterUser(oauth1Config, token, requestSecret, verifier)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := db.PutTwitterProfile(*user, time.Now())
+	if err != nil {
+		return nil, err
+	}
 
-	return
+	return twitterProfile{profile}, nil
 }
 
-func getSocialProof(userAddress string) (*SocialProof, error) {
-	payload := GetUserLastProofEventPlayload{
-		UserAddress: userAddress,
-		Platform:    db.TwitterPlatformName,
+// completeTwitterLogin takes the request token, or the state of an OAuth 2.0
+// login, and gets the user with its secret.
+func completeTwitterLogin(token string, getUser func(secret string) (*goTwitter.User, error)) (*goTwitter.User, error) {
+	stored, err := db.TakeRequestToken(token)
+	if err == db.ErrNotFound || (err == nil && stored.PlatformName != db.TwitterPlatformName) {
+		return nil, ErrUnknownRequestToken
+	}
+	if err != nil {
+		return nil, err
 	}
-	payloadBytes, _ := json.Marshal(payload)
 
-	input := &lambda.InvokeInput{
-		FunctionName:   aws.String("getUserLastProofEventLambda"),
-		Payload:        payloadBytes,
-		InvocationType: aws.String("RequestResponse"),
+	user, err := getUser(stored.Secret)
+	if err != nil {
+		fmt.Println(err)
+		return nil, GetUserInfoErr
 	}
 
-	result, err := invokeLambda(input)
+	return user, nil
+}
 
-	var socialProof *SocialProof
-	fmt.Printf("result payload: %s\n", string(result.Payload))
-	err = json.Unmarshal(result.Payload, &socialProof)
+// GetProfile returns the user who last logged in with the screen name.
+func (twitterProvider) GetProfile(username string) (Profile, error) {
+	profile, err := db.GetTwitterProfileByScreenName(username)
 	if err != nil {
-		fmt.Println(err.Error())
 		return nil, err
 	}
 
-	return socialProof, nil
+	return twitterProfile{profile}, nil
 }
 
-func NewTwitterOAuthInfo(user goTwitter.User) *TwitterOAuthInfo {
-	return &TwitterOAuthInfo{
-		User: &user,
+func (twitterProvider) BatchGetProfiles(usernames []string) (map[string]Profile, error) {
+	stored, err := db.BatchGetTwitterProfilesByScreenName(usernames)
+	if err != nil {
+		return nil, err
 	}
+
+	return newTwitterProfiles(stored), nil
 }
 
-func fillTwitterOAuthInfo(userInfoList []*UserInfo, wg *sync.WaitGroup) {
-	defer wg.Done()
+func (twitterProvider) BatchGetProfilesByUserID(userIDs []string) (map[string]Profile, error) {
+	stored, err := db.BatchGetTwitterProfiles(userIDs)
+	if err != nil {
+		return nil, err
+	}
 
-	usernames := make([]string, 0)
-UserInfoList:
-	for _, v := range userInfoList {
-		for _, username := range usernames {
-			if username == v.Username {
-				continue UserInfoList
-			}
-		}
-		usernames = append(usernames, v.Username)
+	return newTwitterProfiles(stored), nil
+}
+
+func newTwitterProfiles(stored map[string]db.TwitterProfile) map[string]Profile {
+	profiles := make(map[string]Profile)
+	for key, v := range stored {
+		v := v
+		profiles[key] = twitterProfile{&v}
 	}
-	if len(usernames) < 1 {
-		return
+
+	return profiles
+}
+
+func (twitterProvider) VerifyProof(profile Profile, userAddress string, networkID int, proofURL string) (string, error) {
+	return verifyTweet(profile.(twitterProfile).TwitterProfile, userAddress, networkID, proofURL)
+}
+
+// verifyTweet checks that the proof tweet was posted by the user and
+// contains the claim signed by the address. The tweets posted before a rename
+// claim one of the former screen names of the user.
+func verifyTweet(profile *db.TwitterProfile, userAddress string, networkID int, proofURL string) (string, error) {
+	_, statusID, err := twitter.ParseStatusURL(proofURL)
+	if err != nil {
+		return "", proof.ErrProofNotFound
 	}
 
-	data, err := db.BatchGetTwitterOAuth(usernames)
+	tweet, err := statusFetcher.FetchStatus(statusID)
+	if err == twitter.ErrStatusNotFound {
+		return "", proof.ErrProofNotFound
+	}
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	list := make(map[string]*TwitterOAuthInfo)
-	for i, v := range data {
-		list[i] = NewTwitterOAuthInfo(v)
+	if tweet.User == nil || tweet.User.IDStr != profile.IDStr {
+		return "", proof.ErrAuthorMismatch
 	}
 
-	for i, v := range userInfoList {
-		if v.PlatformName == db.TwitterPlatformName {
-			info := list[v.Username]
-			userInfoList[i].TwitterOAuthInfo = info
-			userInfoList[i].GravatarHash = fmt.Sprintf("%x", md5.Sum([]byte(info.User.Email)))
-		}
+	text := tweet.FullText
+	if text == "" {
+		text = tweet.Text
 	}
-}
 
-func fillOAuthInfo(userInfoList []*UserInfo) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = errors.New(fmt.Sprintf("error %s", r))
+	var (
+		result  error = proof.ErrClaimNotFound
+		payload string
+	)
+	for _, screenName := range screenNames(profile) {
+		claim := proof.Claim{
+			PlatformName: db.TwitterPlatformName,
+			Username:     screenName,
+			UserAddress:  userAddress,
+			NetworkID:    networkID,
 		}
-	}()
-
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go fillTwitterOAuthInfo(userInfoList, &wg)
-	//go fillFacebookOAuthInfo(userInfoList, &wg)
-	//go fillGithubOAuthInfo(userInfoList, &wg)
-	wg.Wait()
+		found, err := proof.Verify(claim, text)
+		if err == nil {
+			return found, nil
+		}
+		if err != proof.ErrClaimNotFound {
+			result, payload = err, found
+		}
+	}
 
-	return
+	return payload, result
 }
 
-func invokeLambda(input *lambda.InvokeInput) (result *lambda.InvokeOutput, err error) {
-	result, err = lambdaService.Invoke(input)
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case lambda.ErrCodeServiceException:
-				fmt.Println(lambda.ErrCodeServiceException, aerr.Error())
-			case lambda.ErrCodeResourceNotFoundException:
-				fmt.Println(lambda.ErrCodeResourceNotFoundException, aerr.Error())
-			case lambda.ErrCodeInvalidRequestContentException:
-				fmt.Println(lambda.ErrCodeInvalidRequestContentException, aerr.Error())
-			case lambda.ErrCodeInvalidRuntimeException:
-				fmt.Println(lambda.ErrCodeInvalidRuntimeException, aerr.Error())
-			default:
-				fmt.Println(aerr.Error())
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			fmt.Println(err.Error())
+// screenNames returns the current screen name of the user followed by the
+// former ones, latest first.
+func screenNames(profile *db.TwitterProfile) []string {
+	names := []string{profile.ScreenName}
+	for i := len(profile.ScreenNameHistory) - 1; i >= 0; i-- {
+		name := profile.ScreenNameHistory[i].ScreenName
+		if db.NormalizeUsername(name) != db.NormalizeUsername(profile.ScreenName) {
+			names = append(names, name)
 		}
 	}
 
-	return
+	return names
+}
+
+func NewTwitterOAuthInfo(profile db.TwitterProfile) *TwitterOAuthInfo {
+	return &TwitterOAuthInfo{
+		User:               &profile.User,
+		ScreenNameHistory:  profile.ScreenNameHistory,
+		ScreenNameReleased: profile.ScreenNameReleased,
+	}
 }
@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/pkce"
+	"github.com/dcb9/keymeshOAuth/proof"
+	"github.com/dcb9/keymeshOAuth/twitter"
+	goTwitter "github.com/dghubble/go-twitter/twitter"
+	"golang.org/x/oauth2"
+)
+
+// stubTweets points statusFetcher to a stub of the Twitter API serving
+// tweets by ID until the test ends.
+func stubTweets(t *testing.T, tweets map[string]goTwitter.Tweet) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"token_type":"bearer","access_token":"app-token"}`))
+	})
+	mux.HandleFunc("/1.1/statuses/show.json", func(w http.ResponseWriter, r *http.Request) {
+		tweet, ok := tweets[r.URL.Query().Get("id")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(tweet)
+	})
+	server := httptest.NewServer(mux)
+
+	saved := statusFetcher
+	statusFetcher = &twitter.StatusFetcher{BaseURL: server.URL, HTTPClient: server.Client()}
+	t.Cleanup(func() {
+		statusFetcher = saved
+		server.Close()
+	})
+}
+
+func TestVerifyTweet(t *testing.T) {
+	signer := newTestSigner(t)
+	other := newTestSigner(t)
+
+	claim := proof.Claim{
+		PlatformName: db.TwitterPlatformName,
+		Username:     "alice",
+		UserAddress:  signer.address,
+		NetworkID:    1,
+	}
+	formerClaim := claim
+	formerClaim.Username = "alice_old"
+
+	author := &goTwitter.User{IDStr: "42"}
+	tweets := map[string]goTwitter.Tweet{
+		"1": {User: author, FullText: claim.Text() + " " + signer.signMessage(t, claim.Text())},
+		"2": {User: &goTwitter.User{IDStr: "43"}, FullText: claim.Text() + " " + signer.signMessage(t, claim.Text())},
+		"3": {User: author, FullText: "gm"},
+		"4": {User: author, FullText: claim.Text() + " " + other.signMessage(t, claim.Text())},
+		"5": {User: author, FullText: formerClaim.Text() + " " + signer.signMessage(t, formerClaim.Text())},
+		// the text is truncated unless the full text is requested
+		"6": {User: author, Text: claim.Text() + " " + signer.signMessage(t, claim.Text())},
+	}
+	stubTweets(t, tweets)
+
+	profile := &db.TwitterProfile{
+		User: goTwitter.User{IDStr: "42", ScreenName: "Alice"},
+		ScreenNameHistory: []db.TwitterScreenName{
+			{ScreenName: "alice_old"},
+			{ScreenName: "Alice"},
+		},
+	}
+
+	tests := []struct {
+		proofURL string
+		err      error
+	}{
+		{"https://twitter.com/alice/status/1", nil},
+		{"https://twitter.com/alice/status/2", proof.ErrAuthorMismatch},
+		{"https://twitter.com/alice/status/3", proof.ErrClaimNotFound},
+		{"https://twitter.com/alice/status/4", proof.ErrInvalidSignature},
+		{"https://twitter.com/alice_old/status/5", nil},
+		{"https://twitter.com/alice/status/6", nil},
+		{"https://twitter.com/alice/status/7", proof.ErrProofNotFound},
+		{"https://example.com/alice/status/1", proof.ErrProofNotFound},
+	}
+
+	for _, test := range tests {
+		payload, err := verifyTweet(profile, signer.address, 1, test.proofURL)
+		if err != test.err {
+			t.Errorf("%s: got %v, want %v", test.proofURL, err, test.err)
+			continue
+		}
+		if err == nil && payload == "" {
+			t.Errorf("%s: got no payload", test.proofURL)
+		}
+	}
+}
+
+// stubTwitterOAuth2 points twitterOAuth2Config to a stub of the OAuth 2.0
+// API which exchanges the code "code" for the verifier of the challenge, and
+// serves users/me of jack, until the test ends.
+func stubTwitterOAuth2(t *testing.T, challenge *string) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/2/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostFormValue("code") != "code" || pkce.Challenge(r.PostFormValue("code_verifier")) != *challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_request"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"token","token_type":"bearer"}`))
+	})
+	mux.HandleFunc("/2/users/me", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"id":"12","username":"jack","name":"jack"}}`))
+	})
+	server := httptest.NewServer(mux)
+
+	saved := twitterOAuth2Config
+	twitterOAuth2Config = &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  server.URL + "/i/oauth2/authorize",
+			TokenURL: server.URL + "/2/oauth2/token",
+		},
+	}
+	t.Cleanup(func() {
+		twitterOAuth2Config = saved
+		server.Close()
+	})
+}
+
+func TestTwitterOAuth2Callback(t *testing.T) {
+	var challenge string
+	stubTwitterOAuth2(t, &challenge)
+	callback := func(state string) (Profile, error) {
+		req := httptest.NewRequest(http.MethodGet, "/oauth/twitter/callback?code=code&state="+state, nil)
+		return twitterProvider{}.Callback(req)
+	}
+
+	loginURL, err := twitterOAuth2LoginURL("oauth2-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(loginURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge = u.Query().Get("code_challenge")
+
+	profile, err := callback("oauth2-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Username() != "jack" {
+		t.Errorf("got username %s", profile.Username())
+	}
+
+	// the state can only be used once
+	if _, err = callback("oauth2-state"); err != ErrUnknownRequestToken {
+		t.Errorf("got %v for a used state, want ErrUnknownRequestToken", err)
+	}
+	if _, err = callback("unknown"); err != ErrUnknownRequestToken {
+		t.Errorf("got %v for an unknown state, want ErrUnknownRequestToken", err)
+	}
+
+	// the code was issued for the challenge of another login
+	if _, err = twitterOAuth2LoginURL("oauth2-other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = callback("oauth2-other"); err != GetUserInfoErr {
+		t.Errorf("got %v for another verifier, want GetUserInfoErr", err)
+	}
+}
@@ -1,9 +1,13 @@
 package proxy
 
 import (
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"time"
+
 	"github.com/dcb9/keymeshOAuth/db"
+	"github.com/dcb9/keymeshOAuth/facebook"
+	"github.com/dcb9/keymeshOAuth/github"
+	"github.com/dcb9/keymeshOAuth/mastodon"
+	"github.com/dcb9/keymeshOAuth/oidc"
 	goTwitter "github.com/dghubble/go-twitter/twitter"
 )
 
@@ -18,68 +22,179 @@ type TwitterOAuthInfo struct {
 	IDStr               omit `json:"id_str,omitempty"`
 	Protected           omit `json:"protected,omitempty"`
 	Status              omit `json:"status,omitempty"`
+	// ScreenNameHistory lists the screen names the user logged in with,
+	// ScreenNameReleased is set once another user took the screen name.
+	ScreenNameHistory  []db.TwitterScreenName `json:"screenNameHistory,omitempty"`
+	ScreenNameReleased bool                   `json:"screenNameReleased,omitempty"`
+}
+
+// GitHubOAuthInfo is the public part of a GitHub profile.
+type GitHubOAuthInfo struct {
+	*github.User
+	Email omit `json:"email,omitempty"`
+}
+
+// FacebookOAuthInfo is the public part of a Facebook profile.
+type FacebookOAuthInfo struct {
+	*facebook.User
+	Email omit `json:"email,omitempty"`
+}
+
+// MastodonOAuthInfo is the public part of a Mastodon profile.
+type MastodonOAuthInfo struct {
+	Handle string `json:"handle"`
+	*mastodon.Account
+}
+
+// OIDCInfo is the public part of an OpenID Connect profile.
+type OIDCInfo struct {
+	*oidc.Identity
+	Email         omit `json:"email,omitempty"`
+	EmailVerified omit `json:"email_verified,omitempty"`
+}
+
+// DomainInfo is the profile of the dns and web platforms.
+type DomainInfo struct {
+	Domain string `json:"domain"`
 }
 
 type UserInfo struct {
-	UserAddress      string            `json:"userAddress"`
-	Username         string            `json:"username"`
-	PlatformName     db.PlatformName   `json:"platformName"`
-	TwitterOAuthInfo *TwitterOAuthInfo `json:"twitterOAuthInfo"`
-	GravatarHash     string            `json:"gravatarHash"`
-	ProofURL         string            `json:"proofURL"`
+	UserAddress  string          `json:"userAddress"`
+	Username     string          `json:"username"`
+	PlatformName db.PlatformName `json:"platformName"`
+	// Profile is the public profile of the user on the platform, see
+	// Profile.Public.
+	Profile      interface{} `json:"profile"`
+	GravatarHash string      `json:"gravatarHash"`
+	ProofURL     string      `json:"proofURL"`
+	// Status is the state of the proof, FailureReason the code of the last
+	// rejection and Attempts the number of rejections in a row.
+	Status        db.AuthorizationStatus `json:"status"`
+	FailureReason string                 `json:"failureReason,omitempty"`
+	Attempts      int                    `json:"attempts,omitempty"`
+	VerifiedAt    *time.Time             `json:"verifiedAt,omitempty"`
+	LastCheckedAt *time.Time             `json:"lastCheckedAt,omitempty"`
+	// ProofPayload is the claim and the signature found by the last check.
+	ProofPayload string `json:"proofPayload,omitempty"`
+
+	// userID is the account the authorization is linked to, it is not
+	// public.
+	userID string
 }
 
-func HandleSearchUserByUsernamePrefix(usernamePrefix string, networkID int, limit int) ([]*UserInfo, error) {
-	output, err := db.GetAuthorizationTable(networkID).ScanUsernamePrefix(usernamePrefix)
-	if err != nil {
-		return nil, err
+// UserInfoPage is one page of a user lookup, NextCursor is empty on the last
+// page. The users are the body of the responses and NextCursor is sent in the
+// NextCursorHeader, so that the clients which read the body as a list of
+// users keep working.
+type UserInfoPage struct {
+	Users      []*UserInfo
+	NextCursor string
+}
+
+// MaxSearchLimit is the maximum number of users returned in a page.
+const MaxSearchLimit = 100
+
+// pageLimit caps the limit of a page, limit < 1 means no limit as in the
+// stores so that the lookups without a limit return all the users.
+func pageLimit(limit int) int {
+	if limit < 1 {
+		return 0
+	}
+	if limit > MaxSearchLimit {
+		return MaxSearchLimit
 	}
 
-	return convertScanUsernameOutput(output)
+	return limit
 }
 
-func HandleGetUserByUserAddress(userAddress string, networkID int) ([]*UserInfo, error) {
-	output, err := db.GetAuthorizationTable(networkID).
-		GetAuthorizationItemByUserAddress(&userAddress)
+type authorizationLookup func(limit int, after string) ([]db.AuthorizationItem, string, error)
+
+// lookupUsers runs one page of the lookup, query identifies the lookup so the
+// cursors of other lookups are rejected.
+func lookupUsers(query string, networkID int, limit int, encodedCursor string, lookup authorizationLookup) (*UserInfoPage, error) {
+	limit = pageLimit(limit)
+	after, err := decodeCursor(encodedCursor, query, networkID)
 	if err != nil {
 		return nil, err
 	}
 
-	userInfoList := make([]*UserInfo, 0)
-	err = dynamodbattribute.UnmarshalListOfMaps(output.Items, &userInfoList)
+	items, next, err := lookup(limit, after)
 	if err != nil {
 		return nil, err
 	}
 
-	err = fillOAuthInfo(userInfoList)
+	userInfoList, err := convertAuthorizationItems(items)
 	if err != nil {
 		return nil, err
 	}
 
-	return userInfoList, nil
-}
-
-func HandleGetUserByUsername(username string, networkID int) ([]*UserInfo, error) {
-	output, err := db.GetAuthorizationTable(networkID).
-		ScanUsername(username)
+	nextCursor, err := encodeCursor(query, networkID, next)
 	if err != nil {
 		return nil, err
 	}
 
-	return convertScanUsernameOutput(output)
+	return &UserInfoPage{
+		Users:      userInfoList,
+		NextCursor: nextCursor,
+	}, nil
 }
 
-func convertScanUsernameOutput(output *dynamodb.ScanOutput) ([]*UserInfo, error) {
-	userInfoList := make([]*UserInfo, 0)
-	err := dynamodbattribute.UnmarshalListOfMaps(output.Items, &userInfoList)
-	if err != nil {
-		return nil, err
+func HandleSearchUserByUsernamePrefix(usernamePrefix string, networkID int, limit int, cursor string) (*UserInfoPage, error) {
+	return lookupUsers("usernamePrefix:"+db.NormalizeUsername(usernamePrefix), networkID, limit, cursor,
+		func(limit int, after string) ([]db.AuthorizationItem, string, error) {
+			return db.GetAuthorizationTable(networkID).
+				GetAuthorizationItemsByUsernamePrefix(usernamePrefix, limit, after)
+		})
+}
+
+func HandleGetUserByUserAddress(userAddress string, networkID int, limit int, cursor string) (*UserInfoPage, error) {
+	return lookupUsers("userAddress:"+userAddress, networkID, limit, cursor,
+		func(limit int, after string) ([]db.AuthorizationItem, string, error) {
+			return db.GetAuthorizationTable(networkID).
+				GetAuthorizationItemsByUserAddress(userAddress, limit, after)
+		})
+}
+
+func HandleGetUserByUsername(username string, networkID int, limit int, cursor string) (*UserInfoPage, error) {
+	return lookupUsers("username:"+db.NormalizeUsername(username), networkID, limit, cursor,
+		func(limit int, after string) ([]db.AuthorizationItem, string, error) {
+			return db.GetAuthorizationTable(networkID).
+				GetAuthorizationItemsByUsername(username, limit, after)
+		})
+}
+
+func convertAuthorizationItems(items []db.AuthorizationItem) ([]*UserInfo, error) {
+	now := time.Now()
+	userInfoList := make([]*UserInfo, len(items))
+	for i, item := range items {
+		userInfoList[i] = &UserInfo{
+			UserAddress:   item.UserAddress,
+			Username:      item.Username,
+			PlatformName:  item.PlatformName,
+			ProofURL:      item.ProofURL,
+			Status:        item.StatusAt(now),
+			FailureReason: item.FailureReason,
+			Attempts:      item.Attempts,
+			VerifiedAt:    optionalTime(item.VerifiedAt),
+			LastCheckedAt: optionalTime(item.CheckedAt),
+			ProofPayload:  item.ProofPayload,
+			userID:        item.UserID,
+		}
 	}
 
-	err = fillOAuthInfo(userInfoList)
+	err := fillOAuthInfo(userInfoList)
 	if err != nil {
 		return nil, err
 	}
 
 	return userInfoList, nil
 }
+
+// optionalTime omits the zero times from the responses, the SQL backends
+// default them to the epoch.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() || t.Unix() <= 0 {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,117 @@
+// Package safehttp makes the requests to the hosts named by the users, such
+// as the instances of the fediverse handles and the domains of the proofs.
+// They must not reach the loopback, private or link-local addresses of the
+// network the service runs in, whatever the host names resolve to.
+package safehttp
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+// MaxRedirects is how many redirections are followed.
+const MaxRedirects = 5
+
+// Request errors
+var (
+	ErrForbiddenAddress = errors.New("safehttp: the host resolves to a non-public address")
+	ErrTooManyRedirects = errors.New("safehttp: too many redirects")
+)
+
+var nonPublicNetworks = parseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+
+	return networks
+}
+
+// IsPublicIP reports whether ip is a unicast address reachable over the
+// internet.
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewClient returns a client which only connects to the public addresses
+// and follows at most MaxRedirects redirections, which are dialed the same
+// way. The addresses are checked once resolved, so a host name can not
+// point the service to its own network. Set ALLOW_PRIVATE_HOSTS=true to
+// reach the local stand-ins of the hosts in development.
+func NewClient(timeout time.Duration) *http.Client {
+	return newClient(timeout, os.Getenv("ALLOW_PRIVATE_HOSTS") == "true")
+}
+
+func newClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivate {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !IsPublicIP(net.ParseIP(host)) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		// no proxy, it would dial the addresses instead of the dialer
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: CheckRedirect,
+	}
+}
+
+// CheckRedirect stops after MaxRedirects redirections.
+func CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= MaxRedirects {
+		return ErrTooManyRedirects
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package safehttp
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":                true,
+		"2606:4700::1111":        true,
+		"127.0.0.1":              false,
+		"10.1.2.3":               false,
+		"172.31.255.255":         false,
+		"192.168.0.1":            false,
+		"169.254.169.254":        false,
+		"100.64.0.1":             false,
+		"0.0.0.0":                false,
+		"224.0.0.1":              false,
+		"::1":                    false,
+		"::":                     false,
+		"fe80::1":                false,
+		"fd00::1":                false,
+		"::ffff:127.0.0.1":       false,
+		"::ffff:169.254.169.254": false,
+	}
+
+	for s, want := range tests {
+		if got := IsPublicIP(net.ParseIP(s)); got != want {
+			t.Errorf("%s: got %t, want %t", s, got, want)
+		}
+	}
+	if IsPublicIP(nil) {
+		t.Error("an invalid IP is public")
+	}
+}
+
+func TestClientRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the loopback server was reached")
+	}))
+	defer server.Close()
+
+	_, err := newClient(time.Second, false).Get(server.URL)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("got %v, want ErrForbiddenAddress", err)
+	}
+
+	// the host names are checked once resolved
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	_, err = newClient(time.Second, false).Get("http://localhost:" + port)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("got %v for localhost, want ErrForbiddenAddress", err)
+	}
+}
+
+func TestClientCapsRedirects(t *testing.T) {
+	redirects := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirects++
+		http.Redirect(w, r, "/again", http.StatusFound)
+	}))
+	defer server.Close()
+
+	_, err := newClient(time.Second, true).Get(server.URL)
+	if !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("got %v, want ErrTooManyRedirects", err)
+	}
+	if redirects != MaxRedirects {
+		t.Errorf("got %d requests, want %d", redirects, MaxRedirects)
+	}
+}
@@ -0,0 +1,187 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dcb9/keymeshOAuth/pkce"
+	goTwitter "github.com/dghubble/go-twitter/twitter"
+	"golang.org/x/oauth2"
+)
+
+// OAuth2 login errors
+var (
+	ErrMissingCode = errors.New("twitter: callback is missing the code or the state")
+)
+
+// OAuth2Scopes are enough to read the user who logs in, offline.access is
+// not asked since the tokens are not kept.
+var OAuth2Scopes = []string{"tweet.read", "users.read"}
+
+// userFields are the fields of users/me which are mapped to goTwitter.User.
+const userFields = "created_at,description,location,name,profile_image_url,protected,public_metrics,url,verified"
+
+// UseOAuth2 reports whether the logins start with OAuth 2.0 instead of the
+// legacy OAuth1 flow, it is selected by TWITTER_OAUTH_VERSION=2.
+func UseOAuth2() bool {
+	return os.Getenv("TWITTER_OAUTH_VERSION") == "2"
+}
+
+// NewOAuth2Config reads the OAuth 2.0 client of the app, TWITTER_CALLBACK_URL
+// is shared with the OAuth1 flow. TWITTER_API_URL overrides the token URL
+// and TWITTER_AUTHORIZE_URL the authorize URL.
+func NewOAuth2Config() *oauth2.Config {
+	apiURL := os.Getenv("TWITTER_API_URL")
+	if apiURL == "" {
+		apiURL = "https://api.twitter.com"
+	}
+	authorizeURL := os.Getenv("TWITTER_AUTHORIZE_URL")
+	if authorizeURL == "" {
+		authorizeURL = "https://twitter.com/i/oauth2/authorize"
+	}
+
+	return &oauth2.Config{
+		ClientID:     os.Getenv("TWITTER_CLIENT_ID"),
+		ClientSecret: os.Getenv("TWITTER_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("TWITTER_CALLBACK_URL"),
+		Scopes:       OAuth2Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  authorizeURL,
+			TokenURL: apiURL + "/2/oauth2/token",
+		},
+	}
+}
+
+// GenerateOAuth2LoginURL returns the login URL, the verifier must be kept
+// with the state until the callback.
+func GenerateOAuth2LoginURL(config *oauth2.Config, state, verifier string) string {
+	return config.AuthCodeURL(state, pkce.ChallengeOptions(verifier)...)
+}
+
+// IsOAuth2Callback reports whether the callback completes an OAuth 2.0
+// login, the logins started before the flow is switched can still complete.
+func IsOAuth2Callback(req *http.Request) bool {
+	return req.URL.Query().Get("code") != "" || req.URL.Query().Get("error") != ""
+}
+
+// ParseOAuth2Callback returns the authorization code and the state of the
+// callback request.
+func ParseOAuth2Callback(req *http.Request) (code, state string, err error) {
+	if err = req.ParseForm(); err != nil {
+		return "", "", err
+	}
+
+	code = req.Form.Get("code")
+	state = req.Form.Get("state")
+	if code == "" || state == "" {
+		return "", "", ErrMissingCode
+	}
+
+	return code, state, nil
+}
+
+// userV2 is a user of the v2 API.
+type userV2 struct {
+	ID              string `json:"id"`
+	Username        string `json:"username"`
+	Name            string `json:"name"`
+	CreatedAt       string `json:"created_at"`
+	Description     string `json:"description"`
+	Location        string `json:"location"`
+	ProfileImageURL string `json:"profile_image_url"`
+	Protected       bool   `json:"protected"`
+	URL             string `json:"url"`
+	Verified        bool   `json:"verified"`
+	PublicMetrics   struct {
+		FollowersCount int `json:"followers_count"`
+		FollowingCount int `json:"following_count"`
+		TweetCount     int `json:"tweet_count"`
+		ListedCount    int `json:"listed_count"`
+	} `json:"public_metrics"`
+}
+
+// GetTwitterUserOAuth2 exchanges the authorization code for an access token
+// and returns the user who logged in, in the shape of the v1.1 users so that
+// the profiles are the same whatever the flow. The v2 API does not expose
+// the email addresses.
+func GetTwitterUserOAuth2(config *oauth2.Config, code, verifier string) (*goTwitter.User, error) {
+	ctx := context.Background()
+	token, err := config.Exchange(ctx, code, pkce.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+
+	tokenURL, err := url.Parse(config.Endpoint.TokenURL)
+	if err != nil {
+		return nil, err
+	}
+	meURL := tokenURL.Scheme + "://" + tokenURL.Host + "/2/users/me?user.fields=" + userFields
+
+	resp, err := config.Client(ctx, token).Get(meURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrUnableToGetTwitterUser
+	}
+
+	var me struct {
+		Data *userV2 `json:"data"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&me); err != nil {
+		return nil, err
+	}
+	if me.Data == nil {
+		return nil, ErrUnableToGetTwitterUser
+	}
+
+	user, err := me.Data.toV1()
+	if err != nil {
+		return nil, err
+	}
+	if err = validateResponse(user, resp, nil); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (u *userV2) toV1() (*goTwitter.User, error) {
+	id, err := strconv.ParseInt(u.ID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("twitter: invalid user ID %q", u.ID)
+	}
+
+	user := &goTwitter.User{
+		ID:                   id,
+		IDStr:                u.ID,
+		ScreenName:           u.Username,
+		Name:                 u.Name,
+		Description:          u.Description,
+		Location:             u.Location,
+		ProfileImageURL:      u.ProfileImageURL,
+		ProfileImageURLHttps: u.ProfileImageURL,
+		Protected:            u.Protected,
+		URL:                  u.URL,
+		Verified:             u.Verified,
+		FollowersCount:       u.PublicMetrics.FollowersCount,
+		FriendsCount:         u.PublicMetrics.FollowingCount,
+		StatusesCount:        u.PublicMetrics.TweetCount,
+		ListedCount:          u.PublicMetrics.ListedCount,
+	}
+	// the v1.1 API formats the dates as Ruby does
+	if createdAt, err := time.Parse(time.RFC3339, u.CreatedAt); err == nil {
+		user.CreatedAt = createdAt.UTC().Format(time.RubyDate)
+	}
+
+	return user, nil
+}
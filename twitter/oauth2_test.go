@@ -0,0 +1,143 @@
+package twitter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/dcb9/keymeshOAuth/pkce"
+	"golang.org/x/oauth2"
+)
+
+// newStubOAuth2API serves the token exchange of the code "code" with the
+// verifier "verifier", and users/me of jack for its access token.
+func newStubOAuth2API(t *testing.T) *oauth2.Config {
+	t.Helper()
+
+	writeJSON := func(w http.ResponseWriter, status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/2/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "code" || r.PostFormValue("code_verifier") != "verifier" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+			return
+		}
+		token := "token"
+		if r.PostFormValue("redirect_uri") == "https://keymesh.test/suspended" {
+			token = "suspended"
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"access_token": token, "token_type": "bearer"})
+	})
+	mux.HandleFunc("/2/users/me", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			writeJSON(w, http.StatusForbidden, map[string]string{"title": "Forbidden"})
+			return
+		}
+		if r.URL.Query().Get("user.fields") != userFields {
+			t.Errorf("got user.fields %q", r.URL.Query().Get("user.fields"))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{
+				"id":                "12",
+				"username":          "jack",
+				"name":              "jack",
+				"created_at":        "2006-03-21T20:50:14.000Z",
+				"profile_image_url": "https://pbs.twimg.com/profile_images/jack.jpg",
+				"public_metrics":    map[string]int{"followers_count": 6, "following_count": 4, "tweet_count": 2},
+			},
+		})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return &oauth2.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "https://keymesh.test/callback",
+		Scopes:       OAuth2Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  server.URL + "/i/oauth2/authorize",
+			TokenURL: server.URL + "/2/oauth2/token",
+		},
+	}
+}
+
+func TestGenerateOAuth2LoginURL(t *testing.T) {
+	config := newStubOAuth2API(t)
+
+	u, err := url.Parse(GenerateOAuth2LoginURL(config, "state", "verifier"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("state") != "state" || query.Get("scope") != "tweet.read users.read" {
+		t.Errorf("got %s", u)
+	}
+	if query.Get("code_challenge") != pkce.Challenge("verifier") || query.Get("code_challenge_method") != "S256" {
+		t.Errorf("got challenge %q", query.Get("code_challenge"))
+	}
+}
+
+func TestParseOAuth2Callback(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/oauth/twitter/callback?code=code&state=state", nil)
+	if !IsOAuth2Callback(req) {
+		t.Error("the callback is not an OAuth 2.0 one")
+	}
+	code, state, err := ParseOAuth2Callback(req)
+	if err != nil || code != "code" || state != "state" {
+		t.Errorf("got %q, %q, %v", code, state, err)
+	}
+
+	// the user denied the access
+	req = httptest.NewRequest(http.MethodGet, "/oauth/twitter/callback?error=access_denied&state=state", nil)
+	if !IsOAuth2Callback(req) {
+		t.Error("the denied callback is not an OAuth 2.0 one")
+	}
+	if _, _, err = ParseOAuth2Callback(req); err != ErrMissingCode {
+		t.Errorf("got %v, want ErrMissingCode", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/oauth/twitter/callback?oauth_token=token&oauth_verifier=verifier", nil)
+	if IsOAuth2Callback(req) {
+		t.Error("the OAuth1 callback is an OAuth 2.0 one")
+	}
+}
+
+func TestGetTwitterUserOAuth2(t *testing.T) {
+	config := newStubOAuth2API(t)
+
+	user, err := GetTwitterUserOAuth2(config, "code", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 12 || user.IDStr != "12" || user.ScreenName != "jack" {
+		t.Errorf("got %+v", user)
+	}
+	if user.FollowersCount != 6 || user.FriendsCount != 4 || user.StatusesCount != 2 {
+		t.Errorf("got metrics %d, %d, %d", user.FollowersCount, user.FriendsCount, user.StatusesCount)
+	}
+	if user.CreatedAt != "Tue Mar 21 20:50:14 +0000 2006" {
+		t.Errorf("got created_at %q", user.CreatedAt)
+	}
+
+	// the exchange fails with another verifier or code
+	if _, err = GetTwitterUserOAuth2(config, "code", "other"); err == nil {
+		t.Error("got no error for another verifier")
+	}
+	if _, err = GetTwitterUserOAuth2(config, "other", "verifier"); err == nil {
+		t.Error("got no error for another code")
+	}
+
+	// the token which can not read the user
+	config.RedirectURL = "https://keymesh.test/suspended"
+	if _, err = GetTwitterUserOAuth2(config, "code", "verifier"); err != ErrUnableToGetTwitterUser {
+		t.Errorf("got %v, want ErrUnableToGetTwitterUser", err)
+	}
+}
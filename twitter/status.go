@@ -0,0 +1,184 @@
+package twitter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	goTwitter "github.com/dghubble/go-twitter/twitter"
+)
+
+// Status errors
+var (
+	ErrInvalidStatusURL = errors.New("twitter: invalid status URL")
+	ErrStatusNotFound   = errors.New("twitter: status not found")
+)
+
+// RateLimitError is returned when the rate limit of the application is
+// exhausted until Reset.
+type RateLimitError struct {
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("twitter: rate limit exceeded until %s", e.Reset.Format(time.RFC3339))
+}
+
+// newRateLimitError reads the reset time of the x-rate-limit-reset header,
+// the limits are reset every 15 minutes if it is missing.
+func newRateLimitError(resp *http.Response) *RateLimitError {
+	reset := time.Now().Add(15 * time.Minute)
+	if seconds, err := strconv.ParseInt(resp.Header.Get("x-rate-limit-reset"), 10, 64); err == nil {
+		reset = time.Unix(seconds, 0)
+	}
+
+	return &RateLimitError{Reset: reset}
+}
+
+// StatusFetcher fetches tweets with the application-only authentication.
+type StatusFetcher struct {
+	// BaseURL is the root of the Twitter API, it can be pointed to a stub.
+	BaseURL        string
+	ConsumerKey    string
+	ConsumerSecret string
+	HTTPClient     *http.Client
+
+	mutex       sync.Mutex
+	bearerToken string
+}
+
+// NewStatusFetcher uses the application credentials from the environment,
+// TWITTER_API_URL overrides the Twitter API root.
+func NewStatusFetcher() *StatusFetcher {
+	baseURL := os.Getenv("TWITTER_API_URL")
+	if baseURL == "" {
+		baseURL = "https://api.twitter.com"
+	}
+
+	return &StatusFetcher{
+		BaseURL:        baseURL,
+		ConsumerKey:    os.Getenv("TWITTER_CONSUMER_KEY"),
+		ConsumerSecret: os.Getenv("TWITTER_CONSUMER_SECRET"),
+		HTTPClient:     http.DefaultClient,
+	}
+}
+
+var statusPathPattern = regexp.MustCompile(`^/([A-Za-z0-9_]{1,15})/status(?:es)?/([0-9]+)/?$`)
+
+// ParseStatusURL returns the screen name and the status ID of a tweet URL
+// such as https://twitter.com/jack/status/20.
+func ParseStatusURL(statusURL string) (screenName, statusID string, err error) {
+	u, err := url.Parse(statusURL)
+	if err != nil {
+		return "", "", ErrInvalidStatusURL
+	}
+
+	switch strings.ToLower(u.Host) {
+	case "twitter.com", "www.twitter.com", "mobile.twitter.com":
+	default:
+		return "", "", ErrInvalidStatusURL
+	}
+
+	matches := statusPathPattern.FindStringSubmatch(u.Path)
+	if matches == nil {
+		return "", "", ErrInvalidStatusURL
+	}
+
+	return matches[1], matches[2], nil
+}
+
+// FetchStatus returns the tweet with its full text.
+func (f *StatusFetcher) FetchStatus(statusID string) (*goTwitter.Tweet, error) {
+	token, err := f.getBearerToken()
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("id", statusID)
+	params.Set("tweet_mode", "extended")
+	req, err := http.NewRequest(http.MethodGet, f.BaseURL+"/1.1/statuses/show.json?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := f.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusForbidden:
+		// deleted tweets are 404, tweets of suspended or protected accounts
+		// are 403
+		return nil, ErrStatusNotFound
+	case http.StatusTooManyRequests:
+		return nil, newRateLimitError(resp)
+	default:
+		return nil, fmt.Errorf("twitter: unexpected status %s fetching tweet %s", resp.Status, statusID)
+	}
+
+	var tweet goTwitter.Tweet
+	if err = json.NewDecoder(resp.Body).Decode(&tweet); err != nil {
+		return nil, err
+	}
+
+	return &tweet, nil
+}
+
+// getBearerToken exchanges the consumer key and secret for an
+// application-only bearer token the first time it is called.
+func (f *StatusFetcher) getBearerToken() (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.bearerToken != "" {
+		return f.bearerToken, nil
+	}
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		f.BaseURL+"/oauth2/token",
+		strings.NewReader("grant_type=client_credentials"),
+	)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(url.QueryEscape(f.ConsumerKey), url.QueryEscape(f.ConsumerSecret))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=UTF-8")
+
+	resp, err := f.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("twitter: unexpected status %s getting a bearer token", resp.Status)
+	}
+
+	var token struct {
+		TokenType   string `json:"token_type"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.TokenType != "bearer" || token.AccessToken == "" {
+		return "", errors.New("twitter: invalid bearer token response")
+	}
+	f.bearerToken = token.AccessToken
+
+	return f.bearerToken, nil
+}
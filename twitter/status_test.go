@@ -0,0 +1,128 @@
+package twitter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newStubAPI serves the bearer token exchange and the tweets of statuses,
+// the IDs missing from statuses are deleted tweets.
+func newStubAPI(t *testing.T, statuses map[string]string) (*StatusFetcher, *int) {
+	t.Helper()
+
+	tokenRequests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		if key, secret, ok := r.BasicAuth(); !ok || key != "key" || secret != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"token_type":"bearer","access_token":"app-token"}`)
+	})
+	mux.HandleFunc("/1.1/statuses/show.json", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer app-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("tweet_mode") != "extended" {
+			t.Errorf("got tweet_mode %q", r.URL.Query().Get("tweet_mode"))
+		}
+
+		id := r.URL.Query().Get("id")
+		if id == "429" {
+			w.Header().Set("x-rate-limit-reset", "1500000000")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		status, ok := statuses[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, status)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return &StatusFetcher{
+		BaseURL:        server.URL,
+		ConsumerKey:    "key",
+		ConsumerSecret: "secret",
+		HTTPClient:     server.Client(),
+	}, &tokenRequests
+}
+
+func TestParseStatusURL(t *testing.T) {
+	tests := []struct {
+		url        string
+		screenName string
+		statusID   string
+	}{
+		{"https://twitter.com/jack/status/20", "jack", "20"},
+		{"https://mobile.twitter.com/jack/statuses/20/", "jack", "20"},
+		{"https://TWITTER.com/Jack_1/status/20", "Jack_1", "20"},
+		{"https://example.com/jack/status/20", "", ""},
+		{"https://twitter.com/jack/status/abc", "", ""},
+		{"https://twitter.com/jack", "", ""},
+		{"%", "", ""},
+	}
+
+	for _, test := range tests {
+		screenName, statusID, err := ParseStatusURL(test.url)
+		if test.statusID == "" {
+			if err != ErrInvalidStatusURL {
+				t.Errorf("%s: got %v, want ErrInvalidStatusURL", test.url, err)
+			}
+			continue
+		}
+		if err != nil || screenName != test.screenName || statusID != test.statusID {
+			t.Errorf("%s: got %q, %q, %v", test.url, screenName, statusID, err)
+		}
+	}
+}
+
+func TestFetchStatus(t *testing.T) {
+	fetcher, tokenRequests := newStubAPI(t, map[string]string{
+		"20": `{"id_str":"20","full_text":"just setting up my twttr","user":{"id_str":"12","screen_name":"jack"}}`,
+	})
+
+	for i := 0; i < 2; i++ {
+		tweet, err := fetcher.FetchStatus("20")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tweet.FullText != "just setting up my twttr" || tweet.User == nil || tweet.User.IDStr != "12" {
+			t.Errorf("got %+v", tweet)
+		}
+	}
+	if *tokenRequests != 1 {
+		t.Errorf("got %d bearer token requests, want 1", *tokenRequests)
+	}
+
+	if _, err := fetcher.FetchStatus("21"); err != ErrStatusNotFound {
+		t.Errorf("got %v for a deleted tweet, want ErrStatusNotFound", err)
+	}
+
+	_, err := fetcher.FetchStatus("429")
+	rateLimitErr, ok := err.(*RateLimitError)
+	if !ok {
+		t.Fatalf("got %v, want a *RateLimitError", err)
+	}
+	if !rateLimitErr.Reset.Equal(time.Unix(1500000000, 0)) {
+		t.Errorf("got reset %s", rateLimitErr.Reset)
+	}
+}
+
+func TestFetchStatusInvalidCredentials(t *testing.T) {
+	fetcher, _ := newStubAPI(t, nil)
+	fetcher.ConsumerSecret = "wrong"
+
+	if _, err := fetcher.FetchStatus("20"); err == nil {
+		t.Error("got no error for invalid credentials")
+	}
+}
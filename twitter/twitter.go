@@ -3,7 +3,6 @@ package twitter
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net/http"
 	"os"
 
@@ -21,31 +20,34 @@ func NewConfig() *oauth1.Config {
 	}
 }
 
-func GenerateTwitterLoginURL(config *oauth1.Config) (string, error) {
-	requestToken, _, err := config.RequestToken()
+// GenerateTwitterLoginURL returns the login URL along with the request token
+// and its secret, the secret is needed to complete the login.
+func GenerateTwitterLoginURL(config *oauth1.Config) (loginURL, requestToken, requestSecret string, err error) {
+	requestToken, requestSecret, err = config.RequestToken()
 	if err != nil {
-		return "", err
+		return "", "", "", err
 	}
 
 	authorizationURL, err := config.AuthorizationURL(requestToken)
 	if err != nil {
-		return "", err
+		return "", "", "", err
 	}
 
-	return authorizationURL.String(), nil
+	return authorizationURL.String(), requestToken, requestSecret, nil
 }
 
-func GetTwitterUser(config *oauth1.Config, request *http.Request) *goTwitter.User {
-	requestToken, verifier, err := oauth1.ParseAuthorizationCallback(request)
-	if err != nil {
-		fmt.Println(err)
-		return nil
-	}
+// ParseAuthorizationCallback returns the request token and the verifier of
+// the callback request.
+func ParseAuthorizationCallback(request *http.Request) (requestToken, verifier string, err error) {
+	return oauth1.ParseAuthorizationCallback(request)
+}
 
-	accessToken, accessSecret, err := config.AccessToken(requestToken, "", verifier)
+// GetTwitterUser exchanges the verified request token for an access token and
+// returns the user who logged in.
+func GetTwitterUser(config *oauth1.Config, requestToken, requestSecret, verifier string) (*goTwitter.User, error) {
+	accessToken, accessSecret, err := config.AccessToken(requestToken, requestSecret, verifier)
 	if err != nil {
-		fmt.Println(err)
-		return nil
+		return nil, err
 	}
 
 	httpClient := config.Client(context.Background(), oauth1.NewToken(accessToken, accessSecret))
@@ -58,11 +60,10 @@ func GetTwitterUser(config *oauth1.Config, request *http.Request) *goTwitter.Use
 	user, resp, err := twitterClient.Accounts.VerifyCredentials(accountVerifyParams)
 	err = validateResponse(user, resp, err)
 	if err != nil {
-		fmt.Println(err)
-		return nil
+		return nil, err
 	}
 
-	return user
+	return user, nil
 }
 
 // Twitter login errors